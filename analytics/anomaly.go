@@ -0,0 +1,294 @@
+package analytics
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Finding kinds
+const (
+	// Spike is a value well above its baseline
+	Spike = "spike"
+	// Drop is a value well below its baseline
+	Drop = "drop"
+	// Disappeared is an additive metric, such as searches, falling to almost
+	// nothing
+	Disappeared = "disappeared"
+	// Appeared is a value from a baseline flat at zero, where there's no
+	// spread to score it against
+	Appeared = "appeared"
+)
+
+const (
+	// DefaultWindow is how many earlier points make a baseline
+	DefaultWindow = 12
+	// DefaultMinHistory is how many earlier points a point needs to be judged
+	DefaultMinHistory = 4
+	// DefaultThreshold is the robust z-score a point needs to be a finding
+	DefaultThreshold = 3.5
+	// DefaultMinRelativeScale floors the spread at this fraction of the
+	// baseline, so a very steady series doesn't flag trivial moves
+	DefaultMinRelativeScale = 0.05
+	// disappearedFraction is how small, against its baseline, an additive
+	// value has to be to count as disappeared
+	disappearedFraction = 0.1
+)
+
+// Entity is what a series is about, e.g. a partner or a source tag
+type Entity struct {
+	Dimension string `json:"dimension"`
+	ID        int64  `json:"id"`
+	Name      string `json:"name"`
+}
+
+// Point is a series' value in one period
+type Point struct {
+	Period time.Time
+	Value  float64
+	// Volume is the searches behind the value; ratio metrics ignore points
+	// with too little
+	Volume float64
+}
+
+// Series is one metric of one entity over consecutive periods, oldest first.
+// Periods without data should be present with zero value and volume so that
+// positions line up with the seasonal cycle.
+type Series struct {
+	Entity
+	Metric string
+	// Additive metrics, like revenue or searches, sum over items; a missing
+	// period means zero. Ratios like TQ don't, and are skipped when thin.
+	Additive bool
+	Points   []Point
+}
+
+// Options tune detection; zero values take the defaults
+type Options struct {
+	Window     int
+	MinHistory int
+	// Season is the number of periods in a seasonal cycle, 12 for months; 0
+	// turns seasonal adjustment off
+	Season    int
+	Threshold float64
+	// Recent limits detection to the last Recent points; all if 0
+	Recent int
+	// MinVolume is the least volume a point of a ratio metric needs to be
+	// judged or used in a baseline
+	MinVolume        float64
+	MinRelativeScale float64
+}
+
+func (o Options) withDefaults() Options {
+	if o.Window <= 0 {
+		o.Window = DefaultWindow
+	}
+	if o.MinHistory <= 0 {
+		o.MinHistory = DefaultMinHistory
+	}
+	if o.Threshold <= 0 {
+		o.Threshold = DefaultThreshold
+	}
+	if o.MinRelativeScale <= 0 {
+		o.MinRelativeScale = DefaultMinRelativeScale
+	}
+	return o
+}
+
+// Finding is an anomalous point
+type Finding struct {
+	Entity
+	Metric string `json:"metric"`
+	Kind   string `json:"kind"`
+	// Period is the start of the anomalous period, as YYYY-MM-DD
+	Period   string  `json:"period"`
+	Value    float64 `json:"value"`
+	Expected float64 `json:"expected"`
+	// Score is how many robust standard deviations the value is from
+	// expected; findings are ranked by it. Appearances have none and rank
+	// last.
+	Score float64 `json:"score,omitempty"`
+	// Change is the difference from expected as a percentage, when expected
+	// isn't zero
+	Change *float64 `json:"change_percent,omitempty"`
+	// Seasonal is true when expected was adjusted by the same period a
+	// cycle earlier
+	Seasonal    bool   `json:"seasonal"`
+	Explanation string `json:"explanation"`
+}
+
+// Detect returns the anomalous points of a series. Each point is compared
+// with the median of the Window points before it, scaled by the same period a
+// season earlier when there's enough history, using the median absolute
+// deviation as the spread.
+func Detect(s Series, opts Options) []Finding {
+	opts = opts.withDefaults()
+	first := 0
+	if opts.Recent > 0 && len(s.Points) > opts.Recent {
+		first = len(s.Points) - opts.Recent
+	}
+
+	var findings []Finding
+	for i := first; i < len(s.Points); i++ {
+		p := s.Points[i]
+		if !s.usable(p, opts) {
+			continue
+		}
+		b, ok := s.baseline(i, opts)
+		if !ok {
+			continue
+		}
+		if b.scale == 0 {
+			// A flat line at zero; anything else is news, but a z-score
+			// would be meaningless
+			if p.Value > 0 {
+				f := Finding{
+					Entity:   s.Entity,
+					Metric:   s.Metric,
+					Kind:     Appeared,
+					Period:   p.Period.Format("2006-01-02"),
+					Value:    p.Value,
+					Seasonal: b.seasonal,
+				}
+				f.Explanation = explain(f, b.points)
+				findings = append(findings, f)
+			}
+			continue
+		}
+		score := (p.Value - b.expected) / b.scale
+		if math.Abs(score) < opts.Threshold {
+			continue
+		}
+
+		f := Finding{
+			Entity:   s.Entity,
+			Metric:   s.Metric,
+			Kind:     Spike,
+			Period:   p.Period.Format("2006-01-02"),
+			Value:    p.Value,
+			Expected: round(b.expected),
+			Score:    round(math.Abs(score)),
+			Seasonal: b.seasonal,
+		}
+		if score < 0 {
+			f.Kind = Drop
+			if s.Additive && p.Value <= disappearedFraction*b.expected {
+				f.Kind = Disappeared
+			}
+		}
+		if b.expected != 0 {
+			change := round((p.Value - b.expected) * 100 / math.Abs(b.expected))
+			f.Change = &change
+		}
+		f.Explanation = explain(f, b.points)
+		findings = append(findings, f)
+	}
+	return findings
+}
+
+// Rank sorts findings by score, highest first
+func Rank(findings []Finding) {
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].Score > findings[j].Score
+	})
+}
+
+// usable reports whether a point has enough volume to judge or learn from
+func (s Series) usable(p Point, opts Options) bool {
+	if s.Additive {
+		return true
+	}
+	return p.Volume > 0 && p.Volume >= opts.MinVolume
+}
+
+// baseline is what a point was expected to be
+type baseline struct {
+	expected float64
+	scale    float64
+	// points is how many earlier points it came from
+	points   int
+	seasonal bool
+}
+
+// baseline works out the expected value and spread for point i from the
+// usable points before it, or false if there are too few
+func (s Series) baseline(i int, opts Options) (baseline, bool) {
+	history := s.history(i, opts)
+	if len(history) < opts.MinHistory {
+		return baseline{}, false
+	}
+	median := Median(history)
+	b := baseline{expected: median, points: len(history)}
+
+	// Seasonality: how the same period a cycle ago compared with its own
+	// baseline. Factors far from 1 are more likely noise than season.
+	if opts.Season > 0 && i >= opts.Season {
+		j := i - opts.Season
+		if past := s.history(j, opts); len(past) >= opts.MinHistory && s.usable(s.Points[j], opts) {
+			if pastMedian := Median(past); pastMedian > 0 {
+				factor := s.Points[j].Value / pastMedian
+				if factor >= 0.5 && factor <= 2 {
+					b.expected, b.seasonal = median*factor, true
+				}
+			}
+		}
+	}
+
+	// The scale is 0 only for a line flat at zero, which Detect reports
+	// without scoring
+	b.scale = math.Max(MAD(history)*madScale, opts.MinRelativeScale*math.Abs(b.expected))
+	return b, true
+}
+
+// history returns the values of the usable points within Window before i
+func (s Series) history(i int, opts Options) []float64 {
+	var values []float64
+	for j := i - 1; j >= 0 && len(values) < opts.Window; j-- {
+		if s.usable(s.Points[j], opts) {
+			values = append(values, s.Points[j].Value)
+		}
+	}
+	return values
+}
+
+// explain describes a finding in a sentence
+func explain(f Finding, points int) string {
+	what := fmt.Sprintf("%s for %s %q", f.Metric, f.Dimension, f.Name)
+	if f.Kind == Appeared {
+		return fmt.Sprintf("%s came back at %s in the period starting %s, after a median of zero over the previous %d periods",
+			what, format(f.Value), f.Period, points)
+	}
+	var moved string
+	switch f.Kind {
+	case Spike:
+		moved = "rose to"
+	case Drop:
+		moved = "fell to"
+	case Disappeared:
+		moved = "all but disappeared, falling to"
+	}
+	basis := fmt.Sprintf("the median of the previous %d periods", points)
+	if f.Seasonal {
+		basis += ", adjusted by the same period a year earlier"
+	}
+	direction := "above"
+	if f.Kind != Spike {
+		direction = "below"
+	}
+	return fmt.Sprintf("%s %s %s in the period starting %s, against %s expected from %s; %.1f robust standard deviations %s normal",
+		what, moved, format(f.Value), f.Period, format(f.Expected), basis, f.Score, direction)
+}
+
+// format prints a value without needless decimals
+func format(v float64) string {
+	if v == math.Trunc(v) && math.Abs(v) < 1e15 {
+		return fmt.Sprintf("%.0f", v)
+	}
+	return fmt.Sprintf("%.4g", v)
+}
+
+// round rounds to two decimal places
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,161 @@
+package analytics
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestMedianMAD(t *testing.T) {
+	testCases := []struct {
+		values []float64
+		median float64
+		mad    float64
+	}{
+		{[]float64{3, 1, 2}, 2, 1},
+		{[]float64{1, 2, 3, 4}, 2.5, 1},
+		// One wild value barely moves either
+		{[]float64{10, 11, 9, 10, 500}, 10, 1},
+	}
+
+	for _, tc := range testCases {
+		if m := Median(tc.values); m != tc.median {
+			t.Errorf("Median(%v) = %v, expected %v", tc.values, m, tc.median)
+		}
+		if m := MAD(tc.values); m != tc.mad {
+			t.Errorf("MAD(%v) = %v, expected %v", tc.values, m, tc.mad)
+		}
+	}
+	if !math.IsNaN(Median(nil)) {
+		t.Errorf("Expected the median of nothing to be NaN")
+	}
+}
+
+// monthly builds a series of values, one per month from January 2022
+func monthly(metric string, additive bool, values []float64, volume float64) Series {
+	s := Series{Entity: Entity{Dimension: "source_tag", ID: 10, Name: "acme_bing"}, Metric: metric, Additive: additive}
+	for i, v := range values {
+		period := time.Date(2022, time.January, 1, 0, 0, 0, 0, time.UTC).AddDate(0, i, 0)
+		s.Points = append(s.Points, Point{Period: period, Value: v, Volume: volume})
+	}
+	return s
+}
+
+func TestDetect(t *testing.T) {
+	steady := []float64{100, 104, 98, 101, 99, 103, 100, 97, 102, 100}
+	with := func(values []float64, last ...float64) []float64 {
+		return append(append([]float64(nil), values...), last...)
+	}
+
+	// Revenue doubles every December
+	var seasonal []float64
+	for i := 0; i < 24; i++ {
+		v := 100.0 + float64(i%3)
+		if i%12 == 11 {
+			v *= 1.9
+		}
+		seasonal = append(seasonal, v)
+	}
+
+	testCases := []struct {
+		name     string
+		series   Series
+		opts     Options
+		kinds    []string
+		seasonal bool
+	}{
+		{"Steady", monthly("revenue", true, steady, 0), Options{}, nil, false},
+		{"Revenue Spike", monthly("revenue", true, with(steady, 180), 0), Options{}, []string{Spike}, false},
+		{"TQ Drop", monthly("tq", false, with([]float64{0.8, 0.81, 0.79, 0.8, 0.82, 0.8}, 0.45), 5000), Options{MinVolume: 1000}, []string{Drop}, false},
+		{"Traffic Gone", monthly("searches", true, with(steady, 2), 0), Options{}, []string{Disappeared}, false},
+		{"Thin TQ Ignored", monthly("tq", false, with([]float64{0.8, 0.81, 0.79, 0.8, 0.82, 0.8}, 0.45), 50), Options{MinVolume: 1000}, nil, false},
+		{"Too Little History", monthly("revenue", true, []float64{100, 101, 500}, 0), Options{}, nil, false},
+		{"Only Recent", monthly("revenue", true, with(with(steady, 180), steady...), 0), Options{Recent: 3}, nil, false},
+		{"Seasonal December", monthly("revenue", true, seasonal, 0), Options{Season: 12, Recent: 1}, nil, false},
+		// Without the seasonal baseline the second December looks like a spike
+		{"December Without Season", monthly("revenue", true, seasonal, 0), Options{Recent: 1}, []string{Spike}, false},
+		{"Spike Despite Season", monthly("revenue", true, with(seasonal[:23], 400), 0), Options{Season: 12, Recent: 1}, []string{Spike}, true},
+		// From a baseline flat at zero there's no spread to score against
+		{"Back From Zero", monthly("revenue", true, []float64{100, 0, 0, 0, 0, 0, 250}, 0), Options{Recent: 1}, []string{Appeared}, false},
+		{"Still Zero", monthly("revenue", true, []float64{100, 0, 0, 0, 0, 0, 0}, 0), Options{Recent: 1}, nil, false},
+	}
+
+	for _, tc := range testCases {
+		findings := Detect(tc.series, tc.opts)
+		if len(findings) != len(tc.kinds) {
+			t.Errorf("%s: expected %d findings, got %+v", tc.name, len(tc.kinds), findings)
+			continue
+		}
+		for i, f := range findings {
+			if f.Kind != tc.kinds[i] {
+				t.Errorf("%s: expected a %s, got %s", tc.name, tc.kinds[i], f.Kind)
+			}
+			if f.Seasonal != tc.seasonal {
+				t.Errorf("%s: expected seasonal %v, got %v", tc.name, tc.seasonal, f.Seasonal)
+			}
+			if f.Explanation == "" {
+				t.Errorf("%s: expected an explanation, got %+v", tc.name, f)
+			}
+			if f.Kind == Appeared {
+				if f.Score != 0 || f.Change != nil {
+					t.Errorf("%s: expected no score or change from a zero baseline, got %+v", tc.name, f)
+				}
+			} else if f.Score < DefaultThreshold {
+				t.Errorf("%s: expected a score over the threshold, got %+v", tc.name, f)
+			}
+		}
+	}
+}
+
+func TestRank(t *testing.T) {
+	findings := []Finding{{Score: 4}, {Score: 12}, {Score: 6}}
+	Rank(findings)
+	if findings[0].Score != 12 || findings[2].Score != 4 {
+		t.Errorf("Expected findings ranked by score, got %+v", findings)
+	}
+}
+
+func TestBuildSeries(t *testing.T) {
+	months := Months(time.Date(2024, time.January, 15, 0, 0, 0, 0, time.UTC), time.Date(2024, time.May, 1, 0, 0, 0, 0, time.UTC))
+	if len(months) != 4 || months[0].Day() != 1 {
+		t.Fatalf("Expected January to April, got %v", months)
+	}
+
+	acme := Entity{Dimension: "partner", ID: 2, Name: "Acme"}
+	dnc := Entity{Dimension: "partner", ID: 1, Name: "DNC"}
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		ny = time.UTC
+	}
+	// Dates from the database are UTC even when the months aren't
+	localMonths := MonthPeriods(time.Date(2024, time.January, 1, 0, 0, 0, 0, ny), time.Date(2024, time.May, 1, 0, 0, 0, 0, ny))
+	series := BuildSeries("searches", true, localMonths, []Observation{
+		{Entity: acme, Period: months[0], Value: 10},
+		{Entity: acme, Period: months[2], Value: 30},
+		{Entity: dnc, Period: months[1], Value: 5},
+		{Entity: dnc, Period: time.Date(2023, time.December, 1, 0, 0, 0, 0, time.UTC), Value: 99},
+	})
+
+	if len(series) != 2 || series[0].ID != 1 || series[1].ID != 2 {
+		t.Fatalf("Expected DNC then Acme, got %+v", series)
+	}
+	// DNC starts when it first appears; Acme's missing months are zeros
+	if len(series[0].Points) != 3 || series[0].Points[0].Value != 5 || series[0].Points[2].Value != 0 {
+		t.Errorf("Unexpected DNC series: %+v", series[0].Points)
+	}
+	if len(series[1].Points) != 4 || series[1].Points[1].Value != 0 || series[1].Points[2].Value != 30 {
+		t.Errorf("Unexpected Acme series: %+v", series[1].Points)
+	}
+
+	// A rerun report ending the same day as another is a period of its own
+	end := time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC)
+	reports := []Period{{Key: "7", Start: end.AddDate(0, -1, 0)}, {Key: "8", Start: end}, {Key: "9", Start: end}}
+	series = BuildSeries("searches", true, reports, []Observation{
+		{Entity: acme, Key: "7", Period: reports[0].Start, Value: 10},
+		{Entity: acme, Key: "8", Period: end, Value: 20},
+		{Entity: acme, Key: "9", Period: end, Value: 25},
+	})
+	if len(series) != 1 || len(series[0].Points) != 3 || series[0].Points[1].Value != 20 || series[0].Points[2].Value != 25 {
+		t.Errorf("Expected a point for each report, got %+v", series)
+	}
+}
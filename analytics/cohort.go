@@ -0,0 +1,175 @@
+package analytics
+
+import "sort"
+
+// Cohort is the entities that first appeared in the same period, and how
+// many of them, and how much of their revenue, remained in each period after
+type Cohort struct {
+	// Period is the start of the cohort's first period, as YYYY-MM-DD
+	Period string `json:"cohort"`
+	// Size is how many entities first appeared in it
+	Size    int               `json:"size"`
+	Periods []RetentionPeriod `json:"periods"`
+}
+
+// RetentionPeriod is a cohort's activity some periods after it started
+type RetentionPeriod struct {
+	// Offset counts periods from the cohort's first, which is 0
+	Offset int `json:"offset"`
+	// Period is the start of the period, as YYYY-MM-DD; empty on an average
+	// over cohorts
+	Period string `json:"period,omitempty"`
+	// Active is how many of the cohort had activity in the period
+	Active int `json:"active"`
+	// ActiveRetention is Active as a percentage of the cohort's size
+	ActiveRetention float64 `json:"active_retention"`
+	Revenue         float64 `json:"revenue"`
+	// RevenueRetention is Revenue as a percentage of the first period's,
+	// when that wasn't zero. A first period that was only partly active can
+	// make it go over 100.
+	RevenueRetention *float64 `json:"revenue_retention,omitempty"`
+}
+
+// BuildCohorts groups entities by the period of their first activity, an
+// observation with value or volume, and follows each cohort through the
+// remaining periods. Periods must be sorted and are matched by key, as in
+// BuildSeries. Observations of periods no later than the first that aren't
+// among them only count towards when an entity first appeared, so an entity
+// seen earlier starts no cohort. Cohorts come out oldest first.
+func BuildCohorts(periods []Period, observations []Observation) []Cohort {
+	index := make(map[string]int, len(periods))
+	for i, p := range periods {
+		index[p.key()] = i
+	}
+
+	type key struct {
+		dimension string
+		id        int64
+	}
+	// first is each entity's first active period, by position in periods;
+	// -1 is before them
+	first := make(map[key]int)
+	for _, o := range observations {
+		if o.Value == 0 && o.Volume == 0 {
+			continue
+		}
+		pos, ok := index[o.key()]
+		if !ok {
+			if len(periods) == 0 || o.Period.After(periods[0].Start) {
+				continue
+			}
+			pos = -1
+		}
+		k := key{o.Dimension, o.ID}
+		if f, seen := first[k]; !seen || pos < f {
+			first[k] = pos
+		}
+	}
+
+	// cohortOf is each entity's cohort, by position in periods
+	cohortOf := make(map[key]int)
+	sizes := make(map[int]int)
+	for k, pos := range first {
+		if pos >= 0 {
+			cohortOf[k] = pos
+			sizes[pos]++
+		}
+	}
+
+	type cell struct {
+		active  int
+		revenue float64
+	}
+	cells := make(map[[2]int]*cell)
+	for _, o := range observations {
+		if o.Value == 0 && o.Volume == 0 {
+			continue
+		}
+		start, ok := cohortOf[key{o.Dimension, o.ID}]
+		pos, inPeriods := index[o.key()]
+		if !ok || !inPeriods {
+			continue
+		}
+		c := cells[[2]int{start, pos}]
+		if c == nil {
+			c = &cell{}
+			cells[[2]int{start, pos}] = c
+		}
+		c.active++
+		c.revenue += o.Value
+	}
+
+	var starts []int
+	for start := range sizes {
+		starts = append(starts, start)
+	}
+	sort.Ints(starts)
+
+	var cohorts []Cohort
+	for _, start := range starts {
+		cohort := Cohort{Period: periods[start].Start.Format("2006-01-02"), Size: sizes[start]}
+		var initial float64
+		for pos := start; pos < len(periods); pos++ {
+			p := RetentionPeriod{Offset: pos - start, Period: periods[pos].Start.Format("2006-01-02")}
+			if c := cells[[2]int{start, pos}]; c != nil {
+				p.Active, p.Revenue = c.active, round(c.revenue)
+			}
+			if pos == start {
+				initial = p.Revenue
+			}
+			p.ActiveRetention = round(float64(p.Active) * 100 / float64(cohort.Size))
+			if initial != 0 {
+				retention := round(p.Revenue * 100 / initial)
+				p.RevenueRetention = &retention
+			}
+			cohort.Periods = append(cohort.Periods, p)
+		}
+		cohorts = append(cohorts, cohort)
+	}
+	return cohorts
+}
+
+// AverageRetention pools cohorts by offset: at each offset, the active share
+// and revenue retention of all the cohorts that have reached it, weighted by
+// their size and first period's revenue
+func AverageRetention(cohorts []Cohort) []RetentionPeriod {
+	type pool struct {
+		active, size int
+		revenue      float64
+		// retained and initial are the revenue of the cohorts whose first
+		// period had any, now and in that first period
+		retained, initial float64
+	}
+	var pools []pool
+	for _, c := range cohorts {
+		for _, p := range c.Periods {
+			for len(pools) <= p.Offset {
+				pools = append(pools, pool{})
+			}
+			pl := &pools[p.Offset]
+			pl.active += p.Active
+			pl.size += c.Size
+			pl.revenue += p.Revenue
+			if first := c.Periods[0].Revenue; first != 0 {
+				pl.retained += p.Revenue
+				pl.initial += first
+			}
+		}
+	}
+
+	var average []RetentionPeriod
+	for offset, pl := range pools {
+		p := RetentionPeriod{
+			Offset:          offset,
+			Active:          pl.active,
+			ActiveRetention: round(float64(pl.active) * 100 / float64(pl.size)),
+			Revenue:         round(pl.revenue),
+		}
+		if pl.initial != 0 {
+			retention := round(pl.retained * 100 / pl.initial)
+			p.RevenueRetention = &retention
+		}
+		average = append(average, p)
+	}
+	return average
+}
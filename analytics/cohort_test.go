@@ -0,0 +1,91 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBuildCohorts(t *testing.T) {
+	months := MonthPeriods(time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, time.May, 1, 0, 0, 0, 0, time.UTC))
+	seen := func(id int64, month int, revenue float64) Observation {
+		return Observation{
+			Entity: Entity{Dimension: "partner", ID: id},
+			Period: time.Date(2024, time.Month(month), 1, 0, 0, 0, 0, time.UTC),
+			Value:  revenue,
+			Volume: revenue * 10,
+		}
+	}
+	observations := []Observation{
+		// Partner 1 was around before January, so starts no cohort
+		{Entity: Entity{Dimension: "partner", ID: 1}, Period: time.Date(2023, time.December, 1, 0, 0, 0, 0, time.UTC), Value: 5},
+		seen(1, 1, 50),
+		// January's cohort: 2 stays on and off, 3 leaves after a month
+		seen(2, 1, 100), seen(2, 2, 120), seen(2, 4, 90),
+		seen(3, 1, 100),
+		// A row without traffic isn't a start, so 4 joins in February
+		seen(4, 1, 0), seen(4, 2, 40), seen(4, 3, 60),
+	}
+
+	cohorts := BuildCohorts(months, observations)
+	if len(cohorts) != 2 || cohorts[0].Period != "2024-01-01" || cohorts[0].Size != 2 || cohorts[1].Period != "2024-02-01" || cohorts[1].Size != 1 {
+		t.Fatalf("Expected January's two partners and February's one, got %+v", cohorts)
+	}
+
+	january := cohorts[0].Periods
+	if len(january) != 4 || len(cohorts[1].Periods) != 3 {
+		t.Fatalf("Expected each cohort followed to April, got %+v", cohorts)
+	}
+	expected := []struct {
+		active    int
+		retention float64
+		revenue   float64
+	}{{2, 100, 100}, {1, 50, 60}, {0, 0, 0}, {1, 50, 45}}
+	for i, e := range expected {
+		p := january[i]
+		if p.Offset != i || p.Active != e.active || p.ActiveRetention != e.retention || p.RevenueRetention == nil || *p.RevenueRetention != e.revenue {
+			t.Errorf("Expected January's month %d to be %+v, got %+v", i, e, p)
+		}
+	}
+
+	average := AverageRetention(cohorts)
+	if len(average) != 4 {
+		t.Fatalf("Expected four offsets, got %+v", average)
+	}
+	// A month on, one of January's two and February's one remain
+	if a := average[1]; a.Active != 2 || a.ActiveRetention != 66.67 || a.Revenue != 180 || *a.RevenueRetention != 75 {
+		t.Errorf("Unexpected retention a month on: %+v", a)
+	}
+	if a := average[3]; a.Active != 1 || a.ActiveRetention != 50 {
+		t.Errorf("Expected only January's cohort three months on, got %+v", a)
+	}
+}
+
+func TestBuildCohortsReports(t *testing.T) {
+	end := time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC)
+	// Report 8 was rerun as 9, ending the same day; 6 is older than the
+	// periods followed
+	reports := []Period{{Key: "7", Start: end.AddDate(0, -1, 0)}, {Key: "8", Start: end}, {Key: "9", Start: end}}
+	seen := func(id int64, report string, period time.Time, revenue float64) Observation {
+		return Observation{Entity: Entity{Dimension: "partner", ID: id}, Key: report, Period: period, Value: revenue}
+	}
+	observations := []Observation{
+		seen(1, "6", end.AddDate(0, -2, 0), 5),
+		seen(1, "8", end, 10),
+		seen(2, "7", reports[0].Start, 100),
+		seen(2, "8", end, 80), seen(2, "9", end, 90),
+		seen(3, "9", end, 40),
+	}
+
+	cohorts := BuildCohorts(reports, observations)
+	if len(cohorts) != 2 || cohorts[0].Size != 1 || cohorts[1].Size != 1 {
+		t.Fatalf("Expected report 7's partner and report 9's, got %+v", cohorts)
+	}
+	// Each report is counted once, not both under their shared end date
+	first := cohorts[0].Periods
+	if len(first) != 3 || first[1].Active != 1 || first[1].Revenue != 80 || first[2].Revenue != 90 {
+		t.Errorf("Expected report 7's cohort in 8 and 9 separately, got %+v", first)
+	}
+	if cohorts[1].Period != "2024-02-29" || len(cohorts[1].Periods) != 1 {
+		t.Errorf("Expected report 9's cohort to start on its end date, got %+v", cohorts[1])
+	}
+}
@@ -0,0 +1,237 @@
+package analytics
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Forecast models
+const (
+	// HoltWinters is additive Holt-Winters: level, trend and seasonality
+	HoltWinters = "holt_winters"
+	// LinearTrend is a least squares line, used when there's too little
+	// history for seasonality
+	LinearTrend = "linear_trend"
+)
+
+// MinForecastHistory is the fewest points a forecast needs
+const MinForecastHistory = 3
+
+// ForecastLevels are the interval coverages a forecast can give
+var ForecastLevels = []float64{0.8, 0.9, 0.95}
+
+// ForecastOptions tune a forecast
+type ForecastOptions struct {
+	// Season is the number of periods in a seasonal cycle, 12 for months.
+	// Holt-Winters is used when there are at least two cycles of history.
+	Season int
+	// Level is the interval coverage, one of ForecastLevels; 0.8 if 0
+	Level float64
+	// NonNegative clamps projections and intervals at zero, for metrics like
+	// revenue that can't go below it
+	NonNegative bool
+}
+
+// Projection is a forecast value with its interval
+type Projection struct {
+	Value float64 `json:"value"`
+	Lower float64 `json:"lower"`
+	Upper float64 `json:"upper"`
+}
+
+// ForecastResult is a fitted model's projections
+type ForecastResult struct {
+	Model string `json:"model"`
+	// Params are the model's fitted smoothing parameters or coefficients
+	Params map[string]float64 `json:"params"`
+	// Sigma is the standard deviation of the model's errors on the history
+	Sigma       float64      `json:"sigma"`
+	Projections []Projection `json:"projections"`
+}
+
+// Forecast projects values, oldest first, horizon periods ahead
+func Forecast(values []float64, horizon int, opts ForecastOptions) (*ForecastResult, error) {
+	if len(values) < MinForecastHistory {
+		return nil, fmt.Errorf("a forecast needs at least %d periods of history, got %d", MinForecastHistory, len(values))
+	}
+	if horizon < 1 {
+		return nil, fmt.Errorf("the horizon must be at least 1 period")
+	}
+	if opts.Level == 0 {
+		opts.Level = 0.8
+	}
+	z, ok := zScores[opts.Level]
+	if !ok {
+		return nil, fmt.Errorf("the interval level must be one of %v", ForecastLevels)
+	}
+
+	var result *ForecastResult
+	if opts.Season > 1 && len(values) >= 2*opts.Season {
+		result = holtWinters(values, horizon, opts.Season, z)
+	} else {
+		result = linearTrend(values, horizon, opts.Level)
+	}
+	for i := range result.Projections {
+		p := &result.Projections[i]
+		if opts.NonNegative {
+			p.Value, p.Lower, p.Upper = math.Max(p.Value, 0), math.Max(p.Lower, 0), math.Max(p.Upper, 0)
+		}
+		p.Value, p.Lower, p.Upper = round(p.Value), round(p.Lower), round(p.Upper)
+	}
+	result.Sigma = round(result.Sigma)
+	return result, nil
+}
+
+// hwState is Holt-Winters' level, trend and seasonal components
+type hwState struct {
+	level, trend float64
+	seasonal     []float64
+}
+
+// holtWinters fits additive Holt-Winters, picking the smoothing parameters
+// with the least one-step-ahead squared error on a grid
+func holtWinters(values []float64, horizon, season int, z float64) *ForecastResult {
+	grid := []float64{0.1, 0.2, 0.3, 0.4, 0.5, 0.6, 0.7, 0.8, 0.9}
+	best := math.Inf(1)
+	var alpha, beta, gamma float64
+	for _, a := range grid {
+		for _, b := range grid {
+			for _, g := range grid {
+				if sse, _ := fitHoltWinters(values, season, a, b, g); sse < best {
+					best, alpha, beta, gamma = sse, a, b, g
+				}
+			}
+		}
+	}
+	_, state := fitHoltWinters(values, season, alpha, beta, gamma)
+	sigma := math.Sqrt(best / float64(len(values)-season))
+
+	n := len(values)
+	result := &ForecastResult{
+		Model:  HoltWinters,
+		Params: map[string]float64{"alpha": alpha, "beta": beta, "gamma": gamma},
+		Sigma:  sigma,
+	}
+	// The h-step variance grows with each step's smoothed error, plus the
+	// seasonal error once a full cycle has passed
+	variance := 0.0
+	for h := 1; h <= horizon; h++ {
+		if h > 1 {
+			j := float64(h - 1)
+			c := alpha * (1 + j*beta)
+			if (h-1)%season == 0 {
+				c += gamma
+			}
+			variance += c * c
+		}
+		value := state.level + float64(h)*state.trend + state.seasonal[(n+h-1)%season]
+		spread := z * sigma * math.Sqrt(1+variance)
+		result.Projections = append(result.Projections, Projection{Value: value, Lower: value - spread, Upper: value + spread})
+	}
+	return result
+}
+
+// fitHoltWinters runs Holt-Winters over values, returning the sum of squared
+// one-step errors after the first season and the final state. The seasonal
+// slice is indexed by position in the cycle.
+func fitHoltWinters(values []float64, season int, alpha, beta, gamma float64) (float64, hwState) {
+	// Start from the average change between the first two seasons, the first
+	// season's deviations from that trend, and the level the trend reaches
+	// at the end of the first season
+	first, second := mean(values[:season]), mean(values[season:2*season])
+	trend := (second - first) / float64(season)
+	middle := float64(season-1) / 2
+	state := hwState{level: first + trend*middle, trend: trend, seasonal: make([]float64, season)}
+	for i := 0; i < season; i++ {
+		state.seasonal[i] = values[i] - (first + trend*(float64(i)-middle))
+	}
+
+	sse := 0.0
+	for t := season; t < len(values); t++ {
+		s := state.seasonal[t%season]
+		predicted := state.level + state.trend + s
+		sse += (values[t] - predicted) * (values[t] - predicted)
+
+		level := alpha*(values[t]-s) + (1-alpha)*(state.level+state.trend)
+		state.trend = beta*(level-state.level) + (1-beta)*state.trend
+		state.level = level
+		state.seasonal[t%season] = gamma*(values[t]-level) + (1-gamma)*s
+	}
+	return sse, state
+}
+
+// linearTrend fits a least squares line through values and projects it,
+// with prediction intervals from the t distribution
+func linearTrend(values []float64, horizon int, level float64) *ForecastResult {
+	n := float64(len(values))
+	meanX, meanY := (n-1)/2, mean(values)
+	var sxx, sxy float64
+	for i, y := range values {
+		x := float64(i)
+		sxx += (x - meanX) * (x - meanX)
+		sxy += (x - meanX) * (y - meanY)
+	}
+	slope := sxy / sxx
+	intercept := meanY - slope*meanX
+
+	sse := 0.0
+	for i, y := range values {
+		r := y - (intercept + slope*float64(i))
+		sse += r * r
+	}
+	sigma := math.Sqrt(sse / (n - 2))
+	t := tQuantile(level, len(values)-2)
+
+	result := &ForecastResult{
+		Model:  LinearTrend,
+		Params: map[string]float64{"intercept": round(intercept), "slope": round(slope)},
+		Sigma:  sigma,
+	}
+	for h := 1; h <= horizon; h++ {
+		x := n - 1 + float64(h)
+		value := intercept + slope*x
+		spread := t * sigma * math.Sqrt(1+1/n+(x-meanX)*(x-meanX)/sxx)
+		result.Projections = append(result.Projections, Projection{Value: value, Lower: value - spread, Upper: value + spread})
+	}
+	return result
+}
+
+// zScores are the two-sided normal quantiles for each interval level
+var zScores = map[float64]float64{0.8: 1.2816, 0.9: 1.6449, 0.95: 1.96}
+
+// tTable holds two-sided t quantiles by degrees of freedom for each level
+var tTable = map[float64]map[int]float64{
+	0.8:  {1: 3.078, 2: 1.886, 3: 1.638, 4: 1.533, 5: 1.476, 6: 1.440, 7: 1.415, 8: 1.397, 9: 1.383, 10: 1.372, 15: 1.341, 20: 1.325, 30: 1.310},
+	0.9:  {1: 6.314, 2: 2.920, 3: 2.353, 4: 2.132, 5: 2.015, 6: 1.943, 7: 1.895, 8: 1.860, 9: 1.833, 10: 1.812, 15: 1.753, 20: 1.725, 30: 1.697},
+	0.95: {1: 12.706, 2: 4.303, 3: 3.182, 4: 2.776, 5: 2.571, 6: 2.447, 7: 2.365, 8: 2.306, 9: 2.262, 10: 2.228, 15: 2.131, 20: 2.086, 30: 2.042},
+}
+
+// tQuantile returns the t quantile for the level, using the nearest tabled
+// degrees of freedom at or below df so intervals err on the wide side, and
+// the normal quantile past the table
+func tQuantile(level float64, df int) float64 {
+	if df > 30 {
+		return zScores[level]
+	}
+	var dfs []int
+	for d := range tTable[level] {
+		dfs = append(dfs, d)
+	}
+	sort.Ints(dfs)
+	q := tTable[level][dfs[0]]
+	for _, d := range dfs {
+		if d <= df {
+			q = tTable[level][d]
+		}
+	}
+	return q
+}
+
+func mean(values []float64) float64 {
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
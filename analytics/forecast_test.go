@@ -0,0 +1,99 @@
+package analytics
+
+import (
+	"math"
+	"testing"
+)
+
+func TestForecast(t *testing.T) {
+	// Three years of revenue growing 2 a month with a December bump
+	var seasonal []float64
+	for i := 0; i < 36; i++ {
+		v := 100 + 2*float64(i) + float64(i%2)
+		if i%12 == 11 {
+			v += 50
+		}
+		seasonal = append(seasonal, v)
+	}
+
+	testCases := []struct {
+		name   string
+		values []float64
+		opts   ForecastOptions
+		model  string
+		// expected are the projections' values, within tolerance
+		expected  []float64
+		tolerance float64
+	}{
+		{"Straight Line", []float64{10, 12, 14, 16, 18}, ForecastOptions{Season: 12}, LinearTrend, []float64{20, 22}, 0.01},
+		{"Noisy Line", []float64{10, 13, 13, 17, 17, 21}, ForecastOptions{}, LinearTrend, []float64{22.2}, 0.5},
+		{"Seasonal", seasonal, ForecastOptions{Season: 12}, HoltWinters, []float64{172, 175, 176, 179, 180, 183, 184, 187, 188, 191, 192, 245}, 0.5},
+		{"Falling To Zero", []float64{30, 20, 10}, ForecastOptions{NonNegative: true}, LinearTrend, []float64{0, 0}, 0.01},
+	}
+
+	for _, tc := range testCases {
+		f, err := Forecast(tc.values, len(tc.expected), tc.opts)
+		if err != nil {
+			t.Errorf("%s: failed to forecast: %v", tc.name, err)
+			continue
+		}
+		if f.Model != tc.model {
+			t.Errorf("%s: expected %s, got %s", tc.name, tc.model, f.Model)
+		}
+		for i, p := range f.Projections {
+			if math.Abs(p.Value-tc.expected[i]) > tc.tolerance {
+				t.Errorf("%s: expected projection %d near %v, got %v", tc.name, i+1, tc.expected[i], p.Value)
+			}
+			if p.Lower > p.Value || p.Upper < p.Value {
+				t.Errorf("%s: expected projection %d inside its interval, got %+v", tc.name, i+1, p)
+			}
+			if tc.opts.NonNegative && p.Lower < 0 {
+				t.Errorf("%s: expected no negative bound, got %+v", tc.name, p)
+			}
+		}
+	}
+}
+
+func TestForecastIntervals(t *testing.T) {
+	values := []float64{10, 13, 13, 17, 17, 21, 20, 24}
+	width := func(level float64) []float64 {
+		f, err := Forecast(values, 3, ForecastOptions{Level: level})
+		if err != nil {
+			t.Fatalf("Failed to forecast at %v: %v", level, err)
+		}
+		var widths []float64
+		for _, p := range f.Projections {
+			widths = append(widths, p.Upper-p.Lower)
+		}
+		return widths
+	}
+
+	narrow, wide := width(0.8), width(0.95)
+	for i := range narrow {
+		if wide[i] <= narrow[i] {
+			t.Errorf("Expected 95%% intervals wider than 80%%, got %v and %v", wide, narrow)
+		}
+		if i > 0 && narrow[i] <= narrow[i-1] {
+			t.Errorf("Expected intervals to widen further out, got %v", narrow)
+		}
+	}
+}
+
+func TestForecastErrors(t *testing.T) {
+	testCases := []struct {
+		name    string
+		values  []float64
+		horizon int
+		opts    ForecastOptions
+	}{
+		{"Too Little History", []float64{1, 2}, 1, ForecastOptions{}},
+		{"No Horizon", []float64{1, 2, 3}, 0, ForecastOptions{}},
+		{"Bad Level", []float64{1, 2, 3}, 1, ForecastOptions{Level: 0.5}},
+	}
+
+	for _, tc := range testCases {
+		if _, err := Forecast(tc.values, tc.horizon, tc.opts); err == nil {
+			t.Errorf("%s: expected an error", tc.name)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package analytics
+
+import (
+	"sort"
+	"time"
+)
+
+// Period is one step of a series, such as a month or a report
+type Period struct {
+	// Key tells periods apart when their dates can repeat, as two reports
+	// ending on the same day do; empty means the period is known by its date
+	Key string
+	// Start is the date the period is reported as
+	Start time.Time
+}
+
+// key is what observations are matched to the period by
+func (p Period) key() string {
+	if p.Key != "" {
+		return p.Key
+	}
+	return p.Start.Format("2006-01-02")
+}
+
+// Observation is an entity's value of a metric in one period, as read from a
+// query's rows
+type Observation struct {
+	Entity
+	// Key is the Key of the period observed, if it has one
+	Key    string
+	Period time.Time
+	Value  float64
+	Volume float64
+}
+
+// key is the key of the period observed
+func (o Observation) key() string {
+	return Period{Key: o.Key, Start: o.Period}.key()
+}
+
+// BuildSeries groups observations into one series per entity over periods,
+// which must be sorted. Periods are matched by key, or by calendar date
+// whatever their time zone, since dates read from the database come back as
+// UTC. Each series starts at the entity's first observation; periods after
+// that without one are filled with zeros, so traffic that stops shows up as a
+// drop rather than a gap. Series come out ordered by entity ID.
+func BuildSeries(metric string, additive bool, periods []Period, observations []Observation) []Series {
+	index := make(map[string]int, len(periods))
+	for i, p := range periods {
+		index[p.key()] = i
+	}
+
+	type key struct {
+		dimension string
+		id        int64
+	}
+	values := make(map[key][]*Observation)
+	entities := make(map[key]Entity)
+	for i := range observations {
+		o := &observations[i]
+		pos, ok := index[o.key()]
+		if !ok {
+			continue
+		}
+		k := key{o.Dimension, o.ID}
+		if values[k] == nil {
+			values[k] = make([]*Observation, len(periods))
+			entities[k] = o.Entity
+		}
+		values[k][pos] = o
+	}
+
+	var series []Series
+	for k, byPeriod := range values {
+		s := Series{Entity: entities[k], Metric: metric, Additive: additive}
+		started := false
+		for i, o := range byPeriod {
+			if o == nil {
+				if started {
+					s.Points = append(s.Points, Point{Period: periods[i].Start})
+				}
+				continue
+			}
+			started = true
+			s.Points = append(s.Points, Point{Period: periods[i].Start, Value: o.Value, Volume: o.Volume})
+		}
+		series = append(series, s)
+	}
+	sort.Slice(series, func(i, j int) bool {
+		if series[i].Dimension != series[j].Dimension {
+			return series[i].Dimension < series[j].Dimension
+		}
+		return series[i].ID < series[j].ID
+	})
+	return series
+}
+
+// MonthPeriods returns Months as periods known by their dates
+func MonthPeriods(start, end time.Time) []Period {
+	var periods []Period
+	for _, m := range Months(start, end) {
+		periods = append(periods, Period{Start: m})
+	}
+	return periods
+}
+
+// Months returns the first day of every month from start up to, but not
+// including, end
+func Months(start, end time.Time) []time.Time {
+	var months []time.Time
+	m := time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, start.Location())
+	for m.Before(end) {
+		months = append(months, m)
+		m = m.AddDate(0, 1, 0)
+	}
+	return months
+}
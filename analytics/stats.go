@@ -0,0 +1,37 @@
+// Package analytics finds anomalies in metric series using robust statistics
+// computed in Go over query results, so one odd month can't hide another the
+// way it would with a mean and standard deviation
+package analytics
+
+import (
+	"math"
+	"sort"
+)
+
+// madScale turns a median absolute deviation into an estimate of the standard
+// deviation for normally distributed data
+const madScale = 1.4826
+
+// Median returns the median of values, or NaN if there are none
+func Median(values []float64) float64 {
+	if len(values) == 0 {
+		return math.NaN()
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 1 {
+		return sorted[mid]
+	}
+	return (sorted[mid-1] + sorted[mid]) / 2
+}
+
+// MAD returns the median absolute deviation of values from their median
+func MAD(values []float64) float64 {
+	median := Median(values)
+	deviations := make([]float64, len(values))
+	for i, v := range values {
+		deviations[i] = math.Abs(v - median)
+	}
+	return Median(deviations)
+}
@@ -1,63 +1,356 @@
 package config
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/dnc-data-mcp/secrets"
 	"github.com/spf13/viper"
 )
 
+// Connection modes, selecting how the database is reached
+const (
+	ModeSSH    = "ssh"
+	ModeDirect = "direct"
+)
+
+// DefaultDatasource is the datasource used when a config has several and
+// default_datasource doesn't pick one
+const DefaultDatasource = "ro-traffic"
+
+// Config holds the settings for every datasource. Connection and Default are
+// the connection mode and SSH settings each datasource uses unless it sets its
+// own.
 type Config struct {
-	Default struct {
-		SSHHost       string `mapstructure:"ssh_host"`
-		SSHPort       int    `mapstructure:"ssh_port"`
-		SSHUser       string `mapstructure:"ssh_user"`
-		SSHPrivateKey string `mapstructure:"ssh_private_key"`
-	} `mapstructure:"default"`
-	Database struct {
-		ROTraffic struct {
-			Server   string `mapstructure:"server"`
-			Port     int    `mapstructure:"port"`
-			Username string `mapstructure:"username"`
-			Password string `mapstructure:"password"`
-			Database string `mapstructure:"database"`
-			SSLMode  string `mapstructure:"sslmode"`
-		} `mapstructure:"ro-traffic"`
-	} `mapstructure:"database"`
-}
-
-func LoadConfig(configPath string) (*Config, error) {
-	if configPath == "" {
-		homeDir, err := os.UserHomeDir()
-		if err != nil {
-			return nil, fmt.Errorf("error getting home directory: %v", err)
-		}
-		configPath = filepath.Join(homeDir, ".ssh", "dnc_db_info")
+	Connection ConnectionConfig `mapstructure:"connection"`
+	Default    SSHConfig        `mapstructure:"default"`
+	// Database maps datasource names, such as ro-traffic, to their settings
+	Database map[string]Datasource `mapstructure:"database"`
+	// DefaultDatasource names the datasource for queries that don't pick one
+	DefaultDatasource string `mapstructure:"default_datasource"`
+	// Timezone is the business timezone relative time ranges such as "last
+	// month" are worked out in, e.g. "America/New_York"; defaults to UTC
+	Timezone string `mapstructure:"timezone"`
+}
+
+// DatabaseConfig holds the connection settings for one database. The password
+// can be given directly or come from one of the other password sources; at
+// most one should be set.
+type DatabaseConfig struct {
+	Server   string `mapstructure:"server"`
+	Port     int    `mapstructure:"port"`
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+	Database string `mapstructure:"database"`
+	SSLMode  string `mapstructure:"sslmode"`
+
+	// PasswordEnv names an environment variable holding the password
+	PasswordEnv string `mapstructure:"password_env"`
+	// PasswordFile is a file containing only the password
+	PasswordFile string `mapstructure:"password_file"`
+	// PasswordCommand is a shell command that prints the password, e.g. "pass show db/ro-traffic"
+	PasswordCommand string `mapstructure:"password_command"`
+	// UsePgPass looks the password up in $PGPASSFILE or ~/.pgpass
+	UsePgPass bool `mapstructure:"use_pgpass"`
+
+	// ApplicationName identifies our sessions in pg_stat_activity; defaults to dnc-data-mcp
+	ApplicationName string `mapstructure:"application_name"`
+	// ConnectTimeout limits how long connecting may take, e.g. "10s"; unset waits indefinitely
+	ConnectTimeout time.Duration `mapstructure:"connect_timeout"`
+	// SSLRootCert is the CA certificate used with sslmode verify-ca or verify-full
+	SSLRootCert string `mapstructure:"sslrootcert"`
+	// TargetSessionAttrs requires a session kind, e.g. "read-only" or "primary"
+	TargetSessionAttrs string `mapstructure:"target_session_attrs"`
+	// SearchPath sets the schema search path, e.g. "yer_analysis, public"
+	SearchPath string `mapstructure:"search_path"`
+
+	// MaxOpenConns caps open connections; 0 means the default of 10
+	MaxOpenConns int `mapstructure:"max_open_conns"`
+	// MaxIdleConns is accepted for older configs but has no effect: the pgx
+	// pool keeps idle connections until ConnMaxIdleTime closes them
+	MaxIdleConns int `mapstructure:"max_idle_conns"`
+	// ConnMaxLifetime closes connections older than this, e.g. "30m"
+	ConnMaxLifetime time.Duration `mapstructure:"conn_max_lifetime"`
+	// ConnMaxIdleTime closes connections idle for longer than this, e.g. "5m"
+	ConnMaxIdleTime time.Duration `mapstructure:"conn_max_idle_time"`
+	// HealthCheckInterval is how often the pool is pinged in the background; defaults to 30s
+	HealthCheckInterval time.Duration `mapstructure:"health_check_interval"`
+	// ConnectRetryTimeout is how long to keep retrying the first connection
+	// while the tunnel comes up; defaults to 15s
+	ConnectRetryTimeout time.Duration `mapstructure:"connect_retry_timeout"`
+}
+
+// PasswordProvider returns where the password comes from, or nil if no
+// password is configured at all
+func (d DatabaseConfig) PasswordProvider() secrets.Provider {
+	switch {
+	case d.Password != "":
+		return secrets.Static(d.Password)
+	case d.PasswordEnv != "":
+		return secrets.Env{Var: d.PasswordEnv}
+	case d.PasswordFile != "":
+		return secrets.File{Path: d.PasswordFile}
+	case d.PasswordCommand != "":
+		return secrets.Command{Command: d.PasswordCommand}
+	case d.UsePgPass:
+		// Match on the real server, not wherever a tunnel later points us
+		return secrets.PgPass{Host: d.Server, Port: d.Port, Database: d.Database, User: d.Username}
+	default:
+		return nil
+	}
+}
+
+// passwordSources lists which password sources are set, for validation
+func (d DatabaseConfig) passwordSources() []string {
+	var sources []string
+	if d.Password != "" {
+		sources = append(sources, "password")
+	}
+	if d.PasswordEnv != "" {
+		sources = append(sources, "password_env")
+	}
+	if d.PasswordFile != "" {
+		sources = append(sources, "password_file")
+	}
+	if d.PasswordCommand != "" {
+		sources = append(sources, "password_command")
+	}
+	if d.UsePgPass {
+		sources = append(sources, "use_pgpass")
+	}
+	return sources
+}
+
+// ConnectionConfig selects how the database is reached. Mode defaults to ssh;
+// direct connects straight to the database server with no tunnel.
+type ConnectionConfig struct {
+	Mode string `mapstructure:"mode"`
+}
+
+// SSHConfig holds the bastion the tunnel connects through. JumpHosts, when set,
+// are dialed in order before the bastion, the same way OpenSSH ProxyJump works.
+type SSHConfig struct {
+	SSHHost       string     `mapstructure:"ssh_host"`
+	SSHPort       int        `mapstructure:"ssh_port"`
+	SSHUser       string     `mapstructure:"ssh_user"`
+	SSHPrivateKey string     `mapstructure:"ssh_private_key"`
+	SSHKnownHosts string     `mapstructure:"ssh_known_hosts"`
+	SSHHostKey    string     `mapstructure:"ssh_host_key"`
+	SSHConfigFile string     `mapstructure:"ssh_config_file"`
+	JumpHosts     []JumpHost `mapstructure:"jump_hosts"`
+	// SSHMaxConns limits concurrently forwarded connections; 0 uses the default
+	SSHMaxConns int `mapstructure:"ssh_max_conns"`
+	// SSHDrainTimeout is how long shutdown waits for in-flight connections
+	SSHDrainTimeout time.Duration `mapstructure:"ssh_drain_timeout"`
+	// SSHLocalAddr is where the tunnel listens; defaults to localhost:5433
+	SSHLocalAddr string `mapstructure:"ssh_local_addr"`
+}
+
+// JumpHost is a single SSH hop. Host may be a Host alias from the file named by
+// SSHConfig.SSHConfigFile, in which case unset fields are filled in from there.
+// HostKey is either a SHA256 fingerprint or an authorized_keys style public key.
+type JumpHost struct {
+	Host       string `mapstructure:"host"`
+	Port       int    `mapstructure:"port"`
+	User       string `mapstructure:"user"`
+	PrivateKey string `mapstructure:"private_key"`
+	KnownHosts string `mapstructure:"known_hosts"`
+	HostKey    string `mapstructure:"host_key"`
+}
+
+// Hops returns the full chain of SSH hops, ending with the bastion itself
+func (s SSHConfig) Hops() []JumpHost {
+	hops := make([]JumpHost, 0, len(s.JumpHosts)+1)
+	hops = append(hops, s.JumpHosts...)
+	return append(hops, JumpHost{
+		Host:       s.SSHHost,
+		Port:       s.SSHPort,
+		User:       s.SSHUser,
+		PrivateKey: s.SSHPrivateKey,
+		KnownHosts: s.SSHKnownHosts,
+		HostKey:    s.SSHHostKey,
+	})
+}
+
+// DefaultConfigPath returns the config file used when none is given
+func DefaultConfigPath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("error getting home directory: %v", err)
+	}
+	return filepath.Join(homeDir, ".ssh", "dnc_db_info"), nil
+}
+
+// LoadConfig reads the config files with ReadConfig, validates the result and
+// resolves secrets. An invalid config returns a *ValidationError listing every
+// problem.
+func LoadConfig(paths ...string) (*Config, error) {
+	config, err := ReadConfig(paths...)
+	if err != nil {
+		return nil, err
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	if err := config.ResolveSecrets(context.Background()); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// ReadConfig reads the config files at paths and layers them in order, so later
+// files override earlier ones. An empty path means DefaultConfigPath. Each file
+// may have a local override next to it, named like dnc_db_info.local or
+// config.local.yaml, which is merged right after it when present. DNC_MCP_*
+// environment variables override every file.
+//
+// The file format comes from the extension (json, yaml, toml, ...); files
+// without a recognized extension are read as JSON.
+func ReadConfig(paths ...string) (*Config, error) {
+	if len(paths) == 0 {
+		paths = []string{""}
 	}
 
-	viper.SetConfigFile(configPath)
-	viper.SetConfigType("json")
+	// Use our own viper instance so concurrent loads don't share state
+	v := viper.New()
+	for _, configPath := range paths {
+		if configPath == "" {
+			var err error
+			configPath, err = DefaultConfigPath()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if err := mergeConfigFile(v, configPath); err != nil {
+			return nil, err
+		}
+
+		localPath := localOverridePath(configPath)
+		if _, err := os.Stat(localPath); err == nil {
+			if err := mergeConfigFile(v, localPath); err != nil {
+				return nil, err
+			}
+		}
+	}
 
-	if err := viper.ReadInConfig(); err != nil {
-		return nil, fmt.Errorf("error reading config file: %v", err)
+	if err := bindEnv(v); err != nil {
+		return nil, fmt.Errorf("error binding environment variables: %v", err)
 	}
 
 	var config Config
-	if err := viper.Unmarshal(&config); err != nil {
+	if err := v.Unmarshal(&config, viper.DecodeHook(decodeHook())); err != nil {
 		return nil, fmt.Errorf("error unmarshaling config: %v", err)
 	}
 
 	return &config, nil
 }
 
-func (c *Config) GetDSN() string {
-	return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
-		c.Database.ROTraffic.Server,
-		c.Database.ROTraffic.Port,
-		c.Database.ROTraffic.Username,
-		c.Database.ROTraffic.Password,
-		c.Database.ROTraffic.Database,
-		c.Database.ROTraffic.SSLMode,
-	)
+// mergeConfigFile merges one config file into v
+func mergeConfigFile(v *viper.Viper, configPath string) error {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("error reading config file: %v", err)
+	}
+
+	v.SetConfigType(configType(configPath))
+	if err := v.MergeConfig(bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("error reading config file %s: %v", configPath, err)
+	}
+	return nil
+}
+
+// configType returns the viper config type for a file, from its extension
+func configType(configPath string) string {
+	ext := strings.TrimPrefix(filepath.Ext(configPath), ".")
+	for _, supported := range viper.SupportedExts {
+		if ext == supported {
+			return ext
+		}
+	}
+	return "json"
+}
+
+// localOverridePath returns the local override file for a config file:
+// config.yaml -> config.local.yaml, dnc_db_info -> dnc_db_info.local
+func localOverridePath(configPath string) string {
+	ext := filepath.Ext(configPath)
+	if configType(configPath) != strings.TrimPrefix(ext, ".") {
+		return configPath + ".local"
+	}
+	return strings.TrimSuffix(configPath, ext) + ".local" + ext
+}
+
+// ResolveSecrets fetches each datasource's password from its configured
+// source and stores it in Password, so the rest of the program only ever looks
+// there
+func (c *Config) ResolveSecrets(ctx context.Context) error {
+	for _, name := range c.DatasourceNames() {
+		ds := c.Database[name]
+
+		// All hosts share a password; pgpass is matched on the first
+		d := ds.DatabaseConfig
+		first := ds.AllHosts()[0]
+		d.Server, d.Port = first.Server, first.Port
+
+		provider := d.PasswordProvider()
+		if provider == nil {
+			continue
+		}
+		password, err := provider.Secret(ctx)
+		if err != nil {
+			return fmt.Errorf("error getting %s database password from %s: %v", name, provider.Name(), err)
+		}
+		ds.Password = password
+		c.Database[name] = ds
+	}
+	return nil
+}
+
+// Redacted returns a copy of the config with secrets masked, safe to log
+func (c *Config) Redacted() *Config {
+	redacted := *c
+	redacted.Database = make(map[string]Datasource, len(c.Database))
+	for name, ds := range c.Database {
+		ds.Password = secrets.Mask(ds.Password)
+		redacted.Database[name] = ds
+	}
+	return &redacted
+}
+
+// ExpandPath expands a leading ~ to the user's home directory
+func ExpandPath(p string) string {
+	if !strings.HasPrefix(p, "~") {
+		return p
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return p
+	}
+	return filepath.Join(homeDir, p[1:])
+}
+
+// Location returns the business timezone, UTC if none is set
+func (c *Config) Location() (*time.Location, error) {
+	if c.Timezone == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load timezone %q: %v", c.Timezone, err)
+	}
+	return loc, nil
+}
+
+// ConnectionMode returns the configured connection mode, defaulting to ssh
+func (c *Config) ConnectionMode() string {
+	if c.Connection.Mode == "" {
+		return ModeSSH
+	}
+	return c.Connection.Mode
 }
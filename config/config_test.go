@@ -0,0 +1,228 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeFile writes content to name in dir and returns the path
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write %s: %v", name, err)
+	}
+	return path
+}
+
+const baseJSON = `{
+  "default": {
+    "ssh_host": "bastion.example.com",
+    "ssh_port": 22,
+    "ssh_user": "me",
+    "ssh_private_key": "~/.ssh/id_ed25519"
+  },
+  "database": {
+    "ro-traffic": {
+      "server": "db.internal",
+      "port": 5432,
+      "username": "reader",
+      "password": "secret",
+      "database": "traffic",
+      "sslmode": "require"
+    }
+  }
+}`
+
+func TestReadConfigFormats(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{"JSON without extension", "dnc_db_info", baseJSON},
+		{"JSON", "config.json", baseJSON},
+		{"YAML", "config.yaml", `
+default:
+  ssh_host: bastion.example.com
+  ssh_port: 22
+database:
+  ro-traffic:
+    server: db.internal
+    port: 5432
+`},
+		{"TOML", "config.toml", `
+[default]
+ssh_host = "bastion.example.com"
+ssh_port = 22
+
+[database.ro-traffic]
+server = "db.internal"
+port = 5432
+`},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			path := writeFile(t, t.TempDir(), tc.file, tc.content)
+
+			cfg, err := ReadConfig(path)
+			if err != nil {
+				t.Fatalf("Failed to load config: %v", err)
+			}
+			if cfg.Default.SSHHost != "bastion.example.com" || cfg.Default.SSHPort != 22 {
+				t.Errorf("Unexpected SSH settings: %+v", cfg.Default)
+			}
+			if cfg.Database["ro-traffic"].Server != "db.internal" || cfg.Database["ro-traffic"].Port != 5432 {
+				t.Errorf("Unexpected database settings: %+v", cfg.Database["ro-traffic"])
+			}
+		})
+	}
+}
+
+func TestReadConfigLayers(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+
+	base := writeFile(t, dir, "base.json", baseJSON)
+	writeFile(t, dir, "base.local.json", `{"default": {"ssh_user": "local-me"}}`)
+	override := writeFile(t, dir, "override.yaml", `
+default:
+  ssh_drain_timeout: 3s
+  jump_hosts:
+    - host: corp-bastion
+      user: me
+database:
+  ro-traffic:
+    port: 6432
+`)
+
+	cfg, err := ReadConfig(base, override)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	// From the base file
+	if cfg.Default.SSHHost != "bastion.example.com" || cfg.Database["ro-traffic"].Username != "reader" {
+		t.Errorf("Base settings were lost: %+v", cfg)
+	}
+	// From the base file's local override
+	if cfg.Default.SSHUser != "local-me" {
+		t.Errorf("Expected ssh_user from local override, got %q", cfg.Default.SSHUser)
+	}
+	// From the second layer
+	if cfg.Database["ro-traffic"].Port != 6432 {
+		t.Errorf("Expected port 6432 from override, got %d", cfg.Database["ro-traffic"].Port)
+	}
+	if cfg.Default.SSHDrainTimeout != 3*time.Second {
+		t.Errorf("Expected 3s drain timeout, got %v", cfg.Default.SSHDrainTimeout)
+	}
+	if len(cfg.Default.JumpHosts) != 1 || cfg.Default.JumpHosts[0].Host != "corp-bastion" {
+		t.Errorf("Unexpected jump hosts: %+v", cfg.Default.JumpHosts)
+	}
+}
+
+func TestReadConfigMissingFile(t *testing.T) {
+	t.Parallel()
+	if _, err := ReadConfig(filepath.Join(t.TempDir(), "nope.json")); err == nil {
+		t.Error("Expected an error for a missing config file")
+	}
+}
+
+// TestReadConfigEnv can't run in parallel since it sets environment variables
+func TestReadConfigEnv(t *testing.T) {
+	path := writeFile(t, t.TempDir(), "config.json", baseJSON)
+
+	t.Setenv("DNC_MCP_DATABASE_RO_TRAFFIC_SERVER", "env-db.internal")
+	t.Setenv("DNC_MCP_DATABASE_RO_TRAFFIC_PORT", "7432")
+	t.Setenv("DNC_MCP_CONNECTION_MODE", "direct")
+	t.Setenv("DNC_MCP_DEFAULT_JUMP_HOSTS", `[{"host": "corp", "port": 2222}]`)
+
+	cfg, err := ReadConfig(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	if cfg.Database["ro-traffic"].Server != "env-db.internal" || cfg.Database["ro-traffic"].Port != 7432 {
+		t.Errorf("Environment did not override database: %+v", cfg.Database["ro-traffic"])
+	}
+	if cfg.ConnectionMode() != ModeDirect {
+		t.Errorf("Expected direct mode from environment, got %q", cfg.ConnectionMode())
+	}
+	if len(cfg.Default.JumpHosts) != 1 || cfg.Default.JumpHosts[0].Port != 2222 {
+		t.Errorf("Unexpected jump hosts from environment: %+v", cfg.Default.JumpHosts)
+	}
+	// Untouched fields still come from the file
+	if cfg.Database["ro-traffic"].Username != "reader" {
+		t.Errorf("Expected username from file, got %q", cfg.Database["ro-traffic"].Username)
+	}
+}
+
+func TestEnvName(t *testing.T) {
+	t.Parallel()
+	if got := EnvName("database.ro-traffic.password"); got != "DNC_MCP_DATABASE_RO_TRAFFIC_PASSWORD" {
+		t.Errorf("Unexpected env name: %s", got)
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	t.Parallel()
+	cfg := &Config{Database: map[string]Datasource{
+		"ro-traffic": {DatabaseConfig: DatabaseConfig{Password: "hunter2"}},
+	}}
+
+	redacted := cfg.Redacted()
+	if redacted.Database["ro-traffic"].Password == "hunter2" {
+		t.Error("Expected the password to be masked")
+	}
+	if cfg.Database["ro-traffic"].Password != "hunter2" {
+		t.Error("Redacted modified the original config")
+	}
+}
+
+func TestDatasource(t *testing.T) {
+	t.Parallel()
+	cfg := &Config{
+		Connection: ConnectionConfig{Mode: ModeSSH},
+		Default:    SSHConfig{SSHHost: "bastion.example.com"},
+		Database: map[string]Datasource{
+			"ro-traffic": {DatabaseConfig: DatabaseConfig{Server: "traffic.internal"}},
+			"billing": {
+				DatabaseConfig: DatabaseConfig{Server: "billing.example.com"},
+				Connection:     &ConnectionConfig{Mode: ModeDirect},
+			},
+		},
+	}
+
+	// With several datasources and no default_datasource, ro-traffic is used
+	ds, err := cfg.Datasource("")
+	if err != nil {
+		t.Fatalf("Failed to get default datasource: %v", err)
+	}
+	if ds.Name != "ro-traffic" || ds.Mode() != ModeSSH || ds.SSHSettings().SSHHost != "bastion.example.com" {
+		t.Errorf("Unexpected default datasource: %+v", ds)
+	}
+
+	ds, err = cfg.Datasource("billing")
+	if err != nil {
+		t.Fatalf("Failed to get billing datasource: %v", err)
+	}
+	if ds.Mode() != ModeDirect || ds.Server != "billing.example.com" {
+		t.Errorf("Unexpected billing datasource: %+v", ds)
+	}
+
+	cfg.DefaultDatasource = "billing"
+	if name := cfg.DefaultDatasourceName(); name != "billing" {
+		t.Errorf("Expected default_datasource to win, got %q", name)
+	}
+
+	if _, err := cfg.Datasource("nope"); err == nil {
+		t.Error("Expected an error for an unknown datasource")
+	}
+}
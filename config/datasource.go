@@ -0,0 +1,122 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+)
+
+// Datasource is a named database along with how to reach it. Connection and SSH
+// are optional; when unset the top-level connection and default settings apply.
+type Datasource struct {
+	// Name is filled in from the datasource's key by Config.Datasource
+	Name           string `mapstructure:"-"`
+	DatabaseConfig `mapstructure:",squash"`
+
+	Connection *ConnectionConfig `mapstructure:"connection"`
+	SSH        *SSHConfig        `mapstructure:"ssh"`
+
+	// Hosts lists interchangeable servers with the same data, such as a
+	// primary reporting replica and a secondary. Queries go to the healthiest
+	// one with the least replication lag. When empty, server and port are used.
+	Hosts []DatabaseHost `mapstructure:"hosts"`
+}
+
+// DatabaseHost is one server of a datasource with several hosts
+type DatabaseHost struct {
+	Server string `mapstructure:"server"`
+	// Port defaults to the datasource's port
+	Port int `mapstructure:"port"`
+}
+
+// String returns the host as server:port
+func (h DatabaseHost) String() string {
+	return net.JoinHostPort(h.Server, strconv.Itoa(h.Port))
+}
+
+// Mode returns the datasource's connection mode, defaulting to ssh
+func (d Datasource) Mode() string {
+	if d.Connection == nil || d.Connection.Mode == "" {
+		return ModeSSH
+	}
+	return d.Connection.Mode
+}
+
+// SSHSettings returns the SSH settings for the datasource's tunnel
+func (d Datasource) SSHSettings() SSHConfig {
+	if d.SSH == nil {
+		return SSHConfig{}
+	}
+	return *d.SSH
+}
+
+// AllHosts returns the servers the datasource can use, in preference order
+func (d Datasource) AllHosts() []DatabaseHost {
+	if len(d.Hosts) == 0 {
+		return []DatabaseHost{{Server: d.Server, Port: d.Port}}
+	}
+	hosts := make([]DatabaseHost, len(d.Hosts))
+	for i, h := range d.Hosts {
+		if h.Port == 0 {
+			h.Port = d.Port
+		}
+		hosts[i] = h
+	}
+	return hosts
+}
+
+// WithEndpoint returns a copy of the datasource with the database host and port
+// replaced, leaving the original untouched for the tunnel
+func (d Datasource) WithEndpoint(host string, port int) Datasource {
+	d.Server = host
+	d.Port = port
+	return d
+}
+
+// DatasourceNames returns the configured datasource names in sorted order
+func (c *Config) DatasourceNames() []string {
+	names := make([]string, 0, len(c.Database))
+	for name := range c.Database {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DefaultDatasourceName returns the datasource used when a query doesn't name
+// one: default_datasource if set, the only datasource if there is just one,
+// and otherwise ro-traffic
+func (c *Config) DefaultDatasourceName() string {
+	if c.DefaultDatasource != "" {
+		return c.DefaultDatasource
+	}
+	if len(c.Database) == 1 {
+		return c.DatasourceNames()[0]
+	}
+	return DefaultDatasource
+}
+
+// Datasource returns the named datasource with the top-level connection and
+// SSH settings filled in where it doesn't set its own. An empty name means the
+// default datasource.
+func (c *Config) Datasource(name string) (Datasource, error) {
+	if name == "" {
+		name = c.DefaultDatasourceName()
+	}
+	ds, ok := c.Database[name]
+	if !ok {
+		return Datasource{}, fmt.Errorf("unknown datasource: %q", name)
+	}
+
+	ds.Name = name
+	if ds.Connection == nil || ds.Connection.Mode == "" {
+		connection := c.Connection
+		ds.Connection = &connection
+	}
+	if ds.SSH == nil {
+		ssh := c.Default
+		ds.SSH = &ssh
+	}
+	return ds, nil
+}
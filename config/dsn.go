@@ -0,0 +1,70 @@
+package config
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultApplicationName is reported to the server unless application_name is set
+const DefaultApplicationName = "dnc-data-mcp"
+
+// targetSessionAttrs are the target_session_attrs values libpq accepts
+var targetSessionAttrs = []string{"any", "read-write", "read-only", "primary", "standby", "prefer-standby"}
+
+// GetDSN returns the connection string for the database in libpq key=value
+// form, with every value quoted so passwords containing spaces, quotes or
+// backslashes survive. Unset options are left out.
+func (d DatabaseConfig) GetDSN() string {
+	applicationName := d.ApplicationName
+	if applicationName == "" {
+		applicationName = DefaultApplicationName
+	}
+
+	params := []struct{ key, value string }{
+		{"host", d.Server},
+		{"port", portString(d.Port)},
+		{"user", d.Username},
+		{"password", d.Password},
+		{"dbname", d.Database},
+		{"sslmode", d.SSLMode},
+		{"sslrootcert", ExpandPath(d.SSLRootCert)},
+		{"connect_timeout", timeoutString(d.ConnectTimeout)},
+		{"application_name", applicationName},
+		{"target_session_attrs", d.TargetSessionAttrs},
+		{"search_path", d.SearchPath},
+	}
+
+	var parts []string
+	for _, p := range params {
+		if p.value == "" {
+			continue
+		}
+		parts = append(parts, p.key+"="+quoteDSNValue(p.value))
+	}
+	return strings.Join(parts, " ")
+}
+
+// quoteDSNValue single-quotes a value, escaping backslashes and quotes
+func quoteDSNValue(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `'`, `\'`)
+	return "'" + value + "'"
+}
+
+func portString(port int) string {
+	if port == 0 {
+		return ""
+	}
+	return strconv.Itoa(port)
+}
+
+// timeoutString converts a timeout to the whole seconds libpq expects, rounding
+// up so a sub-second timeout doesn't become 0 (which means no timeout)
+func timeoutString(timeout time.Duration) string {
+	if timeout <= 0 {
+		return ""
+	}
+	seconds := (timeout + time.Second - 1) / time.Second
+	return strconv.Itoa(int(seconds))
+}
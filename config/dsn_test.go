@@ -0,0 +1,63 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetDSN(t *testing.T) {
+	t.Parallel()
+
+	base := DatabaseConfig{
+		Server:   "db.internal",
+		Port:     5432,
+		Username: "reader",
+		Password: "secret",
+		Database: "traffic",
+		SSLMode:  "require",
+	}
+
+	testCases := []struct {
+		name   string
+		modify func(*DatabaseConfig)
+		want   string
+	}{
+		{
+			name:   "Defaults",
+			modify: func(*DatabaseConfig) {},
+			want:   `host='db.internal' port='5432' user='reader' password='secret' dbname='traffic' sslmode='require' application_name='dnc-data-mcp'`,
+		},
+		{
+			name: "Password with spaces and quotes",
+			modify: func(d *DatabaseConfig) {
+				d.Password = `it's a \ secret`
+			},
+			want: `host='db.internal' port='5432' user='reader' password='it\'s a \\ secret' dbname='traffic' sslmode='require' application_name='dnc-data-mcp'`,
+		},
+		{
+			name: "All options",
+			modify: func(d *DatabaseConfig) {
+				d.Password = ""
+				d.SSLMode = "verify-full"
+				d.SSLRootCert = "/etc/ssl/rds.pem"
+				d.ConnectTimeout = 1500 * time.Millisecond
+				d.ApplicationName = "reporting"
+				d.SearchPath = "yer_analysis, public"
+				d.TargetSessionAttrs = "read-only"
+			},
+			want: `host='db.internal' port='5432' user='reader' dbname='traffic' sslmode='verify-full' sslrootcert='/etc/ssl/rds.pem' connect_timeout='2' application_name='reporting' target_session_attrs='read-only' search_path='yer_analysis, public'`,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			d := base
+			tc.modify(&d)
+			if got := d.GetDSN(); got != tc.want {
+				t.Errorf("Unexpected DSN:\n got: %s\nwant: %s", got, tc.want)
+			}
+		})
+	}
+}
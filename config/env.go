@@ -0,0 +1,113 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/viper"
+)
+
+// EnvPrefix starts every environment variable override. The rest of the name is
+// the config key in upper case with dots and dashes turned into underscores, so
+// DNC_MCP_DEFAULT_SSH_HOST sets default.ssh_host and
+// DNC_MCP_DATABASE_RO_TRAFFIC_PORT sets database.ro-traffic.port. List and map
+// fields such as default.jump_hosts take a JSON value; DNC_MCP_DATABASE can
+// define whole datasources that way.
+const EnvPrefix = "DNC_MCP"
+
+// EnvName returns the environment variable that overrides a config key
+func EnvName(key string) string {
+	name := strings.NewReplacer(".", "_", "-", "_").Replace(key)
+	return EnvPrefix + "_" + strings.ToUpper(name)
+}
+
+// bindEnv binds an environment variable to every key in Config, including the
+// fields of each datasource already defined in v. Viper only consults the
+// environment for keys it knows about, so without this a field missing from
+// every file could not be set from the environment.
+func bindEnv(v *viper.Viper) error {
+	keys := configKeys(reflect.TypeOf(Config{}), "")
+	for name := range v.GetStringMap("database") {
+		keys = append(keys, configKeys(reflect.TypeOf(Datasource{}), "database."+name+".")...)
+	}
+
+	// Only bind variables that are set, since an unset binding for a map such as
+	// database would otherwise shadow the bindings for keys inside it
+	for _, key := range keys {
+		if _, ok := os.LookupEnv(EnvName(key)); !ok {
+			continue
+		}
+		if err := v.BindEnv(key, EnvName(key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// configKeys lists the dotted mapstructure keys of every leaf field in t,
+// looking through pointers and squashed embedded structs. Slices and maps
+// count as leaves.
+func configKeys(t reflect.Type, prefix string) []string {
+	var keys []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("mapstructure")
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+
+		if tag == ",squash" {
+			keys = append(keys, configKeys(fieldType, prefix)...)
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		key := prefix + name
+
+		if fieldType.Kind() == reflect.Struct && fieldType != reflect.TypeOf(time.Duration(0)) {
+			keys = append(keys, configKeys(fieldType, key+".")...)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// decodeHook extends viper's default hooks to decode JSON strings, as found in
+// environment variables, into list, map and struct fields
+func decodeHook() mapstructure.DecodeHookFunc {
+	return mapstructure.ComposeDecodeHookFunc(
+		jsonStringHook,
+		mapstructure.StringToTimeDurationHookFunc(),
+		mapstructure.StringToSliceHookFunc(","),
+	)
+}
+
+func jsonStringHook(from, to reflect.Type, data interface{}) (interface{}, error) {
+	if from.Kind() != reflect.String {
+		return data, nil
+	}
+	switch to.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Struct:
+	default:
+		return data, nil
+	}
+
+	s := strings.TrimSpace(data.(string))
+	if !strings.HasPrefix(s, "[") && !strings.HasPrefix(s, "{") {
+		return data, nil
+	}
+
+	var decoded interface{}
+	if err := json.Unmarshal([]byte(s), &decoded); err != nil {
+		return nil, err
+	}
+	return decoded, nil
+}
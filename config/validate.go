@@ -0,0 +1,235 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// sslModes are the sslmode values libpq accepts
+var sslModes = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+
+// knownModes are the connection modes validation accepts
+var knownModes = map[string]bool{
+	ModeSSH:    true,
+	ModeDirect: true,
+}
+
+// RegisterMode makes validation accept an additional connection mode
+func RegisterMode(mode string) {
+	knownModes[mode] = true
+}
+
+// ValidationError lists every problem found in a config
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid config:\n  - %s", strings.Join(e.Problems, "\n  - "))
+}
+
+// Validate checks the config for missing or invalid settings. It returns a
+// *ValidationError listing all of them, or nil if there are none.
+func (c *Config) Validate() error {
+	if problems := c.Problems(); len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// Problems returns a description of everything wrong with the config, each
+// naming the offending key and how to fix it
+func (c *Config) Problems() []string {
+	var v validator
+
+	if mode := c.ConnectionMode(); !knownModes[mode] {
+		v.addf("connection.mode %q is not a known mode; use %q or %q", mode, ModeSSH, ModeDirect)
+	}
+
+	if len(c.Database) == 0 {
+		v.addf("database has no datasources; add one such as database.%s with its server, port, username, database and sslmode", DefaultDatasource)
+	} else if _, ok := c.Database[c.DefaultDatasourceName()]; !ok {
+		v.addf("default_datasource %q is not one of the configured datasources (%s)",
+			c.DefaultDatasourceName(), strings.Join(c.DatasourceNames(), ", "))
+	}
+
+	if c.Timezone != "" {
+		if _, err := time.LoadLocation(c.Timezone); err != nil {
+			v.addf("timezone %q is not a known timezone; use an IANA name such as \"America/New_York\"", c.Timezone)
+		}
+	}
+
+	// Datasources without their own ssh block share the default settings, which
+	// only need checking once
+	checkedDefault := false
+	for _, name := range c.DatasourceNames() {
+		key := "database." + name
+		raw := c.Database[name]
+		ds, _ := c.Datasource(name)
+
+		if raw.Connection != nil && raw.Connection.Mode != "" && !knownModes[raw.Connection.Mode] {
+			v.addf("%s.connection.mode %q is not a known mode; use %q or %q", key, raw.Connection.Mode, ModeSSH, ModeDirect)
+		}
+		if ds.Mode() == ModeSSH {
+			switch {
+			case raw.SSH != nil:
+				v.checkSSH(key+".ssh", *raw.SSH)
+			case !checkedDefault:
+				v.checkSSH("default", c.Default)
+				checkedDefault = true
+			}
+		}
+
+		v.checkDatabase(key, ds.DatabaseConfig, len(ds.Hosts) > 0)
+		for i, h := range ds.Hosts {
+			hostKey := fmt.Sprintf("%s.hosts[%d]", key, i)
+			v.required(hostKey+".server", h.Server, "set it to the database host name")
+			v.port(hostKey+".port", h.Port, ds.Port != 0, "set it here or set the datasource's port, usually 5432")
+		}
+	}
+
+	return v.problems
+}
+
+// validator accumulates problems
+type validator struct {
+	problems []string
+}
+
+func (v *validator) addf(format string, args ...interface{}) {
+	v.problems = append(v.problems, fmt.Sprintf(format, args...))
+}
+
+// required reports an empty setting
+func (v *validator) required(key, value, hint string) {
+	if value == "" {
+		v.addf("%s is not set; %s", key, hint)
+	}
+}
+
+// port reports a port outside 1-65535. Zero is only allowed when optional.
+func (v *validator) port(key string, port int, optional bool, hint string) {
+	switch {
+	case port == 0 && optional:
+	case port == 0:
+		v.addf("%s is not set; %s", key, hint)
+	case port < 0 || port > 65535:
+		v.addf("%s is %d; ports must be between 1 and 65535", key, port)
+	}
+}
+
+// readable reports a file that can't be read
+func (v *validator) readable(key, path string) {
+	if path == "" {
+		return
+	}
+	f, err := os.Open(ExpandPath(path))
+	if err != nil {
+		v.addf("%s %q can't be read: %v", key, path, err)
+		return
+	}
+	f.Close()
+}
+
+func (v *validator) checkSSH(prefix string, s SSHConfig) {
+	// An ssh config file can supply everything except the host alias itself
+	fromFile := s.SSHConfigFile != ""
+	v.readable(prefix+".ssh_config_file", s.SSHConfigFile)
+
+	v.required(prefix+".ssh_host", s.SSHHost, "set it to the bastion host name, or set connection.mode to \"direct\" if no tunnel is needed")
+	v.port(prefix+".ssh_port", s.SSHPort, fromFile, "set it to the bastion's SSH port, usually 22")
+	if !fromFile {
+		v.required(prefix+".ssh_user", s.SSHUser, "set it to your user name on the bastion")
+		v.required(prefix+".ssh_private_key", s.SSHPrivateKey, "set it to the path of your SSH private key, e.g. ~/.ssh/id_ed25519")
+	}
+	v.readable(prefix+".ssh_private_key", s.SSHPrivateKey)
+	v.readable(prefix+".ssh_known_hosts", s.SSHKnownHosts)
+
+	for i, jh := range s.JumpHosts {
+		key := fmt.Sprintf("%s.jump_hosts[%d]", prefix, i)
+		v.required(key+".host", jh.Host, "set it to the jump host name or an ssh config Host alias")
+		v.port(key+".port", jh.Port, true, "")
+		v.readable(key+".private_key", jh.PrivateKey)
+		v.readable(key+".known_hosts", jh.KnownHosts)
+	}
+
+	if s.SSHMaxConns < 0 {
+		v.addf("%s.ssh_max_conns is %d; use 0 for the default or a positive limit", prefix, s.SSHMaxConns)
+	}
+	if s.SSHDrainTimeout < 0 {
+		v.addf("%s.ssh_drain_timeout is %v; use a positive duration such as \"10s\"", prefix, s.SSHDrainTimeout)
+	}
+}
+
+// checkDatabase checks a datasource's connection settings. With a hosts list,
+// server and port may come from the hosts instead.
+func (v *validator) checkDatabase(key string, d DatabaseConfig, hasHosts bool) {
+	if !hasHosts {
+		v.required(key+".server", d.Server, "set it to the database host name, or list several under hosts")
+		v.port(key+".port", d.Port, false, "set it to the database port, usually 5432")
+	} else {
+		v.port(key+".port", d.Port, true, "")
+	}
+	v.required(key+".username", d.Username, "set it to your database user")
+	v.required(key+".database", d.Database, "set it to the database name")
+
+	if sources := d.passwordSources(); len(sources) > 1 {
+		v.addf("%s has more than one password source (%s); keep only one", key, strings.Join(sources, ", "))
+	}
+	v.readable(key+".password_file", d.PasswordFile)
+	v.readable(key+".sslrootcert", d.SSLRootCert)
+
+	limits := []struct {
+		name  string
+		value int
+	}{
+		{"max_open_conns", d.MaxOpenConns},
+		{"max_idle_conns", d.MaxIdleConns},
+	}
+	for _, l := range limits {
+		if l.value < 0 {
+			v.addf("%s.%s is %d; use 0 for the default or a positive limit", key, l.name, l.value)
+		}
+	}
+
+	durations := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"connect_timeout", d.ConnectTimeout},
+		{"conn_max_lifetime", d.ConnMaxLifetime},
+		{"conn_max_idle_time", d.ConnMaxIdleTime},
+		{"health_check_interval", d.HealthCheckInterval},
+		{"connect_retry_timeout", d.ConnectRetryTimeout},
+	}
+	for _, dur := range durations {
+		if dur.value < 0 {
+			v.addf("%s.%s is %v; use a positive duration such as \"10s\"", key, dur.name, dur.value)
+		}
+	}
+
+	if d.TargetSessionAttrs != "" && !contains(targetSessionAttrs, d.TargetSessionAttrs) {
+		v.addf("%s.target_session_attrs %q is not valid; use one of %s", key, d.TargetSessionAttrs, strings.Join(targetSessionAttrs, ", "))
+	}
+
+	sslMode := d.SSLMode
+	if sslMode == "" {
+		v.addf("%s.sslmode is not set; use one of %s", key, strings.Join(sslModes, ", "))
+		return
+	}
+	if contains(sslModes, sslMode) {
+		return
+	}
+	v.addf("%s.sslmode %q is not valid; use one of %s", key, sslMode, strings.Join(sslModes, ", "))
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,167 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+	keyPath := writeFile(t, t.TempDir(), "id_ed25519", "not really a key")
+
+	valid := func() *Config {
+		cfg := &Config{}
+		cfg.Default.SSHHost = "bastion.example.com"
+		cfg.Default.SSHPort = 22
+		cfg.Default.SSHUser = "me"
+		cfg.Default.SSHPrivateKey = keyPath
+		cfg.Database = map[string]Datasource{
+			"ro-traffic": {DatabaseConfig: DatabaseConfig{
+				Server:   "db.internal",
+				Port:     5432,
+				Username: "reader",
+				Database: "traffic",
+				SSLMode:  "require",
+			}},
+		}
+		return cfg
+	}
+
+	testCases := []struct {
+		name   string
+		modify func(*Config)
+		want   []string
+	}{
+		{
+			name:   "Valid",
+			modify: func(*Config) {},
+		},
+		{
+			name: "Direct mode needs no SSH settings",
+			modify: func(c *Config) {
+				c.Connection.Mode = ModeDirect
+				c.Default = SSHConfig{}
+			},
+		},
+		{
+			name: "Missing SSH settings",
+			modify: func(c *Config) {
+				c.Default = SSHConfig{}
+			},
+			want: []string{"default.ssh_host is not set", "default.ssh_port is not set",
+				"default.ssh_user is not set", "default.ssh_private_key is not set"},
+		},
+		{
+			name: "Unreadable key and bad ports",
+			modify: func(c *Config) {
+				c.Default.SSHPrivateKey = filepath.Join(t.TempDir(), "missing")
+				c.Default.SSHPort = 70000
+				c.Default.JumpHosts = []JumpHost{{Port: -1}}
+				ds := c.Database["ro-traffic"]
+				ds.Port = 0
+				c.Database["ro-traffic"] = ds
+			},
+			want: []string{"default.ssh_private_key", "can't be read", "default.ssh_port is 70000",
+				"default.jump_hosts[0].host is not set", "default.jump_hosts[0].port is -1",
+				"database.ro-traffic.port is not set"},
+		},
+		{
+			name: "Missing and invalid sslmode",
+			modify: func(c *Config) {
+				ds := c.Database["ro-traffic"]
+				ds.SSLMode = "sometimes"
+				c.Database["ro-traffic"] = ds
+			},
+			want: []string{`database.ro-traffic.sslmode "sometimes" is not valid`},
+		},
+		{
+			name: "Unknown mode",
+			modify: func(c *Config) {
+				c.Connection.Mode = "carrier-pigeon"
+			},
+			want: []string{`connection.mode "carrier-pigeon" is not a known mode`},
+		},
+		{
+			name: "Several hosts",
+			modify: func(c *Config) {
+				ds := c.Database["ro-traffic"]
+				ds.Server = ""
+				ds.Hosts = []DatabaseHost{{Server: "replica-1.internal"}, {Port: 6432}}
+				c.Database["ro-traffic"] = ds
+			},
+			want: []string{"database.ro-traffic.hosts[1].server is not set"},
+		},
+		{
+			name: "Bad connection options",
+			modify: func(c *Config) {
+				ds := c.Database["ro-traffic"]
+				ds.TargetSessionAttrs = "whatever"
+				ds.SSLRootCert = filepath.Join(t.TempDir(), "missing.crt")
+				c.Database["ro-traffic"] = ds
+			},
+			want: []string{`database.ro-traffic.target_session_attrs "whatever" is not valid`,
+				"database.ro-traffic.sslrootcert"},
+		},
+		{
+			name: "Unknown timezone",
+			modify: func(c *Config) {
+				c.Timezone = "Mars/Olympus_Mons"
+			},
+			want: []string{`timezone "Mars/Olympus_Mons" is not a known timezone`},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			cfg := valid()
+			tc.modify(cfg)
+
+			err := cfg.Validate()
+			if len(tc.want) == 0 {
+				if err != nil {
+					t.Errorf("Expected a valid config, got: %v", err)
+				}
+				return
+			}
+
+			var verr *ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("Expected a *ValidationError, got: %v", err)
+			}
+			for _, want := range tc.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Expected problems to mention %q, got:\n%v", want, err)
+				}
+			}
+		})
+	}
+}
+
+func TestResolveSecrets(t *testing.T) {
+	t.Parallel()
+	passwordFile := writeFile(t, t.TempDir(), "password", "s3cret\n")
+
+	cfg := &Config{Database: map[string]Datasource{
+		"ro-traffic": {DatabaseConfig: DatabaseConfig{PasswordFile: passwordFile}},
+	}}
+	if err := cfg.ResolveSecrets(context.Background()); err != nil {
+		t.Fatalf("Failed to resolve secrets: %v", err)
+	}
+	if cfg.Database["ro-traffic"].Password != "s3cret" {
+		t.Errorf("Expected password from file, got %q", cfg.Database["ro-traffic"].Password)
+	}
+
+	// Two sources at once is a config problem
+	ds := cfg.Database["ro-traffic"]
+	ds.PasswordCommand = "pass show db"
+	cfg.Database["ro-traffic"] = ds
+	problems := strings.Join(cfg.Problems(), "\n")
+	if !strings.Contains(problems, "more than one password source (password, password_file, password_command)") {
+		t.Errorf("Expected a multiple sources problem, got:\n%s", problems)
+	}
+}
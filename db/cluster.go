@@ -0,0 +1,170 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// lagTolerance is how much replication lag difference is ignored when ranking
+// hosts, so routing doesn't flap between replicas that are equally current
+const lagTolerance = time.Second
+
+// node is one host of a cluster; *DB implements it
+type node interface {
+	QueryValues(ctx context.Context, query string, args ...interface{}) (*Result, error)
+	QueryBatch(ctx context.Context, queries []BatchQuery) ([]*Result, error)
+	Stats() Stats
+	markUnhealthy(err error)
+	Close() error
+}
+
+// member is a node along with the host it connects to
+type member struct {
+	host string
+	node node
+}
+
+// Cluster routes a datasource's queries across its hosts: healthy hosts
+// first, then those with the least replication lag, then in configured order.
+// A query that fails because its host went away is retried on the next one.
+type Cluster struct {
+	members []member
+}
+
+// rank returns the members best first
+func (c *Cluster) rank() []member {
+	type ranked struct {
+		member
+		stats Stats
+	}
+	candidates := make([]ranked, len(c.members))
+	for i, m := range c.members {
+		candidates[i] = ranked{m, m.node.Stats()}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i].stats, candidates[j].stats
+		if a.Healthy != b.Healthy {
+			return a.Healthy
+		}
+		return a.LagMillis/lagTolerance.Milliseconds() < b.LagMillis/lagTolerance.Milliseconds()
+	})
+
+	members := make([]member, len(candidates))
+	for i, c := range candidates {
+		members[i] = c.member
+	}
+	return members
+}
+
+// QueryValues runs a query on the best host, failing over to the others on
+// connection errors. The result records which host answered and how fresh
+// its data was.
+func (c *Cluster) QueryValues(ctx context.Context, query string, args ...interface{}) (*Result, error) {
+	var result *Result
+	err := c.try(ctx, func(m member) error {
+		var err error
+		result, err = m.node.QueryValues(ctx, query, args...)
+		if err == nil {
+			annotate(result, m)
+		}
+		return err
+	})
+	return result, err
+}
+
+// QueryBatch runs a batch on the best host, failing over like QueryValues
+func (c *Cluster) QueryBatch(ctx context.Context, queries []BatchQuery) ([]*Result, error) {
+	var results []*Result
+	err := c.try(ctx, func(m member) error {
+		var err error
+		results, err = m.node.QueryBatch(ctx, queries)
+		if err == nil {
+			for _, r := range results {
+				annotate(r, m)
+			}
+		}
+		return err
+	})
+	return results, err
+}
+
+// try calls run on each host in rank order until one succeeds or fails for a
+// reason other than the connection
+func (c *Cluster) try(ctx context.Context, run func(member) error) error {
+	var lastErr error
+	for _, m := range c.rank() {
+		err := run(m)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil || !isConnectionError(err) {
+			return err
+		}
+
+		m.node.markUnhealthy(err)
+		lastErr = err
+		if len(c.members) > 1 {
+			log.Printf("Query failed on %s, trying the next host: %v\n", m.host, err)
+		}
+	}
+	return lastErr
+}
+
+// annotate records the answering host's freshness on a result
+func annotate(r *Result, m member) {
+	stats := m.node.Stats()
+	r.Host = m.host
+	r.Lag = time.Duration(stats.LagMillis) * time.Millisecond
+	r.DataAsOf = stats.DataAsOf
+}
+
+// Stats returns each host's statistics, keyed by host
+func (c *Cluster) Stats() map[string]Stats {
+	stats := make(map[string]Stats, len(c.members))
+	for _, m := range c.members {
+		stats[m.host] = m.node.Stats()
+	}
+	return stats
+}
+
+// Close closes every host's pool
+func (c *Cluster) Close() error {
+	var errs []error
+	for _, m := range c.members {
+		if err := m.node.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// isConnectionError reports whether err means the host couldn't be reached or
+// dropped the connection, as opposed to a problem with the query itself
+func isConnectionError(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// Connection exceptions, and the server shutting down or starting up
+		return strings.HasPrefix(pgErr.Code, "08") ||
+			pgErr.Code == "57P01" || pgErr.Code == "57P02" || pgErr.Code == "57P03"
+	}
+
+	var connectErr *pgconn.ConnectError
+	var netErr net.Error
+	var notConnected *notConnectedError
+	return errors.As(err, &connectErr) ||
+		errors.As(err, &notConnected) ||
+		errors.As(err, &netErr) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, net.ErrClosed) ||
+		pgconn.SafeToRetry(err)
+}
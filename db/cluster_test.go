@@ -0,0 +1,188 @@
+package db
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/dnc-data-mcp/tunnel"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// fakeNode is a host with scripted health and query errors
+type fakeNode struct {
+	stats   Stats
+	err     error
+	queries int
+}
+
+func (n *fakeNode) QueryValues(ctx context.Context, query string, args ...interface{}) (*Result, error) {
+	n.queries++
+	if n.err != nil {
+		return nil, n.err
+	}
+	return &Result{Columns: []string{"ok"}}, nil
+}
+
+func (n *fakeNode) QueryBatch(ctx context.Context, queries []BatchQuery) ([]*Result, error) {
+	n.queries++
+	if n.err != nil {
+		return nil, n.err
+	}
+	return []*Result{{}}, nil
+}
+
+func (n *fakeNode) Stats() Stats { return n.stats }
+
+func (n *fakeNode) markUnhealthy(err error) { n.stats.Healthy = false }
+
+func (n *fakeNode) Close() error { return nil }
+
+func TestClusterRouting(t *testing.T) {
+	asOf := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	connErr := io.ErrUnexpectedEOF
+	sqlErr := &pgconn.PgError{Code: "42P01", Message: `relation "nope" does not exist`}
+
+	testCases := []struct {
+		name      string
+		primary   fakeNode
+		secondary fakeNode
+		wantHost  string
+		wantErr   bool
+		// Which hosts should have been queried
+		wantQueries [2]int
+	}{
+		{
+			name:        "Prefers the first host when equally fresh",
+			primary:     fakeNode{stats: Stats{Healthy: true, LagMillis: 200}},
+			secondary:   fakeNode{stats: Stats{Healthy: true, LagMillis: 0}},
+			wantHost:    "primary:5432",
+			wantQueries: [2]int{1, 0},
+		},
+		{
+			name:        "Prefers the host with less lag",
+			primary:     fakeNode{stats: Stats{Healthy: true, LagMillis: 45000}},
+			secondary:   fakeNode{stats: Stats{Healthy: true, LagMillis: 300, DataAsOf: asOf}},
+			wantHost:    "secondary:5432",
+			wantQueries: [2]int{0, 1},
+		},
+		{
+			name:        "Skips unhealthy hosts",
+			primary:     fakeNode{stats: Stats{Healthy: false}},
+			secondary:   fakeNode{stats: Stats{Healthy: true, LagMillis: 90000}},
+			wantHost:    "secondary:5432",
+			wantQueries: [2]int{0, 1},
+		},
+		{
+			name:        "Fails over on connection errors",
+			primary:     fakeNode{stats: Stats{Healthy: true}, err: connErr},
+			secondary:   fakeNode{stats: Stats{Healthy: true}},
+			wantHost:    "secondary:5432",
+			wantQueries: [2]int{1, 1},
+		},
+		{
+			name:        "Doesn't fail over on query errors",
+			primary:     fakeNode{stats: Stats{Healthy: true}, err: sqlErr},
+			secondary:   fakeNode{stats: Stats{Healthy: true}},
+			wantErr:     true,
+			wantQueries: [2]int{1, 0},
+		},
+		{
+			name:        "Every host down",
+			primary:     fakeNode{stats: Stats{Healthy: true}, err: connErr},
+			secondary:   fakeNode{stats: Stats{Healthy: true}, err: connErr},
+			wantErr:     true,
+			wantQueries: [2]int{1, 1},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			cluster := &Cluster{members: []member{
+				{host: "primary:5432", node: &tc.primary},
+				{host: "secondary:5432", node: &tc.secondary},
+			}}
+
+			result, err := cluster.QueryValues(context.Background(), "SELECT 1")
+			if tc.wantErr {
+				if err == nil {
+					t.Error("Expected an error")
+				}
+			} else if err != nil {
+				t.Fatalf("Query failed: %v", err)
+			} else if result.Host != tc.wantHost {
+				t.Errorf("Expected %s to answer, got %s", tc.wantHost, result.Host)
+			}
+
+			if got := [2]int{tc.primary.queries, tc.secondary.queries}; got != tc.wantQueries {
+				t.Errorf("Expected queries %v, got %v", tc.wantQueries, got)
+			}
+		})
+	}
+}
+
+func TestClusterAnnotatesFreshness(t *testing.T) {
+	asOf := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	node := &fakeNode{stats: Stats{Healthy: true, Replica: true, LagMillis: 1500, DataAsOf: asOf}}
+	cluster := &Cluster{members: []member{{host: "replica:5432", node: node}}}
+
+	result, err := cluster.QueryValues(context.Background(), "SELECT 1")
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if result.Lag != 1500*time.Millisecond || !result.DataAsOf.Equal(asOf) {
+		t.Errorf("Unexpected freshness: lag %v, as of %v", result.Lag, result.DataAsOf)
+	}
+
+	// A failed host is avoided until its next health check
+	node.err = io.EOF
+	if _, err := cluster.QueryValues(context.Background(), "SELECT 1"); err == nil {
+		t.Fatal("Expected an error")
+	}
+	if node.stats.Healthy {
+		t.Error("Expected the host to be marked unhealthy")
+	}
+}
+
+func TestClusterHostRecovers(t *testing.T) {
+	// The first host is down at startup and comes up on the third retry
+	recovered := &fakeNode{stats: Stats{Healthy: true}}
+	tries := 0
+	down := newReconnectingNode("primary:5432", io.EOF, 5*time.Millisecond, func() (node, tunnel.Connector, error) {
+		tries++
+		if tries < 3 {
+			return nil, nil, io.EOF
+		}
+		return recovered, nil, nil
+	})
+	defer down.Close()
+	secondary := &fakeNode{stats: Stats{Healthy: true, LagMillis: 60000}}
+	cluster := &Cluster{members: []member{
+		{host: "primary:5432", node: down},
+		{host: "secondary:5432", node: secondary},
+	}}
+
+	if s := down.Stats(); s.Healthy || s.LastError == "" {
+		t.Errorf("Expected the down host to be unhealthy with its error, got %+v", s)
+	}
+	result, err := cluster.QueryValues(context.Background(), "SELECT 1")
+	if err != nil || result.Host != "secondary:5432" {
+		t.Fatalf("Expected the secondary to answer while the primary is down, got %+v, %v", result, err)
+	}
+
+	// Queries to the down host fail over like a dropped connection
+	if _, err := down.QueryValues(context.Background(), "SELECT 1"); !isConnectionError(err) {
+		t.Errorf("Expected a connection error from the down host, got %v", err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for !down.Stats().Healthy && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	result, err = cluster.QueryValues(context.Background(), "SELECT 1")
+	if err != nil || result.Host != "primary:5432" || recovered.queries != 1 {
+		t.Errorf("Expected the recovered primary to answer, got %+v, %v", result, err)
+	}
+}
@@ -1,32 +1,268 @@
 package db
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"log"
+	"sync"
+	"time"
 
 	"github.com/dnc-data-mcp/config"
-	_ "github.com/lib/pq"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
 )
 
+const (
+	defaultMaxOpenConns        = 10
+	defaultHealthCheckInterval = 30 * time.Second
+	defaultConnectRetryTimeout = 15 * time.Second
+
+	// Backoff between connection attempts at startup
+	minRetryDelay = 100 * time.Millisecond
+	maxRetryDelay = 2 * time.Second
+)
+
+// DB is a pgx connection pool. Pool gives native type decoding, the binary
+// protocol and batches; the embedded *sql.DB is a database/sql view of the same
+// pool for code that wants the standard interface.
 type DB struct {
 	*sql.DB
+	Pool *pgxpool.Pool
+
+	// Outcome of the latest background health check
+	healthMu  sync.Mutex
+	healthy   bool
+	lastCheck time.Time
+	lastError string
+	replica   bool
+	lag       time.Duration
+	dataAsOf  time.Time
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Stats reports the pool's usage and health for metrics
+type Stats struct {
+	MaxOpenConns int `json:"max_open_conns"`
+	OpenConns    int `json:"open_conns"`
+	InUse        int `json:"in_use"`
+	Idle         int `json:"idle"`
+	// WaitCount counts acquires that had to wait for a free connection
+	WaitCount int64 `json:"wait_count"`
+	// AcquireMillis is the total time spent acquiring connections
+	AcquireMillis int64 `json:"acquire_ms"`
+	// Connections closed by conn_max_idle_time and conn_max_lifetime
+	MaxIdleTimeClosed int64 `json:"max_idle_time_closed"`
+	MaxLifetimeClosed int64 `json:"max_lifetime_closed"`
+
+	Healthy   bool      `json:"healthy"`
+	LastCheck time.Time `json:"last_check"`
+	LastError string    `json:"last_error,omitempty"`
+
+	// Replica is set for a server in recovery, i.e. a streaming replica
+	Replica bool `json:"replica"`
+	// LagMillis is how far behind the primary a replica's data is
+	LagMillis int64 `json:"replication_lag_ms"`
+	// DataAsOf is when the newest data on the server was written
+	DataAsOf time.Time `json:"data_as_of"`
 }
 
-func NewDB(cfg *config.Config) (*DB, error) {
-	db, err := sql.Open("postgres", cfg.GetDSN())
+// NewDB opens a connection pool to the database described by cfg. The first
+// connection is retried with backoff for up to connect_retry_timeout, since a
+// freshly opened tunnel may not be forwarding yet.
+func NewDB(cfg config.DatabaseConfig) (*DB, error) {
+	poolConfig, err := pgxpool.ParseConfig(cfg.GetDSN())
+	if err != nil {
+		return nil, fmt.Errorf("error parsing database config: %v", err)
+	}
+
+	// Configure the pool
+	maxOpen := cfg.MaxOpenConns
+	if maxOpen == 0 {
+		maxOpen = defaultMaxOpenConns
+	}
+	poolConfig.MaxConns = int32(maxOpen)
+	if cfg.ConnMaxLifetime > 0 {
+		poolConfig.MaxConnLifetime = cfg.ConnMaxLifetime
+	}
+	if cfg.ConnMaxIdleTime > 0 {
+		poolConfig.MaxConnIdleTime = cfg.ConnMaxIdleTime
+	}
+
+	pool, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
 	if err != nil {
 		return nil, fmt.Errorf("error opening database: %v", err)
 	}
 
 	// Test the connection
-	if err := db.Ping(); err != nil {
+	retryTimeout := cfg.ConnectRetryTimeout
+	if retryTimeout == 0 {
+		retryTimeout = defaultConnectRetryTimeout
+	}
+	if err := pingWithRetry(pool, retryTimeout); err != nil {
+		pool.Close()
 		return nil, fmt.Errorf("error connecting to the database: %v", err)
 	}
 
-	return &DB{db}, nil
+	// The pool owns the connections; OpenDBFromPool keeps none idle in the
+	// database/sql view, so they go back to the pool for QueryValues
+	sqlDB := stdlib.OpenDBFromPool(pool)
+	sqlDB.SetMaxOpenConns(maxOpen)
+
+	db := &DB{
+		DB:   sqlDB,
+		Pool: pool,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+
+	// Measure replication lag straight away so routing starts out informed
+	db.check(context.Background())
+
+	interval := cfg.HealthCheckInterval
+	if interval == 0 {
+		interval = defaultHealthCheckInterval
+	}
+	go db.healthCheck(interval)
+
+	return db, nil
+}
+
+// pingWithRetry pings until it succeeds, the server rejects us outright, or
+// timeout passes, doubling the delay between attempts
+func pingWithRetry(pool *pgxpool.Pool, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	delay := minRetryDelay
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithDeadline(context.Background(), deadline)
+		err := pool.Ping(ctx)
+		cancel()
+		if err == nil {
+			return nil
+		}
+		// An error from the server itself, such as a bad password, won't go
+		// away by waiting
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) {
+			return err
+		}
+		if time.Now().Add(delay).After(deadline) {
+			return fmt.Errorf("giving up after %d attempts: %v", attempt, err)
+		}
+
+		log.Printf("Database not reachable yet (%v), retrying in %v\n", err, delay)
+		time.Sleep(delay)
+		delay *= 2
+		if delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+	}
+}
+
+// healthCheck checks the database every interval until Close
+func (db *DB) healthCheck(interval time.Duration) {
+	defer close(db.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-db.stop:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		db.check(ctx)
+		cancel()
+	}
+}
+
+// check records whether the database answers and how fresh its data is. On a
+// primary, or a replica that hasn't replayed anything yet, the data is current.
+func (db *DB) check(ctx context.Context) {
+	var replica bool
+	var replayed, now time.Time
+	err := db.Pool.QueryRow(ctx, `
+		SELECT pg_is_in_recovery(), COALESCE(pg_last_xact_replay_timestamp(), now()), now()
+	`).Scan(&replica, &replayed, &now)
+
+	db.healthMu.Lock()
+	wasHealthy := db.healthy || db.lastCheck.IsZero()
+	db.healthy = err == nil
+	db.lastCheck = time.Now()
+	db.lastError = ""
+	if err != nil {
+		db.lastError = err.Error()
+	} else {
+		db.replica = replica
+		db.dataAsOf = replayed
+		db.lag = 0
+		if replica && now.After(replayed) {
+			db.lag = now.Sub(replayed)
+		}
+	}
+	db.healthMu.Unlock()
+
+	switch {
+	case err != nil && wasHealthy:
+		log.Printf("Database health check failed: %v\n", err)
+	case err == nil && !wasHealthy:
+		log.Printf("Database is healthy again\n")
+	}
+}
+
+// markUnhealthy records a failed query so routing avoids this database until
+// the next successful health check
+func (db *DB) markUnhealthy(err error) {
+	db.healthMu.Lock()
+	defer db.healthMu.Unlock()
+	if db.healthy {
+		log.Printf("Database marked unhealthy: %v\n", err)
+	}
+	db.healthy = false
+	db.lastError = err.Error()
+}
+
+// Stats returns the pool statistics and latest health check result
+func (db *DB) Stats() Stats {
+	s := db.Pool.Stat()
+
+	db.healthMu.Lock()
+	defer db.healthMu.Unlock()
+
+	return Stats{
+		MaxOpenConns:      int(s.MaxConns()),
+		OpenConns:         int(s.TotalConns()),
+		InUse:             int(s.AcquiredConns()),
+		Idle:              int(s.IdleConns()),
+		WaitCount:         s.EmptyAcquireCount(),
+		AcquireMillis:     s.AcquireDuration().Milliseconds(),
+		MaxIdleTimeClosed: s.MaxIdleDestroyCount(),
+		MaxLifetimeClosed: s.MaxLifetimeDestroyCount(),
+		Healthy:           db.healthy,
+		LastCheck:         db.lastCheck,
+		LastError:         db.lastError,
+		Replica:           db.replica,
+		LagMillis:         db.lag.Milliseconds(),
+		DataAsOf:          db.dataAsOf,
+	}
 }
 
-// Close closes the database connection
+// Close stops the health check and closes the database connections
 func (db *DB) Close() error {
-	return db.DB.Close()
+	var err error
+	db.closeOnce.Do(func() {
+		close(db.stop)
+		<-db.done
+		err = db.DB.Close()
+		db.Pool.Close()
+	})
+	return err
 }
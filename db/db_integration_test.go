@@ -0,0 +1,154 @@
+//go:build integration
+
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/dnc-data-mcp/config"
+	"github.com/dnc-data-mcp/tunnel"
+)
+
+func TestDatabaseConnection(t *testing.T) {
+	// Load configuration
+	cfg, err := config.LoadConfig("")
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	// Debug: Print the entire config structure, with the password masked
+	configJSON, _ := json.MarshalIndent(cfg.Redacted(), "", "  ")
+	t.Logf("Loaded configuration:\n%s", string(configJSON))
+
+	// Use the default datasource
+	ds, err := cfg.Datasource("")
+	if err != nil {
+		t.Fatalf("Failed to find datasource: %v", err)
+	}
+
+	// Set up SSH tunnel, or connect directly in direct mode
+	connector, err := tunnel.Open(ds)
+	if err != nil {
+		t.Fatalf("Failed to create SSH tunnel: %v", err)
+	}
+	defer connector.Close()
+
+	// Update the database connection to use the tunnel
+	ds = ds.WithEndpoint(connector.Endpoint())
+
+	// Debug: Print the DSN string (without password)
+	redacted := ds.DatabaseConfig
+	redacted.Password = ""
+	dsn := redacted.GetDSN()
+	t.Logf("DSN (without password): %s", dsn)
+
+	// Initialize database connection
+	db, err := NewDB(ds.DatabaseConfig)
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	// Test query to yer_analysis.yer_reports
+	rows, err := db.Query("SELECT * FROM yer_analysis.yer_reports LIMIT 5")
+	if err != nil {
+		t.Fatalf("Failed to query yer_analysis.yer_reports: %v", err)
+	}
+	defer rows.Close()
+
+	// Get column names
+	columns, err := rows.Columns()
+	if err != nil {
+		t.Fatalf("Failed to get column names: %v", err)
+	}
+
+	// Log the column names for debugging
+	t.Logf("Found columns: %v", columns)
+
+	// Create a slice to hold the values
+	values := make([]interface{}, len(columns))
+	valuePtrs := make([]interface{}, len(columns))
+	for i := range columns {
+		valuePtrs[i] = &values[i]
+	}
+
+	// Print each row
+	rowCount := 0
+	for rows.Next() {
+		rowCount++
+		err := rows.Scan(valuePtrs...)
+		if err != nil {
+			t.Fatalf("Error scanning row: %v", err)
+		}
+
+		// Convert values to strings for printing
+		rowData := make(map[string]interface{})
+		for i, col := range columns {
+			val := values[i]
+			switch v := val.(type) {
+			case []byte:
+				rowData[col] = string(v)
+			case time.Time:
+				rowData[col] = v.Format(time.RFC3339)
+			case nil:
+				rowData[col] = nil
+			default:
+				rowData[col] = v
+			}
+		}
+
+		// Pretty print the row
+		rowJSON, _ := json.MarshalIndent(rowData, "", "  ")
+		t.Logf("Row %d:\n%s", rowCount, string(rowJSON))
+	}
+
+	if err := rows.Err(); err != nil {
+		t.Fatalf("Error while iterating rows: %v", err)
+	}
+
+	t.Logf("Successfully retrieved %d rows from yer_analysis.yer_reports", rowCount)
+}
+
+func TestQueryValuesRawSQL(t *testing.T) {
+	cfg, err := config.LoadConfig("")
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	ds, err := cfg.Datasource("")
+	if err != nil {
+		t.Fatalf("Failed to find datasource: %v", err)
+	}
+	connector, err := tunnel.Open(ds)
+	if err != nil {
+		t.Fatalf("Failed to create SSH tunnel: %v", err)
+	}
+	defer connector.Close()
+	db, err := NewDB(ds.WithEndpoint(connector.Endpoint()).DatabaseConfig)
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	// Raw SQL may hold several statements, as it could before pgx; the
+	// first one's rows come back
+	result, err := db.QueryValues(context.Background(), "SELECT 1 AS first, '\\x6163'::bytea AS raw; SELECT 2 AS second")
+	if err != nil {
+		t.Fatalf("Failed to run several statements: %v", err)
+	}
+	if len(result.Columns) != 2 || result.Columns[0] != "first" || len(result.Rows) != 1 {
+		t.Fatalf("Expected the first statement's row, got %+v", result)
+	}
+	if raw := result.Rows[0][1]; raw != "ac" {
+		t.Errorf("Expected bytea as a string, got %#v", raw)
+	}
+}
+
+func atoi(s string) int {
+	var n int
+	fmt.Sscanf(s, "%d", &n)
+	return n
+}
@@ -0,0 +1,143 @@
+// Package dbtest provides an in-memory stand-in for the database layer so code
+// built on it can be tested without Postgres
+package dbtest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/dnc-data-mcp/db"
+)
+
+// Call records a query the fake received
+type Call struct {
+	Datasource string
+	SQL        string
+	Args       []interface{}
+}
+
+// script is a scripted response to queries containing match
+type script struct {
+	datasource string
+	match      string
+	result     *db.Result
+	err        error
+}
+
+// Fake answers queries with scripted results. Scripts are matched in the order
+// they were added against a whitespace-normalized, lowercased copy of the SQL,
+// so tests can match on a distinctive fragment such as "from partners.partners".
+type Fake struct {
+	defaultName string
+	names       []string
+
+	mu      sync.Mutex
+	scripts []script
+	calls   []Call
+}
+
+// New returns a fake with the given datasources; the first one is the default
+func New(datasources ...string) *Fake {
+	if len(datasources) == 0 {
+		datasources = []string{"ro-traffic"}
+	}
+	names := append([]string(nil), datasources...)
+	sort.Strings(names)
+	return &Fake{defaultName: datasources[0], names: names}
+}
+
+// On scripts the result for queries containing match on any datasource
+func (f *Fake) On(match string, result *db.Result) *Fake {
+	return f.add(script{match: normalize(match), result: result})
+}
+
+// OnDatasource scripts the result for queries containing match on one datasource
+func (f *Fake) OnDatasource(datasource, match string, result *db.Result) *Fake {
+	return f.add(script{datasource: datasource, match: normalize(match), result: result})
+}
+
+// OnError makes queries containing match fail with err
+func (f *Fake) OnError(match string, err error) *Fake {
+	return f.add(script{match: normalize(match), err: err})
+}
+
+func (f *Fake) add(s script) *Fake {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.scripts = append(f.scripts, s)
+	return f
+}
+
+// QueryValues returns the first scripted result matching the query, or an
+// error if none does
+func (f *Fake) QueryValues(ctx context.Context, datasource, query string, args ...interface{}) (*db.Result, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if datasource == "" {
+		datasource = f.defaultName
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, Call{Datasource: datasource, SQL: query, Args: args})
+
+	normalized := normalize(query)
+	for _, s := range f.scripts {
+		if s.datasource != "" && s.datasource != datasource {
+			continue
+		}
+		if !strings.Contains(normalized, s.match) {
+			continue
+		}
+		if s.err != nil {
+			return nil, s.err
+		}
+		return copyResult(s.result), nil
+	}
+	return nil, fmt.Errorf("dbtest: no scripted result for query on %s: %s", datasource, strings.TrimSpace(query))
+}
+
+// Names returns the datasource names in sorted order
+func (f *Fake) Names() []string {
+	return f.names
+}
+
+// DefaultName returns the default datasource
+func (f *Fake) DefaultName() string {
+	return f.defaultName
+}
+
+// Calls returns every query received so far
+func (f *Fake) Calls() []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Call(nil), f.calls...)
+}
+
+// Result builds a result from column names and rows
+func Result(columns []string, rows ...[]interface{}) *db.Result {
+	return &db.Result{Columns: columns, Rows: rows}
+}
+
+// copyResult copies the rows so callers can't modify the script
+func copyResult(r *db.Result) *db.Result {
+	if r == nil {
+		return &db.Result{}
+	}
+	out := *r
+	out.Columns = append([]string(nil), r.Columns...)
+	out.Rows = nil
+	for _, row := range r.Rows {
+		out.Rows = append(out.Rows, append([]interface{}(nil), row...))
+	}
+	return &out
+}
+
+// normalize lowercases s and collapses runs of whitespace
+func normalize(s string) string {
+	return strings.Join(strings.Fields(strings.ToLower(s)), " ")
+}
@@ -0,0 +1,212 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/dnc-data-mcp/config"
+	"github.com/dnc-data-mcp/tunnel"
+)
+
+// Manager holds a cluster of connection pools per datasource, one pool per
+// host, each reached through its own connector
+type Manager struct {
+	defaultName string
+	names       []string
+	clusters    map[string]*Cluster
+	connectors  map[string][]hostConnector
+}
+
+// hostConnector is the connector for one host of a datasource
+type hostConnector struct {
+	host      string
+	connector tunnel.Connector
+}
+
+// NewManager connects to every datasource in cfg. A datasource with several
+// hosts starts as long as one of them is reachable; the others stay in its
+// cluster as unhealthy and are retried every health_check_interval until they
+// connect. If a datasource can't be reached at all, the ones already opened
+// are closed again.
+func NewManager(cfg *config.Config) (*Manager, error) {
+	m := &Manager{
+		defaultName: cfg.DefaultDatasourceName(),
+		clusters:    make(map[string]*Cluster),
+		connectors:  make(map[string][]hostConnector),
+	}
+
+	for _, name := range cfg.DatasourceNames() {
+		ds, err := cfg.Datasource(name)
+		if err != nil {
+			m.Close()
+			return nil, err
+		}
+
+		interval := ds.HealthCheckInterval
+		if interval == 0 {
+			interval = defaultHealthCheckInterval
+		}
+
+		cluster := &Cluster{}
+		var errs []error
+		var down []*reconnectingNode
+		for i, host := range ds.AllHosts() {
+			i, host := i, host
+			db, connector, err := connectHost(ds, host, i)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %v", host, err))
+				n := newReconnectingNode(host.String(), err, interval, func() (node, tunnel.Connector, error) {
+					db, connector, err := connectHost(ds, host, i)
+					if err != nil {
+						return nil, nil, err
+					}
+					return db, connector, nil
+				})
+				cluster.members = append(cluster.members, member{host: host.String(), node: n})
+				down = append(down, n)
+				continue
+			}
+			cluster.members = append(cluster.members, member{host: host.String(), node: db})
+			m.connectors[name] = append(m.connectors[name], hostConnector{host.String(), connector})
+		}
+		m.clusters[name] = cluster
+		m.names = append(m.names, name)
+
+		if len(down) == len(cluster.members) {
+			m.Close()
+			return nil, fmt.Errorf("error connecting to %s: %v", name, errors.Join(errs...))
+		}
+		for _, err := range errs {
+			log.Printf("Datasource %s starting without a host, retrying every %s: %v\n", name, interval, err)
+		}
+	}
+
+	return m, nil
+}
+
+// connectHost opens a connector and pool for one host of a datasource. Only the
+// first host can use the datasource's fixed local tunnel port; the others get
+// a free one.
+func connectHost(ds config.Datasource, host config.DatabaseHost, index int) (*DB, tunnel.Connector, error) {
+	hostDS := ds.WithEndpoint(host.Server, host.Port)
+	if index > 0 && hostDS.SSH != nil {
+		ssh := *hostDS.SSH
+		ssh.SSHLocalAddr = "localhost:0"
+		hostDS.SSH = &ssh
+	}
+
+	// Connect to the database host, through the SSH tunnel unless the
+	// datasource uses direct mode
+	connector, err := tunnel.Open(hostDS)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Point the database connection at wherever the connector says to
+	db, err := NewDB(hostDS.WithEndpoint(connector.Endpoint()).DatabaseConfig)
+	if err != nil {
+		connector.Close()
+		return nil, nil, err
+	}
+	return db, connector, nil
+}
+
+// Get returns the cluster for a datasource; an empty name means the default
+func (m *Manager) Get(name string) (*Cluster, error) {
+	if name == "" {
+		name = m.defaultName
+	}
+	cluster, ok := m.clusters[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown datasource: %q", name)
+	}
+	return cluster, nil
+}
+
+// QueryValues runs a query against a datasource; an empty name means the default
+func (m *Manager) QueryValues(ctx context.Context, datasource, query string, args ...interface{}) (*Result, error) {
+	cluster, err := m.Get(datasource)
+	if err != nil {
+		return nil, err
+	}
+	return cluster.QueryValues(ctx, query, args...)
+}
+
+// Names returns the datasource names in sorted order
+func (m *Manager) Names() []string {
+	return m.names
+}
+
+// DefaultName returns the datasource used when none is given
+func (m *Manager) DefaultName() string {
+	return m.defaultName
+}
+
+// TunnelStats returns the connection metrics of every host reached through an
+// SSH tunnel, keyed by datasource, or datasource/host for datasources with
+// several hosts
+func (m *Manager) TunnelStats() map[string]tunnel.Stats {
+	stats := make(map[string]tunnel.Stats)
+	for name, cluster := range m.clusters {
+		for _, hc := range m.hostConnectors(name) {
+			if t, ok := hc.connector.(*tunnel.SSHTunnel); ok {
+				stats[statsKey(name, hc.host, len(cluster.members))] = t.Stats()
+			}
+		}
+	}
+	return stats
+}
+
+// hostConnectors returns a datasource's connectors, including those of hosts
+// that connected after startup
+func (m *Manager) hostConnectors(name string) []hostConnector {
+	connectors := append([]hostConnector(nil), m.connectors[name]...)
+	for _, mem := range m.clusters[name].members {
+		if n, ok := mem.node.(*reconnectingNode); ok {
+			if connector := n.tunnelConnector(); connector != nil {
+				connectors = append(connectors, hostConnector{mem.host, connector})
+			}
+		}
+	}
+	return connectors
+}
+
+// PoolStats returns the pool statistics and health of every host, keyed like
+// TunnelStats
+func (m *Manager) PoolStats() map[string]Stats {
+	stats := make(map[string]Stats)
+	for name, cluster := range m.clusters {
+		for host, s := range cluster.Stats() {
+			stats[statsKey(name, host, len(cluster.members))] = s
+		}
+	}
+	return stats
+}
+
+// statsKey names a host in metrics, leaving out the host when it's the only one
+func statsKey(name, host string, hosts int) string {
+	if hosts == 1 {
+		return name
+	}
+	return name + "/" + host
+}
+
+// Close closes every pool and then its connector
+func (m *Manager) Close() error {
+	var errs []error
+	for name, cluster := range m.clusters {
+		if err := cluster.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("error closing %s database: %v", name, err))
+		}
+	}
+	for name, connectors := range m.connectors {
+		for _, hc := range connectors {
+			if err := hc.connector.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("error closing %s connection to %s: %v", name, hc.host, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,184 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"net/netip"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Result holds a query's columns and rows, with values decoded to native Go
+// types: numbers as int64 or float64, timestamps as time.Time, arrays as
+// []interface{} and json/jsonb as decoded JSON
+type Result struct {
+	Columns []string
+	Rows    [][]interface{}
+
+	// Host is the server that answered, as configured rather than the tunnel
+	Host string
+	// Lag is how far behind the primary that server was at its last check
+	Lag time.Duration
+	// DataAsOf is when the newest data on that server was written
+	DataAsOf time.Time
+}
+
+// BatchQuery is one statement in a batch
+type BatchQuery struct {
+	SQL  string
+	Args []interface{}
+}
+
+// QueryValues runs a query and returns all of its rows. Cancelling ctx cancels
+// the query on the server.
+func (db *DB) QueryValues(ctx context.Context, query string, args ...interface{}) (*Result, error) {
+	// A query without arguments may be raw SQL with several statements, which
+	// only the simple protocol accepts; the first statement's rows come back
+	if len(args) == 0 {
+		args = []interface{}{pgx.QueryExecModeSimpleProtocol}
+	}
+	rows, err := db.Pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return collect(rows)
+}
+
+// QueryBatch sends several queries in a single round trip and returns their
+// results in order
+func (db *DB) QueryBatch(ctx context.Context, queries []BatchQuery) ([]*Result, error) {
+	batch := &pgx.Batch{}
+	for _, q := range queries {
+		batch.Queue(q.SQL, q.Args...)
+	}
+
+	br := db.Pool.SendBatch(ctx, batch)
+	defer br.Close()
+
+	results := make([]*Result, len(queries))
+	for i := range queries {
+		rows, err := br.Query()
+		if err != nil {
+			return nil, fmt.Errorf("error running batch query %d: %v", i+1, err)
+		}
+		if results[i], err = collect(rows); err != nil {
+			return nil, fmt.Errorf("error running batch query %d: %v", i+1, err)
+		}
+	}
+
+	if err := br.Close(); err != nil {
+		return nil, fmt.Errorf("error closing batch: %v", err)
+	}
+	return results, nil
+}
+
+// collect reads every row and closes rows
+func collect(rows pgx.Rows) (*Result, error) {
+	defer rows.Close()
+
+	fields := rows.FieldDescriptions()
+	result := &Result{Columns: make([]string, len(fields))}
+	for i, f := range fields {
+		result.Columns[i] = f.Name
+	}
+
+	for rows.Next() {
+		values, err := rows.Values()
+		if err != nil {
+			return nil, err
+		}
+		for i, v := range values {
+			values[i] = nativeValue(v)
+		}
+		result.Rows = append(result.Rows, values)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// nativeValue converts the pgx types that don't encode well as JSON: numeric
+// becomes float64, bytea, uuid and network types become strings, NaN and
+// infinite floats are spelled out, and anything else pgx can't decode
+// natively falls back to its text form
+func nativeValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return string(v)
+	case float32:
+		if s, ok := specialFloat(float64(v)); ok {
+			return s
+		}
+		return v
+	case float64:
+		if s, ok := specialFloat(v); ok {
+			return s
+		}
+		return v
+	case pgtype.Numeric:
+		return numericValue(v)
+	case [16]byte:
+		return fmt.Sprintf("%x-%x-%x-%x-%x", v[0:4], v[4:6], v[6:8], v[8:10], v[10:16])
+	case netip.Prefix:
+		return v.String()
+	case []interface{}:
+		for i := range v {
+			v[i] = nativeValue(v[i])
+		}
+		return v
+	case driver.Valuer:
+		value, err := v.Value()
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		if b, ok := value.([]byte); ok {
+			return string(b)
+		}
+		return value
+	default:
+		return v
+	}
+}
+
+// specialFloat spells out NaN and the infinities the way numericValue does,
+// since JSON can't represent them
+func specialFloat(f float64) (string, bool) {
+	switch {
+	case math.IsNaN(f):
+		return "NaN", true
+	case math.IsInf(f, 1):
+		return "Infinity", true
+	case math.IsInf(f, -1):
+		return "-Infinity", true
+	}
+	return "", false
+}
+
+// numericValue converts a numeric to float64. NaN and infinities, which JSON
+// can't represent, are returned as strings.
+func numericValue(n pgtype.Numeric) interface{} {
+	switch {
+	case !n.Valid:
+		return nil
+	case n.NaN:
+		return "NaN"
+	case n.InfinityModifier == pgtype.Infinity:
+		return "Infinity"
+	case n.InfinityModifier == pgtype.NegativeInfinity:
+		return "-Infinity"
+	}
+
+	f, err := n.Float64Value()
+	if err != nil {
+		return nil
+	}
+	return f.Float64
+}
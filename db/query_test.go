@@ -0,0 +1,53 @@
+package db
+
+import (
+	"math"
+	"math/big"
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestNativeValue(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name  string
+		value interface{}
+		want  interface{}
+	}{
+		{"Null", nil, nil},
+		{"Integer", int64(42), int64(42)},
+		{"Timestamp", now, now},
+		{"Numeric", pgtype.Numeric{Int: big.NewInt(12345), Exp: -2, Valid: true}, 123.45},
+		{"Null numeric", pgtype.Numeric{}, nil},
+		{"NaN numeric", pgtype.Numeric{NaN: true, Valid: true}, "NaN"},
+		{"Float", 0.25, 0.25},
+		{"Real", float32(0.5), float32(0.5)},
+		{"NaN float", math.NaN(), "NaN"},
+		{"Infinite float", math.Inf(1), "Infinity"},
+		{"Negative infinite float", math.Inf(-1), "-Infinity"},
+		{"NaN real", float32(math.NaN()), "NaN"},
+		{"Infinite real", float32(math.Inf(1)), "Infinity"},
+		{"Negative infinite real", float32(math.Inf(-1)), "-Infinity"},
+		{"UUID", [16]byte{0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde, 0xf0, 0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde, 0xf0},
+			"12345678-9abc-def0-1234-56789abcdef0"},
+		{"Bytea", []byte("acme"), "acme"},
+		{"Inet", netip.MustParsePrefix("10.0.0.0/8"), "10.0.0.0/8"},
+		{"Interval", pgtype.Interval{Days: 1, Microseconds: 3600000000, Valid: true}, "1 day 01:00:00"},
+		{"Array", []interface{}{pgtype.Numeric{Int: big.NewInt(15), Exp: -1, Valid: true}, nil},
+			[]interface{}{1.5, nil}},
+		{"JSON", map[string]interface{}{"source": "tag"}, map[string]interface{}{"source": "tag"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := nativeValue(tc.value); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("nativeValue(%#v) = %#v, expected %#v", tc.value, got, tc.want)
+			}
+		})
+	}
+}
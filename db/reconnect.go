@@ -0,0 +1,156 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/dnc-data-mcp/tunnel"
+)
+
+// notConnectedError is returned for queries to a host that hasn't been
+// reached yet; the cluster fails over as for any other connection error
+type notConnectedError struct {
+	host    string
+	lastErr string
+}
+
+func (e *notConnectedError) Error() string {
+	return fmt.Sprintf("%s is not connected: %s", e.host, e.lastErr)
+}
+
+// reconnectingNode stands in for a host that couldn't be reached at startup.
+// It reports itself unhealthy, so routing skips it, and retries in the
+// background; once connected it hands everything to the host's pool, whose
+// own health check takes over.
+type reconnectingNode struct {
+	host     string
+	interval time.Duration
+	connect  func() (node, tunnel.Connector, error)
+
+	mu        sync.Mutex
+	node      node
+	connector tunnel.Connector
+	lastCheck time.Time
+	lastError string
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// newReconnectingNode starts retrying connect every interval after it failed
+// with err
+func newReconnectingNode(host string, err error, interval time.Duration, connect func() (node, tunnel.Connector, error)) *reconnectingNode {
+	n := &reconnectingNode{
+		host:      host,
+		interval:  interval,
+		connect:   connect,
+		lastCheck: time.Now(),
+		lastError: err.Error(),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	go n.reconnect()
+	return n
+}
+
+// reconnect retries until the host is reached or the node is closed
+func (n *reconnectingNode) reconnect() {
+	defer close(n.done)
+
+	ticker := time.NewTicker(n.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-n.stop:
+			return
+		case <-ticker.C:
+		}
+
+		connected, connector, err := n.connect()
+		n.mu.Lock()
+		n.lastCheck = time.Now()
+		if err != nil {
+			n.lastError = err.Error()
+			n.mu.Unlock()
+			continue
+		}
+		n.node, n.connector = connected, connector
+		n.mu.Unlock()
+		log.Printf("Connected to %s, which was unreachable at startup\n", n.host)
+		return
+	}
+}
+
+// current returns the host's node, or nil and why not while unreachable
+func (n *reconnectingNode) current() (node, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.node == nil {
+		return nil, &notConnectedError{host: n.host, lastErr: n.lastError}
+	}
+	return n.node, nil
+}
+
+func (n *reconnectingNode) QueryValues(ctx context.Context, query string, args ...interface{}) (*Result, error) {
+	connected, err := n.current()
+	if err != nil {
+		return nil, err
+	}
+	return connected.QueryValues(ctx, query, args...)
+}
+
+func (n *reconnectingNode) QueryBatch(ctx context.Context, queries []BatchQuery) ([]*Result, error) {
+	connected, err := n.current()
+	if err != nil {
+		return nil, err
+	}
+	return connected.QueryBatch(ctx, queries)
+}
+
+func (n *reconnectingNode) Stats() Stats {
+	if connected, err := n.current(); err == nil {
+		return connected.Stats()
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return Stats{Healthy: false, LastCheck: n.lastCheck, LastError: n.lastError}
+}
+
+func (n *reconnectingNode) markUnhealthy(err error) {
+	if connected, cerr := n.current(); cerr == nil {
+		connected.markUnhealthy(err)
+	}
+}
+
+// tunnelConnector returns the host's connector once it's connected
+func (n *reconnectingNode) tunnelConnector() tunnel.Connector {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.connector
+}
+
+// Close stops reconnecting and closes the pool and connector if it got that far
+func (n *reconnectingNode) Close() error {
+	var err error
+	n.closeOnce.Do(func() {
+		close(n.stop)
+		<-n.done
+
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		if n.node != nil {
+			err = n.node.Close()
+		}
+		if n.connector != nil {
+			if cerr := n.connector.Close(); cerr != nil && err == nil {
+				err = cerr
+			}
+		}
+	})
+	return err
+}
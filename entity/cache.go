@@ -0,0 +1,48 @@
+package entity
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// cache holds a value per datasource, loading it on first use and again once
+// it's older than ttl
+type cache[T any] struct {
+	ttl  time.Duration
+	load func(ctx context.Context, datasource string) (T, error)
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry[T]
+}
+
+type cacheEntry[T any] struct {
+	value  T
+	loaded time.Time
+}
+
+func newCache[T any](ttl time.Duration, load func(ctx context.Context, datasource string) (T, error)) *cache[T] {
+	return &cache[T]{ttl: ttl, load: load, entries: make(map[string]cacheEntry[T])}
+}
+
+// get returns the datasource's value, loading it if missing or stale. A failed
+// load isn't cached, so the next call tries again.
+func (c *cache[T]) get(ctx context.Context, datasource string) (T, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[datasource]
+	c.mu.Unlock()
+	if ok && time.Since(entry.loaded) < c.ttl {
+		return entry.value, nil
+	}
+
+	value, err := c.load(ctx, datasource)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+
+	c.mu.Lock()
+	c.entries[datasource] = cacheEntry[T]{value: value, loaded: time.Now()}
+	c.mu.Unlock()
+	return value, nil
+}
@@ -0,0 +1,245 @@
+// Package entity resolves loosely written names, such as "acme", "Acme Serch"
+// or a partner ID, to the partners they refer to
+package entity
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/dnc-data-mcp/db"
+)
+
+// Resolution outcomes
+const (
+	Resolved  = "resolved"
+	Ambiguous = "ambiguous"
+	NotFound  = "not_found"
+)
+
+const (
+	// MatchThreshold is the score the best candidate needs to be used
+	MatchThreshold = 0.6
+	// Margin is how far ahead of the runner-up the best candidate must be;
+	// closer than that and the caller is asked to pick
+	Margin = 0.1
+	// candidateThreshold is the least score worth listing as a candidate
+	candidateThreshold = 0.4
+	// maxCandidates caps how many candidates are listed
+	maxCandidates = 5
+	// DefaultTTL is how long a datasource's partners and source tags are cached
+	DefaultTTL = 5 * time.Minute
+)
+
+// Querier runs queries against named datasources; *db.Manager implements it
+type Querier interface {
+	QueryValues(ctx context.Context, datasource, query string, args ...interface{}) (*db.Result, error)
+}
+
+// Partner is a partner and the other names it goes by
+type Partner struct {
+	ID      int64
+	Name    string
+	Aliases []string
+}
+
+// Candidate is a partner that might be the one meant
+type Candidate struct {
+	Partner
+	Score float64
+	// Via says what matched: "id", "name", "alias" or "fuzzy"
+	Via string
+	// Matched is the name or alias that matched
+	Matched string
+}
+
+// Resolution is the outcome of resolving a name
+type Resolution struct {
+	Input string
+	// Status is Resolved, Ambiguous or NotFound
+	Status string
+	// Partner is the partner meant, when resolved
+	Partner *Candidate
+	// Candidates are the closest partners, best first; when ambiguous these
+	// are the ones to choose between
+	Candidates []Candidate
+}
+
+// idPattern matches a partner given by ID, e.g. "42", "#42" or "id 42"
+var idPattern = regexp.MustCompile(`(?i)^\s*(?:#|id[\s:#]*|partner\s+(?:id\s*)?#?)?(\d+)\s*$`)
+
+// Match resolves input against partners. An ID or an exact name or alias wins
+// outright; otherwise the best fuzzy match is used if it's good enough and
+// clearly ahead of the rest.
+func Match(partners []Partner, input string) *Resolution {
+	res := &Resolution{Input: input, Status: NotFound}
+
+	if m := idPattern.FindStringSubmatch(input); m != nil {
+		id, _ := strconv.ParseInt(m[1], 10, 64)
+		for _, p := range partners {
+			if p.ID == id {
+				c := Candidate{Partner: p, Score: 1, Via: "id", Matched: m[1]}
+				res.Status, res.Partner, res.Candidates = Resolved, &c, []Candidate{c}
+				return res
+			}
+		}
+	}
+
+	normalized := normalizeName(input)
+	if c, ok := exactMatch(partners, normalized); ok {
+		res.Status, res.Partner, res.Candidates = Resolved, &c, []Candidate{c}
+		return res
+	}
+
+	var candidates []Candidate
+	for _, p := range partners {
+		c := Candidate{Partner: p, Score: similarity(normalized, normalizeName(p.Name)), Via: "name", Matched: p.Name}
+		for _, alias := range p.Aliases {
+			if s := similarity(normalized, normalizeName(alias)); s > c.Score {
+				c.Score, c.Via, c.Matched = s, "alias", alias
+			}
+		}
+		if c.Score < 1 {
+			c.Via = "fuzzy"
+		}
+		if c.Score >= candidateThreshold {
+			candidates = append(candidates, c)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Score > candidates[j].Score
+	})
+	if len(candidates) > maxCandidates {
+		candidates = candidates[:maxCandidates]
+	}
+	res.Candidates = candidates
+
+	if len(candidates) == 0 || candidates[0].Score < MatchThreshold {
+		return res
+	}
+	if len(candidates) > 1 && candidates[0].Score-candidates[1].Score < Margin {
+		res.Status = Ambiguous
+		// Only the ones close to the top are real contenders
+		var close []Candidate
+		for _, c := range candidates {
+			if candidates[0].Score-c.Score < Margin {
+				close = append(close, c)
+			}
+		}
+		res.Candidates = close
+		return res
+	}
+
+	best := candidates[0]
+	res.Status, res.Partner = Resolved, &best
+	return res
+}
+
+// exactMatch finds the one partner whose name or an alias normalizes to
+// normalized. Two partners sharing it is left to the fuzzy match to report as
+// ambiguous.
+func exactMatch(partners []Partner, normalized string) (Candidate, bool) {
+	var (
+		match Candidate
+		found int
+	)
+	for _, p := range partners {
+		if normalized != "" && normalizeName(p.Name) == normalized {
+			match, found = Candidate{Partner: p, Score: 1, Via: "name", Matched: p.Name}, found+1
+			continue
+		}
+		for _, alias := range p.Aliases {
+			if normalized != "" && normalizeName(alias) == normalized {
+				match, found = Candidate{Partner: p, Score: 1, Via: "alias", Matched: alias}, found+1
+				break
+			}
+		}
+	}
+	return match, found == 1
+}
+
+// PartnerResolver resolves partner names against each datasource's
+// partners.partners table and partners.partner_aliases, if it has one. The
+// lists are cached for DefaultTTL.
+type PartnerResolver struct {
+	dbs   Querier
+	cache *cache[[]Partner]
+}
+
+// NewPartnerResolver returns a resolver loading partners through dbs
+func NewPartnerResolver(dbs Querier) *PartnerResolver {
+	r := &PartnerResolver{dbs: dbs}
+	r.cache = newCache(DefaultTTL, r.load)
+	return r
+}
+
+// Resolve resolves input against the datasource's partners
+func (r *PartnerResolver) Resolve(ctx context.Context, datasource, input string) (*Resolution, error) {
+	partners, err := r.Partners(ctx, datasource)
+	if err != nil {
+		return nil, err
+	}
+	return Match(partners, input), nil
+}
+
+// Partners returns the datasource's partners, loading them if the cached list
+// is missing or stale
+func (r *PartnerResolver) Partners(ctx context.Context, datasource string) ([]Partner, error) {
+	return r.cache.get(ctx, datasource)
+}
+
+// load reads the partners and their aliases
+func (r *PartnerResolver) load(ctx context.Context, datasource string) ([]Partner, error) {
+	result, err := r.dbs.QueryValues(ctx, datasource, `SELECT id, name FROM partners.partners ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load partners: %v", err)
+	}
+
+	var partners []Partner
+	byID := make(map[int64]int)
+	for _, row := range result.Rows {
+		id, ok := toInt64(row[0])
+		name, _ := row[1].(string)
+		if !ok {
+			continue
+		}
+		byID[id] = len(partners)
+		partners = append(partners, Partner{ID: id, Name: name})
+	}
+
+	// Aliases are optional; not every database has the table
+	aliases, err := r.dbs.QueryValues(ctx, datasource, `SELECT partner_id, alias FROM partners.partner_aliases`)
+	if err != nil {
+		log.Printf("No partner aliases for %s: %v\n", datasource, err)
+		return partners, nil
+	}
+	for _, row := range aliases.Rows {
+		id, ok := toInt64(row[0])
+		alias, _ := row[1].(string)
+		if i, found := byID[id]; ok && found && alias != "" {
+			partners[i].Aliases = append(partners[i].Aliases, alias)
+		}
+	}
+	return partners, nil
+}
+
+// toInt64 converts the integer types a driver may return
+func toInt64(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return n, true
+	case int32:
+		return int64(n), true
+	case int:
+		return int64(n), true
+	case int16:
+		return int64(n), true
+	case float64:
+		return int64(n), true
+	}
+	return 0, false
+}
@@ -0,0 +1,121 @@
+package entity
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/dnc-data-mcp/db/dbtest"
+)
+
+var testPartners = []Partner{
+	{ID: 1, Name: "DNC", Aliases: []string{"dnc.io"}},
+	{ID: 2, Name: "Acme Media LLC"},
+	{ID: 3, Name: "Bluefin Media", Aliases: []string{"BFM"}},
+	{ID: 4, Name: "Harbor Apps", Aliases: []string{"Harbor Mobile Apps LLC"}},
+	{ID: 5, Name: "Orchid Search"},
+	{ID: 6, Name: "Orchid Search 2"},
+}
+
+func TestMatch(t *testing.T) {
+	testCases := []struct {
+		input  string
+		status string
+		id     int64
+		via    string
+	}{
+		{"DNC", Resolved, 1, "name"},
+		{"dnc", Resolved, 1, "name"},
+		{"DNC.io", Resolved, 1, "alias"},
+		{"acme", Resolved, 2, "fuzzy"},
+		{"Acme Media", Resolved, 2, "name"},
+		{"acme meda", Resolved, 2, "fuzzy"},
+		{"Bluefn Media", Resolved, 3, "fuzzy"},
+		{"bfm", Resolved, 3, "alias"},
+		{"harbor mobile apps", Resolved, 4, "alias"},
+		{"#5", Resolved, 5, "id"},
+		{"id 4", Resolved, 4, "id"},
+		{"orchid", Ambiguous, 0, ""},
+		{"media", Ambiguous, 0, ""},
+		{"zebra", NotFound, 0, ""},
+	}
+
+	for _, tc := range testCases {
+		res := Match(testPartners, tc.input)
+		if res.Status != tc.status {
+			t.Errorf("Match(%q) is %s, expected %s", tc.input, res.Status, tc.status)
+			continue
+		}
+		if tc.status != Resolved {
+			if res.Partner != nil {
+				t.Errorf("Match(%q) picked %+v, expected no partner", tc.input, res.Partner)
+			}
+			if tc.status == Ambiguous && len(res.Candidates) < 2 {
+				t.Errorf("Match(%q) is ambiguous but lists %d candidates", tc.input, len(res.Candidates))
+			}
+			continue
+		}
+		if res.Partner == nil || res.Partner.ID != tc.id || res.Partner.Via != tc.via {
+			t.Errorf("Match(%q) = %+v, expected partner %d via %s", tc.input, res.Partner, tc.id, tc.via)
+		}
+	}
+}
+
+func TestMatchNearDuplicates(t *testing.T) {
+	partners := []Partner{
+		{ID: 1, Name: "Acme Media"},
+		{ID: 2, Name: "Acme Medias", Aliases: []string{"Acme"}},
+		{ID: 3, Name: "Orchid"},
+		{ID: 4, Name: "Orchid LLC"},
+	}
+	testCases := []struct {
+		input  string
+		status string
+		id     int64
+		via    string
+	}{
+		// Names a typo apart from each other still win when given exactly
+		{"Acme Media", Resolved, 1, "name"},
+		{"acme medias", Resolved, 2, "name"},
+		{"ACME", Resolved, 2, "alias"},
+		// Two partners with the same name can't be told apart
+		{"orchid", Ambiguous, 0, ""},
+	}
+
+	for _, tc := range testCases {
+		res := Match(partners, tc.input)
+		if res.Status != tc.status {
+			t.Errorf("Match(%q) is %s, expected %s", tc.input, res.Status, tc.status)
+			continue
+		}
+		if tc.status == Resolved && (res.Partner == nil || res.Partner.ID != tc.id || res.Partner.Via != tc.via) {
+			t.Errorf("Match(%q) = %+v, expected partner %d via %s", tc.input, res.Partner, tc.id, tc.via)
+		}
+	}
+}
+
+func TestPartnerResolver(t *testing.T) {
+	fake := dbtest.New().
+		On("from partners.partners", dbtest.Result(
+			[]string{"id", "name"},
+			[]interface{}{int64(1), "DNC"},
+			[]interface{}{int32(2), "Acme Media LLC"},
+		)).
+		OnError("from partners.partner_aliases", errors.New(`relation "partners.partner_aliases" does not exist`))
+	resolver := NewPartnerResolver(fake)
+
+	for i := 0; i < 2; i++ {
+		res, err := resolver.Resolve(context.Background(), "ro-traffic", "acme")
+		if err != nil {
+			t.Fatalf("Failed to resolve: %v", err)
+		}
+		if res.Partner == nil || res.Partner.ID != 2 {
+			t.Errorf("Expected Acme Media LLC, got %+v", res)
+		}
+	}
+
+	// The second lookup is served from the cache
+	if calls := fake.Calls(); len(calls) != 2 {
+		t.Errorf("Expected the partners and aliases to be loaded once, got %d queries", len(calls))
+	}
+}
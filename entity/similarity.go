@@ -0,0 +1,127 @@
+package entity
+
+import (
+	"regexp"
+	"strings"
+)
+
+// legalSuffixes are dropped when comparing names, so "Acme Media LLC" and
+// "Acme Media" are the same name
+var legalSuffixes = map[string]bool{
+	"llc": true, "inc": true, "ltd": true, "limited": true, "co": true, "corp": true,
+	"corporation": true, "company": true, "gmbh": true, "plc": true, "sa": true, "bv": true,
+}
+
+var nonAlnum = regexp.MustCompile(`[^a-z0-9]+`)
+
+// normalizeName lowercases name, turns punctuation into spaces and drops
+// legal suffixes and a leading "the"
+func normalizeName(name string) string {
+	words := strings.Fields(nonAlnum.ReplaceAllString(strings.ToLower(name), " "))
+	for len(words) > 1 && legalSuffixes[words[len(words)-1]] {
+		words = words[:len(words)-1]
+	}
+	if len(words) > 1 && words[0] == "the" {
+		words = words[1:]
+	}
+	return strings.Join(words, " ")
+}
+
+// similarity scores how alike two normalized names are, from 0 to 1. It takes
+// the best of trigram similarity (as pg_trgm computes it), edit distance
+// (which forgives typos) and word prefixes (so "acme" finds "acme media").
+func similarity(input, name string) float64 {
+	if input == "" || name == "" {
+		return 0
+	}
+	if input == name {
+		return 1
+	}
+
+	best := trigramSimilarity(input, name)
+	if s := editSimilarity(input, name); s > best {
+		best = s
+	}
+	if s := prefixSimilarity(input, name); s > best {
+		best = s
+	}
+	return best
+}
+
+// trigramSimilarity is the share of distinct trigrams the two strings have in
+// common, with each word padded by two spaces in front and one behind
+func trigramSimilarity(a, b string) float64 {
+	ta, tb := trigrams(a), trigrams(b)
+	if len(ta) == 0 || len(tb) == 0 {
+		return 0
+	}
+	shared := 0
+	for t := range ta {
+		if tb[t] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(ta)+len(tb)-shared)
+}
+
+func trigrams(s string) map[string]bool {
+	set := make(map[string]bool)
+	for _, word := range strings.Fields(s) {
+		padded := "  " + word + " "
+		for i := 0; i+3 <= len(padded); i++ {
+			set[padded[i:i+3]] = true
+		}
+	}
+	return set
+}
+
+// editSimilarity is 1 minus the Levenshtein distance over the longer length
+func editSimilarity(a, b string) float64 {
+	longest := len(a)
+	if len(b) > longest {
+		longest = len(b)
+	}
+	return 1 - float64(levenshtein(a, b))/float64(longest)
+}
+
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+// prefixSimilarity scores input's words each starting one of name's words in
+// order, e.g. "acme" or "acme med" in "acme media". The more of name that's
+// covered the higher the score, up to 0.9 so an exact name still wins.
+func prefixSimilarity(input, name string) float64 {
+	in, words := strings.Fields(input), strings.Fields(name)
+	j := 0
+	for _, w := range in {
+		for j < len(words) && !strings.HasPrefix(words[j], w) {
+			j++
+		}
+		if j == len(words) {
+			return 0
+		}
+		j++
+	}
+	// Very short prefixes match too much to count for much
+	if len(input) < 3 {
+		return 0
+	}
+	return 0.7 + 0.2*float64(len(input))/float64(len(name))
+}
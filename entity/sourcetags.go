@@ -0,0 +1,251 @@
+package entity
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Source tag search modes
+const (
+	// ModeAny tries every kind of match and ranks them together
+	ModeAny = ""
+	// ModePrefix matches tags whose name, or a word of it, starts with the text
+	ModePrefix = "prefix"
+	// ModeSubstring matches tags whose name contains the text
+	ModeSubstring = "substring"
+	// ModeFuzzy matches tags whose name or words are close to the text
+	ModeFuzzy = "fuzzy"
+)
+
+// SearchModes lists the valid search modes
+var SearchModes = []string{ModePrefix, ModeSubstring, ModeFuzzy}
+
+const (
+	// DefaultSearchLimit is how many tags a search returns unless told otherwise
+	DefaultSearchLimit = 20
+	// fuzzyThreshold is the least similarity a fuzzy match needs
+	fuzzyThreshold = 0.7
+)
+
+// SourceTag is a row of yer_analysis.source_tags along with the partner whose
+// traffic it carries. Tags only belong to partners through the items reported
+// for them, so a tag that was never reported has no partner.
+type SourceTag struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	PartnerID   int64  `json:"partner_id,omitempty"`
+	PartnerName string `json:"partner_name,omitempty"`
+}
+
+// SourceTagQuery describes which tags to find. Every field is optional; an
+// empty query lists every tag up to the limit.
+type SourceTagQuery struct {
+	// Text is matched against tag names, e.g. "bing" or "acme_search_disp"
+	Text string
+	// Mode restricts how Text may match; ModeAny allows every kind
+	Mode string
+	// IDs limits the search to these tags
+	IDs []int64
+	// PartnerID limits the search to one partner's tags
+	PartnerID int64
+	// Limit caps the results; DefaultSearchLimit if 0
+	Limit int
+}
+
+// SourceTagMatch is a tag found by a search
+type SourceTagMatch struct {
+	SourceTag
+	Score float64 `json:"score"`
+	// Match says how the text matched: "exact", "id", "prefix", "substring" or
+	// "fuzzy"; empty when there was no text
+	Match string `json:"match,omitempty"`
+}
+
+// SearchSourceTags returns the tags matching q, best first, then by name
+func SearchSourceTags(tags []SourceTag, q SourceTagQuery) []SourceTagMatch {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+	ids := make(map[int64]bool, len(q.IDs))
+	for _, id := range q.IDs {
+		ids[id] = true
+	}
+	text := normalizeTag(q.Text)
+
+	var matches []SourceTagMatch
+	for _, tag := range tags {
+		if len(ids) > 0 && !ids[tag.ID] {
+			continue
+		}
+		if q.PartnerID != 0 && tag.PartnerID != q.PartnerID {
+			continue
+		}
+		if text == "" {
+			matches = append(matches, SourceTagMatch{SourceTag: tag, Score: 1})
+			continue
+		}
+		score, how := matchTag(text, normalizeTag(tag.Name), q.Mode)
+		// A tag's ID typed as the text counts too
+		if q.Mode == ModeAny && text == fmt.Sprint(tag.ID) {
+			score, how = 1, "id"
+		}
+		if score > 0 {
+			matches = append(matches, SourceTagMatch{SourceTag: tag, Score: score, Match: how})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return matches[i].Name < matches[j].Name
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches
+}
+
+// matchTag scores text against a normalized tag name, allowing the kinds of
+// match mode permits. Exact beats prefix beats substring beats fuzzy.
+func matchTag(text, name, mode string) (float64, string) {
+	all := mode == ModeAny
+	words := strings.Fields(name)
+
+	if name == text {
+		return 1, "exact"
+	}
+	if all || mode == ModePrefix {
+		if strings.HasPrefix(name, text) {
+			return 0.95, "prefix"
+		}
+		if prefixSimilarity(text, name) > 0 {
+			return 0.9, "prefix"
+		}
+	}
+	if all || mode == ModeSubstring {
+		if strings.Contains(name, text) {
+			return 0.8, "substring"
+		}
+		// Each word of the text somewhere in the name, e.g. "bing acme"
+		found := true
+		for _, w := range strings.Fields(text) {
+			if !strings.Contains(name, w) {
+				found = false
+				break
+			}
+		}
+		if found {
+			return 0.75, "substring"
+		}
+	}
+	if all || mode == ModeFuzzy {
+		best := similarity(text, name)
+		// Also compare word by word, so a misspelt word or two in a long tag
+		// name still finds it; every word of the text has to be close to one
+		// of the name's
+		if s := wordSimilarity(strings.Fields(text), words); s > best {
+			best = s
+		}
+		if best >= fuzzyThreshold {
+			return 0.7 * best, "fuzzy"
+		}
+	}
+	return 0, ""
+}
+
+// wordSimilarity is the worst, over the text's words, of each word's best edit
+// similarity to one of the name's words. Words under three letters are
+// skipped as too short to judge.
+func wordSimilarity(text, name []string) float64 {
+	worst, compared := 1.0, false
+	for _, tw := range text {
+		if len(tw) < 3 {
+			continue
+		}
+		best := 0.0
+		for _, w := range name {
+			if s := editSimilarity(tw, w); s > best {
+				best = s
+			}
+		}
+		worst, compared = math.Min(worst, best), true
+	}
+	if !compared {
+		return 0
+	}
+	return worst
+}
+
+// normalizeTag lowercases a tag name and turns underscores, dashes and other
+// punctuation into spaces, so words can be matched separately
+func normalizeTag(name string) string {
+	return strings.Join(strings.Fields(nonAlnum.ReplaceAllString(strings.ToLower(name), " ")), " ")
+}
+
+// SourceTagIndex is a cached, searchable list of each datasource's source
+// tags. Traffic sources are source tags too, so it answers for both.
+type SourceTagIndex struct {
+	dbs   Querier
+	cache *cache[[]SourceTag]
+}
+
+// NewSourceTagIndex returns an index loading tags through dbs
+func NewSourceTagIndex(dbs Querier) *SourceTagIndex {
+	idx := &SourceTagIndex{dbs: dbs}
+	idx.cache = newCache(DefaultTTL, idx.load)
+	return idx
+}
+
+// Search finds the datasource's tags matching q
+func (idx *SourceTagIndex) Search(ctx context.Context, datasource string, q SourceTagQuery) ([]SourceTagMatch, error) {
+	tags, err := idx.SourceTags(ctx, datasource)
+	if err != nil {
+		return nil, err
+	}
+	return SearchSourceTags(tags, q), nil
+}
+
+// SourceTags returns every tag of the datasource, loading them if the cached
+// list is missing or stale
+func (idx *SourceTagIndex) SourceTags(ctx context.Context, datasource string) ([]SourceTag, error) {
+	return idx.cache.get(ctx, datasource)
+}
+
+// load reads the tags with their partners. A tag's partner is the one that
+// last reported items for it in v_yer_items.
+func (idx *SourceTagIndex) load(ctx context.Context, datasource string) ([]SourceTag, error) {
+	result, err := idx.dbs.QueryValues(ctx, datasource, `
+		SELECT st.id, st.name, owner.partner_id, coalesce(p.name, '') as partner_name
+		FROM yer_analysis.source_tags st
+		LEFT JOIN LATERAL (
+			SELECT yi.partner_id
+			FROM yer_analysis.v_yer_items yi
+			WHERE yi.sourcetag_id = st.id
+			ORDER BY yi.end_date DESC, yi.yer_report_id DESC
+			LIMIT 1
+		) owner ON true
+		LEFT JOIN partners.partners p ON owner.partner_id = p.id
+		ORDER BY st.id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load source tags: %v", err)
+	}
+
+	var tags []SourceTag
+	for _, row := range result.Rows {
+		id, ok := toInt64(row[0])
+		if !ok {
+			continue
+		}
+		partnerID, _ := toInt64(row[2])
+		name, _ := row[1].(string)
+		partnerName, _ := row[3].(string)
+		tags = append(tags, SourceTag{ID: id, Name: name, PartnerID: partnerID, PartnerName: partnerName})
+	}
+	return tags, nil
+}
@@ -0,0 +1,99 @@
+package entity
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/dnc-data-mcp/db/dbtest"
+)
+
+var testTags = []SourceTag{
+	{ID: 10, Name: "acme_search_bing_display", PartnerID: 2, PartnerName: "Acme Media LLC"},
+	{ID: 11, Name: "acme_search_bing_mobile", PartnerID: 2, PartnerName: "Acme Media LLC"},
+	{ID: 12, Name: "acme_search_yahoo", PartnerID: 2, PartnerName: "Acme Media LLC"},
+	{ID: 20, Name: "dnc_display", PartnerID: 1, PartnerName: "DNC"},
+	{ID: 21, Name: "dnc_bing_newtab", PartnerID: 1, PartnerName: "DNC"},
+	{ID: 30, Name: "bluefin_toolbar", PartnerID: 3, PartnerName: "Bluefin Media"},
+}
+
+func TestSearchSourceTags(t *testing.T) {
+	testCases := []struct {
+		name  string
+		query SourceTagQuery
+		ids   []int64
+		match string
+	}{
+		{"Everything", SourceTagQuery{}, []int64{10, 11, 12, 30, 21, 20}, ""},
+		{"Exact", SourceTagQuery{Text: "dnc_display"}, []int64{20}, "exact"},
+		// The yahoo tag is close enough to come last as a fuzzy match
+		{"Name Prefix", SourceTagQuery{Text: "acme_search_b"}, []int64{10, 11, 12}, "prefix"},
+		{"Name Prefix Only", SourceTagQuery{Text: "acme_search_b", Mode: ModePrefix}, []int64{10, 11}, "prefix"},
+		{"Misspelt Words", SourceTagQuery{Text: "acme serch yaho"}, []int64{12}, "fuzzy"},
+		{"Word Prefix", SourceTagQuery{Text: "tool", Mode: ModePrefix}, []int64{30}, "prefix"},
+		{"Bing For A Partner", SourceTagQuery{Text: "bing", PartnerID: 2}, []int64{10, 11}, "prefix"},
+		{"Substring", SourceTagQuery{Text: "search_bing", Mode: ModeSubstring}, []int64{10, 11}, "substring"},
+		{"Substring Only", SourceTagQuery{Text: "tool", Mode: ModeSubstring}, []int64{30}, "substring"},
+		{"Fuzzy", SourceTagQuery{Text: "yahooo"}, []int64{12}, "fuzzy"},
+		{"Fuzzy Off", SourceTagQuery{Text: "yahooo", Mode: ModePrefix}, nil, ""},
+		{"By ID", SourceTagQuery{IDs: []int64{21, 30}}, []int64{30, 21}, ""},
+		{"ID As Text", SourceTagQuery{Text: "12"}, []int64{12}, "id"},
+		{"Limit", SourceTagQuery{Text: "bing", Limit: 2}, []int64{10, 11}, "prefix"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			matches := SearchSourceTags(testTags, tc.query)
+			var ids []int64
+			for _, m := range matches {
+				ids = append(ids, m.ID)
+			}
+			t.Logf("%+v: %v", tc.query, ids)
+			if len(ids) != len(tc.ids) {
+				t.Fatalf("Expected tags %v, got %v", tc.ids, ids)
+			}
+			for i := range ids {
+				if ids[i] != tc.ids[i] {
+					t.Fatalf("Expected tags %v, got %v", tc.ids, ids)
+				}
+			}
+			if len(matches) > 0 && matches[0].Match != tc.match {
+				t.Errorf("Expected a %q match, got %q", tc.match, matches[0].Match)
+			}
+		})
+	}
+}
+
+func TestSourceTagIndex(t *testing.T) {
+	fake := dbtest.New().On("from yer_analysis.source_tags", dbtest.Result(
+		[]string{"id", "name", "partner_id", "partner_name"},
+		[]interface{}{int32(10), "acme_search_bing_display", int32(2), "Acme Media LLC"},
+		[]interface{}{int32(20), "dnc_display", int32(1), "DNC"},
+		// Never reported, so no partner
+		[]interface{}{int32(30), "spare_display", nil, ""},
+	))
+	idx := NewSourceTagIndex(fake)
+
+	for i := 0; i < 2; i++ {
+		matches, err := idx.Search(context.Background(), "ro-traffic", SourceTagQuery{Text: "display", PartnerID: 1})
+		if err != nil {
+			t.Fatalf("Failed to search: %v", err)
+		}
+		if len(matches) != 1 || matches[0].ID != 20 || matches[0].PartnerName != "DNC" {
+			t.Errorf("Expected dnc_display, got %+v", matches)
+		}
+	}
+	calls := fake.Calls()
+	if len(calls) != 1 {
+		t.Fatalf("Expected the tags to be loaded once, got %d queries", len(calls))
+	}
+	// Tags belong to partners through their items; source_tags has no partner
+	if sql := calls[0].SQL; !strings.Contains(sql, "yi.sourcetag_id = st.id") || strings.Contains(sql, "st.partner_id") {
+		t.Errorf("Expected each tag's partner to come from v_yer_items, got:\n%s", sql)
+	}
+
+	matches, _ := idx.Search(context.Background(), "ro-traffic", SourceTagQuery{Text: "spare"})
+	if len(matches) != 1 || matches[0].PartnerID != 0 || matches[0].PartnerName != "" {
+		t.Errorf("Expected spare_display without a partner, got %+v", matches)
+	}
+}
@@ -0,0 +1,147 @@
+// Command fixturegen writes the DNC reporting schema and deterministic fake
+// data as SQL, or loads it straight into a local Postgres
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dnc-data-mcp/fixtures"
+	"github.com/jackc/pgx/v5"
+)
+
+func main() {
+	var opts fixtures.Options
+	flag.Int64Var(&opts.Seed, "seed", 1, "random seed; the same seed and options always give the same data")
+	flag.IntVar(&opts.Partners, "partners", 12, "number of partners")
+	flag.IntVar(&opts.Months, "months", 12, "number of monthly reports")
+	flag.IntVar(&opts.MaxTagsPerPartner, "tags", 4, "maximum source tags per partner")
+	end := flag.String("end", "", "month after the last report, as YYYY-MM (default the current month)")
+	output := flag.String("o", "", "file to write the SQL to (default stdout)")
+	dsn := flag.String("dsn", "", "load into this database instead of writing SQL; existing fixture tables are dropped")
+	yesDrop := flag.Bool("yes-drop", false, "confirm that -dsn may drop and recreate the partners and yer_analysis tables")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	// The script drops tables named like production's, so loading needs
+	// saying twice
+	if *dsn != "" && !*yesDrop {
+		fmt.Fprintf(os.Stderr, "-dsn drops and recreates %s; pass -yes-drop too if that's what you want\n",
+			strings.Join(fixtures.Tables, ", "))
+		os.Exit(2)
+	}
+
+	if *end != "" {
+		t, err := time.Parse("2006-01", *end)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -end %q: use YYYY-MM\n", *end)
+			os.Exit(2)
+		}
+		opts.End = t
+	}
+
+	// Generate the data
+	dataset := fixtures.Generate(opts)
+	var script bytes.Buffer
+	if err := dataset.WriteSQL(&script); err != nil {
+		fmt.Fprintf(os.Stderr, "Error generating SQL: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *dsn != "" {
+		if err := load(*dsn, script.String()); err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading fixtures: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "Loaded %d partners, %d source tags, %d reports and %d items\n",
+			len(dataset.Partners), len(dataset.SourceTags), len(dataset.Reports), len(dataset.Items))
+		return
+	}
+
+	// Write the SQL
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating output file: %v\n", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		w = f
+	}
+	if _, err := script.WriteTo(w); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing SQL: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// load runs the script against the database in dsn
+func load(dsn, script string) error {
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		return fmt.Errorf("error connecting to database: %v", err)
+	}
+	defer conn.Close(ctx)
+
+	if err := checkTarget(ctx, conn); err != nil {
+		return err
+	}
+
+	// The script has many statements, which only the simple protocol allows
+	if _, err := conn.PgConn().Exec(ctx, script).ReadAll(); err != nil {
+		return fmt.Errorf("error running fixture script: %v", err)
+	}
+	return nil
+}
+
+// checkTarget refuses a database whose fixture tables hold data, unless an
+// earlier load marked it as a fixture database; on anything else those tables
+// are likely real
+func checkTarget(ctx context.Context, conn *pgx.Conn) error {
+	var marked bool
+	err := conn.QueryRow(ctx, `
+		SELECT coalesce(
+			obj_description(to_regnamespace('partners'), 'pg_namespace') = $1 AND
+			obj_description(to_regnamespace('yer_analysis'), 'pg_namespace') = $1,
+			false)
+	`, fixtures.Marker).Scan(&marked)
+	if err != nil {
+		return fmt.Errorf("error checking the target database: %v", err)
+	}
+	if marked {
+		return nil
+	}
+
+	var withData []string
+	for _, table := range fixtures.Tables {
+		var exists bool
+		if err := conn.QueryRow(ctx, "SELECT to_regclass($1) IS NOT NULL", table).Scan(&exists); err != nil {
+			return fmt.Errorf("error checking %s: %v", table, err)
+		}
+		if !exists {
+			continue
+		}
+		var hasRows bool
+		if err := conn.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM "+table+")").Scan(&hasRows); err != nil {
+			return fmt.Errorf("error checking %s: %v", table, err)
+		}
+		if hasRows {
+			withData = append(withData, table)
+		}
+	}
+	if len(withData) > 0 {
+		return fmt.Errorf("refusing to drop %s: they hold data and fixturegen didn't create them; use an empty or fixture-only database",
+			strings.Join(withData, ", "))
+	}
+	return nil
+}
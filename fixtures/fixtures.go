@@ -0,0 +1,266 @@
+// Package fixtures generates a fake copy of the DNC reporting schema with
+// deterministic seeded data, so tests and demos never touch production
+package fixtures
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Options controls the size and shape of the generated data
+type Options struct {
+	// Seed makes the data reproducible; the same options always give the same data
+	Seed int64
+	// Partners is how many partners to create; defaults to 12
+	Partners int
+	// Months is how many monthly reports to create; defaults to 12
+	Months int
+	// MaxTagsPerPartner caps the source tags each partner gets; defaults to 4
+	MaxTagsPerPartner int
+	// End is a date in the month after the last report, so with the default of
+	// the current month the latest report is "last month"
+	End time.Time
+}
+
+// PartnerStatus is a row of partners.partner_status
+type PartnerStatus struct {
+	ID     int
+	Status string
+}
+
+// Partner is a row of partners.partners
+type Partner struct {
+	ID        int
+	Name      string
+	Status    int
+	CreatedAt time.Time
+}
+
+// PartnerAlias is a row of partners.partner_aliases, another name a partner
+// goes by
+type PartnerAlias struct {
+	PartnerID int
+	Alias     string
+}
+
+// SourceTag is a row of yer_analysis.source_tags. PartnerID isn't a column;
+// it's the partner whose items are reported under the tag.
+type SourceTag struct {
+	ID        int
+	Name      string
+	PartnerID int
+}
+
+// Report is a row of yer_analysis.yer_reports, one per month
+type Report struct {
+	ID        int
+	Name      string
+	StartDate time.Time
+	EndDate   time.Time
+}
+
+// Item is a row of yer_analysis.yer_items: one source tag's traffic in one report
+type Item struct {
+	ID             int
+	ReportID       int
+	PartnerID      int
+	SourceTagID    int
+	TotalSearches  int64
+	TotalClicks    int64
+	Amount         float64
+	TrafficQuality float64
+}
+
+// Dataset is a complete set of generated rows
+type Dataset struct {
+	Statuses   []PartnerStatus
+	Partners   []Partner
+	Aliases    []PartnerAlias
+	SourceTags []SourceTag
+	Reports    []Report
+	Items      []Item
+}
+
+// Partner statuses, matching the ids production uses
+const (
+	StatusActive  = 1
+	StatusPaused  = 2
+	StatusChurned = 3
+)
+
+var statuses = []PartnerStatus{
+	{StatusActive, "active"},
+	{StatusPaused, "paused"},
+	{StatusChurned, "churned"},
+}
+
+// partnerNames are used in order; DNC is always first so the canned "which
+// source tags does DNC use" queries have something to find
+var partnerNames = []string{
+	"DNC", "Acme Search", "Bluefin Media", "Cobalt Networks", "Driftwood Digital",
+	"Ember Ads", "Foxglove Traffic", "Granite Publishing", "Harbor Apps",
+	"Ironbark Labs", "Juniper Portals", "Kestrel Mobile", "Lumen Toolbars",
+	"Marlin Browsers", "Nimbus Extensions", "Orchid Search",
+}
+
+// partnerAliases are other names some partners go by, such as their legal
+// names, so alias lookups have something to find
+var partnerAliases = map[string][]string{
+	"DNC":           {"dnc.io"},
+	"Acme Search":   {"Acme Search Inc"},
+	"Bluefin Media": {"BFM"},
+	"Harbor Apps":   {"Harbour Apps", "Harbor Mobile Apps LLC"},
+}
+
+var tagKinds = []string{"search", "display", "toolbar", "mobile", "extension", "newtab"}
+
+// Generate builds a dataset from opts. Partners have a base traffic quality and
+// size; each month's TQ wanders around the base so month-over-month queries
+// find both risers and fallers.
+func Generate(opts Options) *Dataset {
+	if opts.Partners <= 0 {
+		opts.Partners = 12
+	}
+	if opts.Months <= 0 {
+		opts.Months = 12
+	}
+	if opts.MaxTagsPerPartner <= 0 {
+		opts.MaxTagsPerPartner = 4
+	}
+	if opts.End.IsZero() {
+		opts.End = time.Now()
+	}
+	rng := rand.New(rand.NewSource(opts.Seed))
+
+	d := &Dataset{Statuses: append([]PartnerStatus(nil), statuses...)}
+	endMonth := time.Date(opts.End.Year(), opts.End.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	// Monthly reports, oldest first, ending the month before End
+	for i := opts.Months; i >= 1; i-- {
+		start := endMonth.AddDate(0, -i, 0)
+		d.Reports = append(d.Reports, Report{
+			ID:        len(d.Reports) + 1,
+			Name:      "YER " + start.Format("2006-01"),
+			StartDate: start,
+			EndDate:   start.AddDate(0, 1, -1),
+		})
+	}
+
+	// Partners with their tags and traffic profile
+	type profile struct {
+		tq     float64
+		volume float64
+		// Reports before joined and from left on have no traffic
+		joined, left int
+	}
+	profiles := make(map[int]profile)
+	for i := 0; i < opts.Partners; i++ {
+		name := partnerName(i)
+		p := Partner{ID: i + 1, Name: name, Status: StatusActive}
+
+		prof := profile{
+			tq:     3 + rng.Float64()*6,
+			volume: math.Exp(10 + rng.Float64()*4),
+			left:   opts.Months,
+		}
+		// A few partners join partway through or have churned or paused
+		switch r := rng.Float64(); {
+		case i == 0:
+		case r < 0.15:
+			p.Status = StatusChurned
+			prof.left = opts.Months/2 + rng.Intn(opts.Months-opts.Months/2)
+		case r < 0.25:
+			p.Status = StatusPaused
+			prof.left = opts.Months - 1
+		case r < 0.4:
+			prof.joined = rng.Intn(opts.Months/2 + 1)
+		}
+		p.CreatedAt = endMonth.AddDate(0, -opts.Months+prof.joined, -rng.Intn(60))
+		d.Partners = append(d.Partners, p)
+		profiles[p.ID] = prof
+		for _, alias := range partnerAliases[name] {
+			d.Aliases = append(d.Aliases, PartnerAlias{PartnerID: p.ID, Alias: alias})
+		}
+
+		tags := 1 + rng.Intn(opts.MaxTagsPerPartner)
+		for _, k := range rng.Perm(len(tagKinds))[:min(tags, len(tagKinds))] {
+			d.SourceTags = append(d.SourceTags, SourceTag{
+				ID:        len(d.SourceTags) + 1,
+				Name:      tagName(name, tagKinds[k]),
+				PartnerID: p.ID,
+			})
+		}
+	}
+
+	// Monthly traffic per source tag
+	tagTQ := make(map[int]float64)
+	for _, tag := range d.SourceTags {
+		tagTQ[tag.ID] = clamp(profiles[tag.PartnerID].tq+rng.NormFloat64(), 1, 10)
+	}
+	for ri, r := range d.Reports {
+		for _, tag := range d.SourceTags {
+			prof := profiles[tag.PartnerID]
+			if ri < prof.joined || ri >= prof.left {
+				continue
+			}
+
+			// TQ drifts month to month
+			tagTQ[tag.ID] = clamp(tagTQ[tag.ID]+rng.NormFloat64()*0.6, 1, 10)
+			tq := round(tagTQ[tag.ID], 2)
+
+			searches := int64(prof.volume * (0.6 + rng.Float64()*0.8))
+			ctr := 0.02 + tq/10*0.08
+			clicks := int64(float64(searches) * ctr * (0.8 + rng.Float64()*0.4))
+			rpc := 0.05 + tq/10*0.45
+
+			d.Items = append(d.Items, Item{
+				ID:             len(d.Items) + 1,
+				ReportID:       r.ID,
+				PartnerID:      tag.PartnerID,
+				SourceTagID:    tag.ID,
+				TotalSearches:  searches,
+				TotalClicks:    clicks,
+				Amount:         round(float64(clicks)*rpc, 2),
+				TrafficQuality: tq,
+			})
+		}
+	}
+
+	return d
+}
+
+// partnerName returns the i'th partner name, numbering repeats once the list
+// runs out
+func partnerName(i int) string {
+	if i < len(partnerNames) {
+		return partnerNames[i]
+	}
+	return fmt.Sprintf("%s %d", partnerNames[i%len(partnerNames)], i/len(partnerNames)+1)
+}
+
+// tagName builds a source tag name such as "acme_search_display"
+func tagName(partner, kind string) string {
+	name := make([]byte, 0, len(partner)+len(kind)+1)
+	for _, c := range []byte(partner) {
+		switch {
+		case c >= 'A' && c <= 'Z':
+			name = append(name, c+'a'-'A')
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9':
+			name = append(name, c)
+		default:
+			name = append(name, '_')
+		}
+	}
+	return string(name) + "_" + kind
+}
+
+func clamp(v, lo, hi float64) float64 {
+	return math.Max(lo, math.Min(hi, v))
+}
+
+func round(v float64, places int) float64 {
+	scale := math.Pow(10, float64(places))
+	return math.Round(v*scale) / scale
+}
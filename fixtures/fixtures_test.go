@@ -0,0 +1,124 @@
+package fixtures
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testEnd = time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)
+
+func TestGenerateDeterministic(t *testing.T) {
+	t.Parallel()
+
+	a := Generate(Options{Seed: 7, End: testEnd})
+	b := Generate(Options{Seed: 7, End: testEnd})
+	if !reflect.DeepEqual(a, b) {
+		t.Error("Expected the same seed to give the same data")
+	}
+
+	c := Generate(Options{Seed: 8, End: testEnd})
+	if reflect.DeepEqual(a.Items, c.Items) {
+		t.Error("Expected a different seed to give different data")
+	}
+}
+
+func TestGenerateShape(t *testing.T) {
+	t.Parallel()
+	d := Generate(Options{Seed: 1, Partners: 20, Months: 6, End: testEnd})
+
+	if len(d.Partners) != 20 || len(d.Reports) != 6 {
+		t.Fatalf("Expected 20 partners and 6 reports, got %d and %d", len(d.Partners), len(d.Reports))
+	}
+	if d.Partners[0].Name != "DNC" {
+		t.Errorf("Expected DNC to be the first partner, got %q", d.Partners[0].Name)
+	}
+
+	// The latest report is the month before End
+	last := d.Reports[len(d.Reports)-1]
+	if last.StartDate.Format("2006-01-02") != "2024-02-01" || last.EndDate.Format("2006-01-02") != "2024-02-29" {
+		t.Errorf("Unexpected last report: %+v", last)
+	}
+
+	// Every reference points at a real row, and values are in range
+	partners := make(map[int]bool)
+	for _, p := range d.Partners {
+		partners[p.ID] = true
+	}
+	for _, a := range d.Aliases {
+		if !partners[a.PartnerID] || a.Alias == "" {
+			t.Errorf("Alias %+v has an unknown partner or no name", a)
+		}
+	}
+	if len(d.Aliases) == 0 {
+		t.Error("Expected some partner aliases")
+	}
+
+	tags := make(map[int]int)
+	names := make(map[string]bool)
+	for _, tag := range d.SourceTags {
+		if !partners[tag.PartnerID] {
+			t.Errorf("Source tag %d has unknown partner %d", tag.ID, tag.PartnerID)
+		}
+		if names[tag.Name] {
+			t.Errorf("Duplicate source tag name %q", tag.Name)
+		}
+		names[tag.Name] = true
+		tags[tag.ID] = tag.PartnerID
+	}
+	for _, it := range d.Items {
+		if tags[it.SourceTagID] != it.PartnerID {
+			t.Errorf("Item %d's source tag %d doesn't belong to partner %d", it.ID, it.SourceTagID, it.PartnerID)
+		}
+		if it.ReportID < 1 || it.ReportID > len(d.Reports) {
+			t.Errorf("Item %d has unknown report %d", it.ID, it.ReportID)
+		}
+		if it.TrafficQuality < 1 || it.TrafficQuality > 10 || it.TotalClicks > it.TotalSearches || it.Amount < 0 {
+			t.Errorf("Item %d has implausible values: %+v", it.ID, it)
+		}
+	}
+}
+
+func TestWriteSQL(t *testing.T) {
+	t.Parallel()
+	d := Generate(Options{Seed: 1, Partners: 2, Months: 1, End: testEnd})
+	d.Partners[1].Name = "O'Brien Media"
+
+	var buf bytes.Buffer
+	if err := d.WriteSQL(&buf); err != nil {
+		t.Fatalf("Failed to write SQL: %v", err)
+	}
+	script := buf.String()
+
+	for _, want := range []string{
+		"CREATE VIEW yer_analysis.v_yer_items",
+		"INSERT INTO partners.partners (id, name, status, created_at) VALUES",
+		"'O''Brien Media'",
+		"INSERT INTO partners.partner_aliases (partner_id, alias) VALUES",
+		"INSERT INTO yer_analysis.source_tags (id, name) VALUES",
+		"(1, 'YER 2024-02', '2024-02-01', '2024-02-29');",
+		"COMMENT ON SCHEMA yer_analysis IS 'dnc-data-mcp fixtures';",
+		"COMMIT;",
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("Expected the script to contain %q", want)
+		}
+	}
+}
+
+func TestSchemaTables(t *testing.T) {
+	t.Parallel()
+	// fixturegen checks Tables for data before loading, so they must be
+	// every table Schema drops
+	var dropped []string
+	for _, line := range strings.Split(Schema, "\n") {
+		if table := strings.TrimPrefix(line, "DROP TABLE IF EXISTS "); table != line {
+			dropped = append(dropped, strings.TrimSuffix(table, ";"))
+		}
+	}
+	if strings.Join(dropped, ",") != strings.Join(Tables, ",") {
+		t.Errorf("Schema drops %v, but Tables lists %v", dropped, Tables)
+	}
+}
@@ -0,0 +1,89 @@
+package fixtures
+
+// Marker is the comment Schema leaves on its schemas, so fixturegen can tell a
+// database it loaded before from a real one
+const Marker = "dnc-data-mcp fixtures"
+
+// Tables are the tables Schema drops and recreates
+var Tables = []string{
+	"yer_analysis.yer_items",
+	"yer_analysis.yer_reports",
+	"yer_analysis.source_tags",
+	"partners.partner_aliases",
+	"partners.partners",
+	"partners.partner_status",
+}
+
+// Schema creates the tables the service queries, shaped like production: the
+// partners schema with partner aliases, and yer_analysis with its reports,
+// source tags and the v_yer_items view the canned queries read from
+const Schema = `CREATE SCHEMA IF NOT EXISTS partners;
+CREATE SCHEMA IF NOT EXISTS yer_analysis;
+
+DROP VIEW IF EXISTS yer_analysis.v_yer_items;
+DROP TABLE IF EXISTS yer_analysis.yer_items;
+DROP TABLE IF EXISTS yer_analysis.yer_reports;
+DROP TABLE IF EXISTS yer_analysis.source_tags;
+DROP TABLE IF EXISTS partners.partner_aliases;
+DROP TABLE IF EXISTS partners.partners;
+DROP TABLE IF EXISTS partners.partner_status;
+
+CREATE TABLE partners.partner_status (
+	id     integer PRIMARY KEY,
+	status text NOT NULL
+);
+
+CREATE TABLE partners.partners (
+	id         integer PRIMARY KEY,
+	name       text NOT NULL,
+	status     integer NOT NULL REFERENCES partners.partner_status (id),
+	created_at date NOT NULL
+);
+
+CREATE TABLE partners.partner_aliases (
+	partner_id integer NOT NULL REFERENCES partners.partners (id),
+	alias      text NOT NULL,
+	PRIMARY KEY (partner_id, alias)
+);
+
+CREATE TABLE yer_analysis.source_tags (
+	id   integer PRIMARY KEY,
+	name text NOT NULL UNIQUE
+);
+
+CREATE TABLE yer_analysis.yer_reports (
+	id         integer PRIMARY KEY,
+	name       text NOT NULL,
+	start_date date NOT NULL,
+	end_date   date NOT NULL
+);
+
+CREATE TABLE yer_analysis.yer_items (
+	id              integer PRIMARY KEY,
+	yer_report_id   integer NOT NULL REFERENCES yer_analysis.yer_reports (id),
+	partner_id      integer NOT NULL REFERENCES partners.partners (id),
+	sourcetag_id    integer NOT NULL REFERENCES yer_analysis.source_tags (id),
+	total_searches  bigint NOT NULL,
+	total_clicks    bigint NOT NULL,
+	amount          numeric(12, 2) NOT NULL,
+	traffic_quality numeric(4, 2) NOT NULL
+);
+
+CREATE VIEW yer_analysis.v_yer_items AS
+SELECT
+	yi.id,
+	yi.yer_report_id,
+	yi.partner_id,
+	yi.sourcetag_id,
+	r.start_date,
+	r.end_date,
+	yi.total_searches,
+	yi.total_clicks,
+	yi.amount,
+	yi.traffic_quality
+FROM yer_analysis.yer_items yi
+JOIN yer_analysis.yer_reports r ON yi.yer_report_id = r.id;
+
+COMMENT ON SCHEMA partners IS '` + Marker + `';
+COMMENT ON SCHEMA yer_analysis IS '` + Marker + `';
+`
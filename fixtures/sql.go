@@ -0,0 +1,98 @@
+package fixtures
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// insertBatch is how many rows go in each INSERT statement
+const insertBatch = 500
+
+// WriteSQL writes the schema followed by INSERT statements for every row, as
+// a script psql can run in a single transaction
+func (d *Dataset) WriteSQL(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintf(bw, "-- Generated by fixturegen; safe to drop and recreate\nBEGIN;\n\n%s\n", Schema)
+
+	statuses := make([][]string, len(d.Statuses))
+	for i, s := range d.Statuses {
+		statuses[i] = []string{strconv.Itoa(s.ID), quote(s.Status)}
+	}
+	writeInserts(bw, "partners.partner_status", "id, status", statuses)
+
+	partners := make([][]string, len(d.Partners))
+	for i, p := range d.Partners {
+		partners[i] = []string{strconv.Itoa(p.ID), quote(p.Name), strconv.Itoa(p.Status), date(p.CreatedAt)}
+	}
+	writeInserts(bw, "partners.partners", "id, name, status, created_at", partners)
+
+	aliases := make([][]string, len(d.Aliases))
+	for i, a := range d.Aliases {
+		aliases[i] = []string{strconv.Itoa(a.PartnerID), quote(a.Alias)}
+	}
+	writeInserts(bw, "partners.partner_aliases", "partner_id, alias", aliases)
+
+	tags := make([][]string, len(d.SourceTags))
+	for i, t := range d.SourceTags {
+		tags[i] = []string{strconv.Itoa(t.ID), quote(t.Name)}
+	}
+	writeInserts(bw, "yer_analysis.source_tags", "id, name", tags)
+
+	reports := make([][]string, len(d.Reports))
+	for i, r := range d.Reports {
+		reports[i] = []string{strconv.Itoa(r.ID), quote(r.Name), date(r.StartDate), date(r.EndDate)}
+	}
+	writeInserts(bw, "yer_analysis.yer_reports", "id, name, start_date, end_date", reports)
+
+	items := make([][]string, len(d.Items))
+	for i, it := range d.Items {
+		items[i] = []string{
+			strconv.Itoa(it.ID),
+			strconv.Itoa(it.ReportID),
+			strconv.Itoa(it.PartnerID),
+			strconv.Itoa(it.SourceTagID),
+			strconv.FormatInt(it.TotalSearches, 10),
+			strconv.FormatInt(it.TotalClicks, 10),
+			strconv.FormatFloat(it.Amount, 'f', 2, 64),
+			strconv.FormatFloat(it.TrafficQuality, 'f', 2, 64),
+		}
+	}
+	writeInserts(bw, "yer_analysis.yer_items",
+		"id, yer_report_id, partner_id, sourcetag_id, total_searches, total_clicks, amount, traffic_quality", items)
+
+	fmt.Fprintf(bw, "COMMIT;\n")
+	return bw.Flush()
+}
+
+// writeInserts writes rows as multi-row INSERT statements
+func writeInserts(w io.Writer, table, columns string, rows [][]string) {
+	for start := 0; start < len(rows); start += insertBatch {
+		end := start + insertBatch
+		if end > len(rows) {
+			end = len(rows)
+		}
+		fmt.Fprintf(w, "INSERT INTO %s (%s) VALUES\n", table, columns)
+		for i, row := range rows[start:end] {
+			sep := ","
+			if start+i == end-1 {
+				sep = ";"
+			}
+			fmt.Fprintf(w, "\t(%s)%s\n", strings.Join(row, ", "), sep)
+		}
+		fmt.Fprintf(w, "\n")
+	}
+}
+
+// quote returns s as a SQL string literal
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+func date(t time.Time) string {
+	return "'" + t.Format("2006-01-02") + "'"
+}
@@ -0,0 +1,128 @@
+// Package intent works out which question a user is asking and pulls out the
+// values it needs, such as the partner, metric, time range and limit
+package intent
+
+import (
+	"sort"
+	"time"
+)
+
+// DefaultThreshold is the confidence a match needs before it's acted on
+const DefaultThreshold = 0.6
+
+// Group is a set of interchangeable terms, any one of which counts. Terms are
+// canonical words after synonym replacement, e.g. "revenue" also matches
+// "money", "earned" and "income".
+type Group struct {
+	Terms  []string
+	Weight float64
+}
+
+// Intent is a kind of question the service knows how to answer
+type Intent struct {
+	Name        string
+	Description string
+	// Example is a typical phrasing, shown when suggesting intents
+	Example string
+	// Groups are scored against the question; the share of weight matched is
+	// the confidence
+	Groups []Group
+	// Required lists slots the intent can't run without, e.g. "partner"
+	Required []string
+}
+
+// Match is an intent scored against a question, with the slots found in it
+type Match struct {
+	Intent     *Intent
+	Confidence float64
+	Slots      Slots
+	// Missing lists required slots that weren't found
+	Missing []string
+}
+
+// Router scores questions against a set of intents
+type Router struct {
+	Intents []*Intent
+	// Threshold is the confidence a match needs; defaults to DefaultThreshold
+	Threshold float64
+	// Now returns the current time, which relative time ranges such as "last
+	// month" are based on; defaults to time.Now
+	Now func() time.Time
+}
+
+// NewRouter returns a router over the given intents
+func NewRouter(intents ...*Intent) *Router {
+	return &Router{Intents: intents, Threshold: DefaultThreshold, Now: time.Now}
+}
+
+// Route scores the question against every intent. It returns the best match
+// if it clears the threshold and has all its required slots, along with every
+// intent that matched at all, best first, for suggestions.
+func (r *Router) Route(question string) (*Match, []Match) {
+	now := time.Now()
+	if r.Now != nil {
+		now = r.Now()
+	}
+	threshold := r.Threshold
+	if threshold == 0 {
+		threshold = DefaultThreshold
+	}
+
+	slots, tokens := extractSlots(question, now)
+
+	var matches []Match
+	for _, in := range r.Intents {
+		confidence := score(in, tokens)
+		if confidence == 0 {
+			continue
+		}
+		m := Match{Intent: in, Confidence: confidence, Slots: slots}
+		for _, slot := range in.Required {
+			if !slots.Has(slot) {
+				m.Missing = append(m.Missing, slot)
+			}
+		}
+		// A question missing something the intent needs is less likely to be
+		// that intent
+		if len(m.Missing) > 0 {
+			m.Confidence *= 0.8
+		}
+		matches = append(matches, m)
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Confidence > matches[j].Confidence
+	})
+
+	if len(matches) == 0 || matches[0].Confidence < threshold {
+		return nil, matches
+	}
+	return &matches[0], matches
+}
+
+// score returns the share of the intent's weight whose groups appear in tokens
+func score(in *Intent, tokens []string) float64 {
+	present := make(map[string]bool, len(tokens))
+	for _, t := range tokens {
+		present[t] = true
+	}
+
+	var total, matched float64
+	for _, g := range in.Groups {
+		weight := g.Weight
+		if weight == 0 {
+			weight = 1
+		}
+		total += weight
+		for _, term := range g.Terms {
+			if present[term] {
+				matched += weight
+				break
+			}
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return matched / total
+}
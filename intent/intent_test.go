@@ -0,0 +1,129 @@
+package intent
+
+import (
+	"testing"
+	"time"
+)
+
+var testNow = time.Date(2024, time.March, 15, 10, 0, 0, 0, time.UTC)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func TestRoute(t *testing.T) {
+	router := NewRouter(
+		&Intent{
+			Name: "top_partners",
+			Groups: []Group{
+				{Terms: []string{"partner"}},
+				{Terms: []string{"revenue"}, Weight: 2},
+				{Terms: []string{"top"}, Weight: 2},
+			},
+		},
+		&Intent{
+			Name: "partner_source_tags",
+			Groups: []Group{
+				{Terms: []string{"sourcetag"}, Weight: 2},
+				{Terms: []string{"use"}},
+			},
+			Required: []string{"partner"},
+		},
+	)
+	router.Now = func() time.Time { return testNow }
+
+	testCases := []struct {
+		question string
+		intent   string
+		missing  int
+		matches  int
+	}{
+		{"Which partner made the most money last month?", "top_partners", 0, 1},
+		{"what partner earned the most in September?", "top_partners", 0, 1},
+		{"Which source-tags does Acme Search use?", "partner_source_tags", 0, 1},
+		{"which source tags are used", "partner_source_tags", 1, 1},
+		{"what's the weather like?", "", 0, 0},
+		{"show me some partners", "", 0, 1},
+	}
+
+	for _, tc := range testCases {
+		best, matches := router.Route(tc.question)
+		t.Logf("%q: %d matches", tc.question, len(matches))
+		if len(matches) != tc.matches {
+			t.Errorf("Route(%q) returned %d matches, expected %d", tc.question, len(matches), tc.matches)
+		}
+		if tc.intent == "" {
+			if best != nil {
+				t.Errorf("Route(%q) matched %s, expected no match", tc.question, best.Intent.Name)
+			}
+			continue
+		}
+		if best == nil || best.Intent.Name != tc.intent {
+			t.Errorf("Route(%q) = %+v, expected %s", tc.question, best, tc.intent)
+			continue
+		}
+		if len(best.Missing) != tc.missing {
+			t.Errorf("Route(%q) is missing %v, expected %d slots", tc.question, best.Missing, tc.missing)
+		}
+	}
+}
+
+func TestExtractSlots(t *testing.T) {
+	testCases := []struct {
+		question string
+		partner  string
+		metric   string
+		limit    int
+		start    time.Time
+	}{
+		{"which source tags does DNC use", "DNC", "", 0, time.Time{}},
+		{"What traffic sources does Acme Search use?", "Acme Search", "", 0, time.Time{}},
+		{"revenue for partner \"Big Co\" last month", "Big Co", "revenue", 0, date(2024, time.February, 1)},
+		{"show clicks for Acme Search in january", "Acme Search", "clicks", 0, date(2024, time.January, 1)},
+		{"what is DNC's revenue this year?", "DNC", "revenue", 0, date(2024, time.January, 1)},
+		{"top 3 partners by searches over the last 2 weeks", "", "searches", 3, date(2024, time.March, 2)},
+		{"top ten partners for last month", "", "", 10, date(2024, time.February, 1)},
+		{"which partner made the most money in September?", "", "revenue", 0, date(2023, time.September, 1)},
+		{"top 5 partners by click-through rate this year", "", "ctr", 5, date(2024, time.January, 1)},
+		{"best revenue per thousand searches last month", "", "rpm", 0, date(2024, time.February, 1)},
+		{"what is DNC's rpc this year?", "DNC", "rpc", 0, date(2024, time.January, 1)},
+	}
+
+	for _, tc := range testCases {
+		slots, _ := extractSlots(tc.question, testNow)
+		if slots.Partner != tc.partner || slots.Metric != tc.metric || slots.Limit != tc.limit {
+			t.Errorf("extractSlots(%q) = %+v, expected partner %q, metric %q, limit %d",
+				tc.question, slots, tc.partner, tc.metric, tc.limit)
+		}
+		var start time.Time
+		if slots.TimeRange != nil {
+			start = slots.TimeRange.Start
+		}
+		if !start.Equal(tc.start) {
+			t.Errorf("extractSlots(%q) starts at %v, expected %v", tc.question, start, tc.start)
+		}
+	}
+}
+
+func TestCleanPartner(t *testing.T) {
+	testCases := []struct {
+		name    string
+		now     time.Time
+		partner string
+	}{
+		{`"Acme Search"?`, testNow, "Acme Search"},
+		{"the Acme Search", testNow, "Acme Search"},
+		{"last month", testNow, ""},
+		{"every partner", testNow, ""},
+		// A date still to come isn't a time range yet, so whether this is one
+		// depends on the router's clock rather than the machine's
+		{"since 2024-04-01", testNow, "since 2024-04-01"},
+		{"since 2024-04-01", testNow.AddDate(0, 1, 0), ""},
+	}
+
+	for _, tc := range testCases {
+		if partner := cleanPartner(tc.name, tc.now); partner != tc.partner {
+			t.Errorf("cleanPartner(%q) on %s = %q, expected %q", tc.name, tc.now.Format("2006-01-02"), partner, tc.partner)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package intent
+
+import (
+	"regexp"
+	"strings"
+)
+
+// phrases are multi-word synonyms, replaced before splitting into words
+var phrases = []struct {
+	pattern *regexp.Regexp
+	term    string
+}{
+	{regexp.MustCompile(`\bsource[\s_-]*tags?\b`), "sourcetag"},
+	{regexp.MustCompile(`\btraffic\s+sources?\b`), "trafficsource"},
+	{regexp.MustCompile(`\btraffic\s+quality\b`), "tq"},
+	{regexp.MustCompile(`\bclick[\s-]*through(?:\s+rates?)?\b`), "ctr"},
+	{regexp.MustCompile(`\b(?:revenue|rev|money)\s+per\s+(?:thousand|mille|1000|1k)(?:\s+searches)?\b`), "rpm"},
+	{regexp.MustCompile(`\b(?:revenue|rev|money)\s+per\s+click\b`), "rpc"},
+	{regexp.MustCompile(`\byield\s+enhancement\s+reports?\b`), "yer"},
+	{regexp.MustCompile(`\b(?:went|gone|go|goes|moved)\s+up\b`), "increase"},
+	{regexp.MustCompile(`\b(?:went|gone|go|goes|moved)\s+down\b`), "decrease"},
+}
+
+// synonyms map words to the canonical terms intents are written in
+var synonyms = map[string]string{
+	"partners": "partner", "publisher": "partner", "publishers": "partner",
+	"customer": "partner", "customers": "partner", "client": "partner", "clients": "partner",
+
+	"money": "revenue", "earned": "revenue", "earn": "revenue", "earns": "revenue",
+	"earning": "revenue", "earnings": "revenue", "made": "revenue", "make": "revenue",
+	"income": "revenue", "amount": "revenue", "paid": "revenue", "payout": "revenue", "rev": "revenue",
+
+	"most": "top", "highest": "top", "best": "top", "biggest": "top", "largest": "top",
+	"leading": "top", "max": "top",
+
+	"increased": "increase", "increases": "increase", "improved": "increase", "improve": "increase",
+	"rose": "increase", "risen": "increase", "grew": "increase", "gained": "increase",
+	"decreased": "decrease", "dropped": "decrease", "fell": "decrease", "declined": "decrease",
+
+	"quality": "tq",
+	"tag":     "sourcetag", "tags": "sourcetag",
+	"yers": "yer", "report": "yer", "reports": "yer",
+
+	"who": "list", "all": "list", "show": "list", "every": "list", "our": "list",
+	"names": "list",
+
+	"uses": "use", "using": "use", "used": "use", "have": "use", "has": "use",
+	"run": "use", "runs": "use", "send": "use", "sends": "use",
+
+	"search": "searches", "queries": "searches",
+	"click": "clicks",
+
+	"often": "frequent", "frequently": "frequent", "times": "frequent", "count": "frequent",
+}
+
+// nonWord matches anything that isn't part of a word
+var nonWord = regexp.MustCompile(`[^a-z0-9]+`)
+
+// tokenize lowercases the question, replaces synonyms with canonical terms and
+// splits it into words
+func tokenize(question string) []string {
+	text := strings.ToLower(question)
+	for _, p := range phrases {
+		text = p.pattern.ReplaceAllString(text, " "+p.term+" ")
+	}
+
+	words := strings.Fields(nonWord.ReplaceAllString(text, " "))
+	for i, w := range words {
+		if canonical, ok := synonyms[w]; ok {
+			words[i] = canonical
+		}
+	}
+	return words
+}
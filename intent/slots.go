@@ -0,0 +1,155 @@
+package intent
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dnc-data-mcp/timerange"
+)
+
+// Slots are the values pulled out of a question
+type Slots struct {
+	// Partner is the partner name as written in the question
+	Partner string
+	// PartnerID is set once Partner has been resolved to a partner
+	PartnerID int64
+	// Metric is one of "revenue", "searches", "clicks" or "tq"
+	Metric string
+	// TimeRange is nil when the question doesn't mention a period
+	TimeRange *timerange.Range
+	// Limit is how many results were asked for, or 0
+	Limit int
+}
+
+// Has reports whether the named slot was found
+func (s Slots) Has(name string) bool {
+	switch name {
+	case "partner":
+		return s.Partner != ""
+	case "metric":
+		return s.Metric != ""
+	case "time_range":
+		return s.TimeRange != nil
+	case "limit":
+		return s.Limit > 0
+	}
+	return false
+}
+
+// metrics are the canonical metric terms, in the order they're preferred when
+// a question mentions several
+var metrics = []string{"ctr", "rpm", "rpc", "revenue", "tq", "clicks", "searches"}
+
+// partnerPatterns find a partner name in a question; the first that matches wins
+var partnerPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)\b(?:partner|publisher)\s+(?:named\s+|called\s+)?["“']([^"”']+)["”']`),
+	regexp.MustCompile(`(?i)\b(?:does|do|did)\s+(.+?)\s+(?:use|using|have|has|run|send)\b`),
+	regexp.MustCompile(`(?i)\b(?:for|from)\s+(?:partner\s+)?(.+?)\s*(?:\b(?:last|this|in|during|over|since|between|vs|versus|compared|on)\b|[?.!]*$)`),
+	regexp.MustCompile(`(?i)(\S+(?:\s+\S+)?)'s\s+(?:source|traffic|revenue|tq|ctr|rpm|rpc|searches|clicks|money)`),
+}
+
+// partnerStopwords are dropped from the start of an extracted partner name
+var partnerStopwords = map[string]bool{
+	"is": true, "are": true, "was": true, "the": true, "what": true, "which": true,
+	"how": true, "did": true, "does": true, "partner": true, "publisher": true,
+}
+
+// notPartners are phrases the partner patterns catch that aren't partners
+var notPartners = map[string]bool{
+	"we": true, "they": true, "it": true, "each partner": true, "every partner": true,
+	"all partners": true, "partners": true, "the month": true, "the year": true,
+}
+
+var limitPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)\b(?:top|first|best|worst|bottom)\s+(\d+|` + numberWords + `)\b`),
+	regexp.MustCompile(`(?i)\b(\d+|` + numberWords + `)\s+(?:partners?|publishers?|source\s*tags?|tags|sources|results|rows)\b`),
+}
+
+const numberWords = "one|two|three|four|five|six|seven|eight|nine|ten|twenty|fifty|hundred"
+
+var numbers = map[string]int{
+	"one": 1, "two": 2, "three": 3, "four": 4, "five": 5, "six": 6, "seven": 7,
+	"eight": 8, "nine": 9, "ten": 10, "twenty": 20, "fifty": 50, "hundred": 100,
+}
+
+// extractSlots finds every slot the question fills. It also returns the
+// question's tokens with the partner name left out, so a partner called "Acme
+// Search" isn't taken as asking about searches.
+func extractSlots(question string, now time.Time) (Slots, []string) {
+	var s Slots
+	s.Partner = extractPartner(question, now)
+	s.Limit = extractLimit(question)
+	s.TimeRange = timerange.Parse(question, now)
+
+	rest := question
+	if s.Partner != "" {
+		rest = strings.Replace(question, s.Partner, " ", 1)
+	}
+	tokens := tokenize(rest)
+	for _, m := range metrics {
+		if contains(tokens, m) {
+			s.Metric = m
+			break
+		}
+	}
+	return s, tokens
+}
+
+func extractPartner(question string, now time.Time) string {
+	for _, p := range partnerPatterns {
+		m := p.FindStringSubmatch(question)
+		if m == nil {
+			continue
+		}
+		if name := cleanPartner(m[1], now); name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+// cleanPartner trims quotes, punctuation and leading filler words, and rejects
+// phrases that are really time ranges as of now, or pronouns
+func cleanPartner(name string, now time.Time) string {
+	words := strings.Fields(strings.Trim(name, ` "'“”?.!,`))
+	for len(words) > 0 && partnerStopwords[strings.ToLower(words[0])] {
+		words = words[1:]
+	}
+	name = strings.Join(words, " ")
+	lower := strings.ToLower(name)
+	if name == "" || notPartners[lower] || timerange.Parse(lower, now) != nil {
+		return ""
+	}
+	// "revenue for last month" and the like name a metric, not a partner
+	if tokens := tokenize(lower); len(tokens) == 1 && contains(metrics, tokens[0]) {
+		return ""
+	}
+	return name
+}
+
+func extractLimit(question string) int {
+	for _, p := range limitPatterns {
+		m := p.FindStringSubmatch(question)
+		if m == nil {
+			continue
+		}
+		if n, err := strconv.Atoi(m[1]); err == nil {
+			return n
+		}
+		if n, ok := numbers[strings.ToLower(m[1])]; ok {
+			return n
+		}
+	}
+	return 0
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
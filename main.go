@@ -1,44 +1,106 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/dnc-data-mcp/config"
 	"github.com/dnc-data-mcp/db"
 	"github.com/dnc-data-mcp/mcp"
-	"github.com/dnc-data-mcp/tunnel"
 	"github.com/gin-gonic/gin"
 )
 
+// configFlags collects repeated --config flags
+type configFlags []string
+
+func (c *configFlags) String() string {
+	return strings.Join(*c, ",")
+}
+
+func (c *configFlags) Set(value string) error {
+	*c = append(*c, value)
+	return nil
+}
+
+// checkConfig prints every problem with the config and returns the exit code
+func checkConfig(paths []string) int {
+	cfg, err := config.ReadConfig(paths...)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	problems := cfg.Problems()
+	if len(problems) == 0 {
+		// Only try fetching secrets once everything else checks out
+		if err := cfg.ResolveSecrets(context.Background()); err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		fmt.Printf("Config OK (connection mode: %s)\n", cfg.ConnectionMode())
+		return 0
+	}
+
+	fmt.Printf("Found %d problem(s) in the config:\n", len(problems))
+	for _, p := range problems {
+		fmt.Printf("  - %s\n", p)
+	}
+	return 1
+}
+
 func main() {
+	var configPaths configFlags
+	flag.Var(&configPaths, "config", "config file to load; repeat to layer overrides (default ~/.ssh/dnc_db_info)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [--config file]... [config check]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	// "config check" reports config problems instead of starting the service
+	if args := flag.Args(); len(args) > 0 {
+		if len(args) != 2 || args[0] != "config" || args[1] != "check" {
+			flag.Usage()
+			os.Exit(2)
+		}
+		os.Exit(checkConfig(configPaths))
+	}
+
 	// Load configuration
-	cfg, err := config.LoadConfig("")
+	cfg, err := config.LoadConfig(configPaths...)
 	if err != nil {
 		panic(err)
 	}
 
-	// Set up SSH tunnel
-	sshTunnel, err := tunnel.NewSSHTunnel(cfg)
+	// Connect to every datasource, each through its own SSH tunnel unless it
+	// selects direct mode
+	manager, err := db.NewManager(cfg)
 	if err != nil {
 		panic(err)
 	}
-	defer sshTunnel.Close()
-
-	// Create a copy of the config for the database connection
-	dbConfig := *cfg
-	// Update the database connection to use the tunnel
-	dbConfig.Database.ROTraffic.Server = "localhost"
-	dbConfig.Database.ROTraffic.Port = 5433
+	defer func() {
+		if err := manager.Close(); err != nil {
+			log.Printf("Error closing datasources: %v\n", err)
+		}
+	}()
 
-	// Initialize database connection
-	database, err := db.NewDB(&dbConfig)
+	// Create MCP service, working out time ranges in the business timezone
+	service := mcp.NewService(manager)
+	loc, err := cfg.Location()
 	if err != nil {
 		panic(err)
 	}
-	defer database.Close()
-
-	// Create MCP service
-	service := mcp.NewService(database)
+	service.SetLocation(loc)
 
 	// Set up Gin router
 	r := gin.Default()
@@ -51,7 +113,17 @@ func main() {
 			return
 		}
 
-		resp, err := service.HandleQuery(query)
+		// An explicit datasource parameter takes precedence over a
+		// "datasource:" prefix in the query. The query is cancelled if the
+		// client goes away.
+		ctx := c.Request.Context()
+		var resp *mcp.QueryResponse
+		var err error
+		if datasource := c.Query("datasource"); datasource != "" {
+			resp, err = service.HandleQueryOn(ctx, datasource, query)
+		} else {
+			resp, err = service.HandleQuery(ctx, query)
+		}
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
@@ -60,6 +132,59 @@ func main() {
 		c.JSON(http.StatusOK, resp)
 	})
 
-	// Start server
-	r.Run(":8080")
+	// Tools: list them, and call one with its JSON arguments as the body
+	r.GET("/mcp/tools", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"tools": service.Tools()})
+	})
+	r.POST("/mcp/tools/:name", func(c *gin.Context) {
+		args, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		result, err := service.CallTool(c.Request.Context(), c.Param("name"), args)
+		var unknownTool *mcp.UnknownToolError
+		var argErr *mcp.ArgumentError
+		switch {
+		case errors.As(err, &unknownTool):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.As(err, &argErr):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusOK, result)
+		}
+	})
+
+	// Metrics endpoint
+	r.GET("/metrics", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"tunnels": manager.TunnelStats(),
+			"pools":   manager.PoolStats(),
+		})
+	})
+
+	// Start server, shutting down cleanly on Ctrl-C so the deferred database
+	// and tunnel closes get to run
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	srv := &http.Server{Addr: ":8080", Handler: r}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("HTTP server error: %v\n", err)
+			stop()
+		}
+	}()
+
+	<-ctx.Done()
+	log.Printf("Shutting down\n")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Error shutting down HTTP server: %v\n", err)
+	}
 }
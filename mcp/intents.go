@@ -0,0 +1,197 @@
+package mcp
+
+import (
+	"github.com/dnc-data-mcp/intent"
+	"github.com/dnc-data-mcp/semantic"
+)
+
+// cannedQuery builds the SQL and arguments answering a matched intent, or an
+// error if the slots can't be answered. Time ranges reach the SQL as $n::date
+// parameters, never as interval arithmetic on current_date, so they follow
+// the business timezone. Metrics come from the semantic layer, so they
+// aggregate the same way here as in query_metrics.
+type cannedQuery func(slots intent.Slots) (string, []interface{}, error)
+
+// cannedIntent pairs an intent with the query that answers it
+type cannedIntent struct {
+	intent *intent.Intent
+	query  cannedQuery
+	// defaultRange is the time expression used when the question gives none;
+	// empty means the query covers all time unless a range is given
+	defaultRange string
+}
+
+// catalog lists the questions the service answers without SQL
+var catalog = []cannedIntent{
+	{
+		intent: &intent.Intent{
+			Name:        "list_partners",
+			Description: "List every partner and its status, or those active in a period",
+			Example:     "Who are our partners?",
+			Groups: []intent.Group{
+				{Terms: []string{"partner"}, Weight: 2},
+				{Terms: []string{"list"}},
+			},
+		},
+		query: func(slots intent.Slots) (string, []interface{}, error) {
+			// With a time range, only partners that appeared on a report in it
+			start, end := rangeArgs(slots)
+			return `
+				SELECT DISTINCT p.id as partner_id, p.name, p.status, ps.status as status_name
+				FROM partners.partners p
+				JOIN partners.partner_status ps ON p.status = ps.id
+				WHERE $1::date IS NULL OR EXISTS (
+					SELECT 1
+					FROM yer_analysis.v_yer_items yi
+					JOIN yer_analysis.yer_reports r ON yi.yer_report_id = r.id
+					WHERE yi.partner_id = p.id
+					AND r.end_date >= $1::date AND r.end_date < $2::date
+				)
+				ORDER BY p.name;
+			`, []interface{}{start, end}, nil
+		},
+	},
+	{
+		intent: &intent.Intent{
+			Name:        "top_partners",
+			Description: "Rank partners by revenue, searches, clicks, TQ, CTR, RPM or RPC over a period such as \"Q3\" or \"past 90 days\" (default last month)",
+			Example:     "Which partner made the most money last month?",
+			Groups: []intent.Group{
+				{Terms: []string{"partner"}},
+				{Terms: []string{"revenue", "searches", "clicks", "tq", "ctr", "rpm", "rpc"}, Weight: 2},
+				{Terms: []string{"top"}, Weight: 2},
+			},
+		},
+		defaultRange: "last month",
+		query: func(slots intent.Slots) (string, []interface{}, error) {
+			metric := slots.Metric
+			if metric == "" {
+				metric = "revenue"
+			}
+			return semantic.Compile(semantic.Query{
+				Metrics:    []string{metric},
+				Dimensions: []string{"partner"},
+				TimeRange:  slots.TimeRange,
+				Limit:      limitOr(slots, 5),
+			})
+		},
+	},
+	{
+		intent: &intent.Intent{
+			Name:        "partner_source_tags",
+			Description: "List the source tags a partner uses",
+			Example:     "Which source tags does DNC use?",
+			Groups: []intent.Group{
+				{Terms: []string{"sourcetag"}, Weight: 2},
+				{Terms: []string{"use"}},
+			},
+			Required: []string{"partner"},
+		},
+		query: func(slots intent.Slots) (string, []interface{}, error) {
+			start, end := rangeArgs(slots)
+			return `
+				SELECT DISTINCT
+					st.id as sourcetag_id,
+					st.name as sourcetag_name
+				FROM yer_analysis.v_yer_items yi
+				JOIN partners.partners p ON yi.partner_id = p.id
+				JOIN yer_analysis.source_tags st ON yi.sourcetag_id = st.id
+				JOIN yer_analysis.yer_reports r ON yi.yer_report_id = r.id
+				WHERE p.id = $1
+				AND ($2::date IS NULL OR (r.end_date >= $2::date AND r.end_date < $3::date))
+				ORDER BY st.name;
+			`, []interface{}{slots.PartnerID, start, end}, nil
+		},
+	},
+	{
+		intent: &intent.Intent{
+			Name:        "tq_increase",
+			Description: "Find source tags with real volume whose traffic quality rose compared with the period before, or week over week etc. (default last month)",
+			Example:     "Which source tags went up in TQ last month?",
+			Groups: []intent.Group{
+				{Terms: []string{"sourcetag"}},
+				{Terms: []string{"tq"}, Weight: 2},
+				{Terms: []string{"increase"}, Weight: 2},
+			},
+		},
+		defaultRange: "last month",
+		query: func(slots intent.Slots) (string, []interface{}, error) {
+			return semantic.CompileComparison(semantic.Comparison{
+				Metric:     "tq",
+				Dimensions: []string{"source_tag"},
+				Current:    *slots.TimeRange,
+				Previous:   slots.TimeRange.Baseline(),
+				Direction:  semantic.Increase,
+				Limit:      limitOr(slots, 10),
+			})
+		},
+	},
+	{
+		intent: &intent.Intent{
+			Name:        "yer_frequency",
+			Description: "Rank partners by how many yield enhancement reports they appear on (default last 6 months)",
+			Example:     "Which partners have been on the YER the most in the last 6 months?",
+			Groups: []intent.Group{
+				{Terms: []string{"yer"}, Weight: 2},
+				{Terms: []string{"partner"}},
+				{Terms: []string{"top", "frequent"}},
+			},
+		},
+		defaultRange: "last 6 months",
+		query: func(slots intent.Slots) (string, []interface{}, error) {
+			r := slots.TimeRange
+			return `
+				SELECT
+					p.id as partner_id,
+					p.name as partner_name,
+					count(distinct yi.yer_report_id) as report_count
+				FROM yer_analysis.v_yer_items yi
+				JOIN partners.partners p ON yi.partner_id = p.id
+				JOIN yer_analysis.yer_reports r ON yi.yer_report_id = r.id
+				WHERE r.end_date >= $1::date AND r.end_date < $2::date
+				GROUP BY p.id, p.name
+				ORDER BY report_count DESC
+				LIMIT $3;
+			`, []interface{}{r.Start, r.End, limitOr(slots, 10)}, nil
+		},
+	},
+	{
+		intent: &intent.Intent{
+			Name:        "partner_traffic_sources",
+			Description: "Show a partner's searches, clicks, TQ and CTR by source tag over a period (default last month)",
+			Example:     "What traffic sources does DNC use?",
+			Groups: []intent.Group{
+				{Terms: []string{"trafficsource"}, Weight: 2},
+				{Terms: []string{"use"}},
+			},
+			Required: []string{"partner"},
+		},
+		defaultRange: "last month",
+		query: func(slots intent.Slots) (string, []interface{}, error) {
+			return semantic.Compile(semantic.Query{
+				Metrics:    []string{"searches", "clicks", "tq", "ctr"},
+				Dimensions: []string{"partner", "source_tag"},
+				Filters:    map[string][]int64{"partner": {slots.PartnerID}},
+				TimeRange:  slots.TimeRange,
+				Limit:      semantic.MaxLimit,
+			})
+		},
+	},
+}
+
+// rangeArgs returns the question's time range as query arguments, or nils if
+// it has none
+func rangeArgs(slots intent.Slots) (interface{}, interface{}) {
+	if slots.TimeRange == nil {
+		return nil, nil
+	}
+	return slots.TimeRange.Start, slots.TimeRange.End
+}
+
+// limitOr returns the question's limit, or the default one
+func limitOr(slots intent.Slots, fallback int) int {
+	if slots.Limit > 0 {
+		return slots.Limit
+	}
+	return fallback
+}
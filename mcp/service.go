@@ -1,20 +1,68 @@
 package mcp
 
 import (
+	"context"
 	"fmt"
+	"regexp"
 	"strings"
+	"time"
 
 	"github.com/dnc-data-mcp/db"
+	"github.com/dnc-data-mcp/entity"
+	"github.com/dnc-data-mcp/intent"
+	"github.com/dnc-data-mcp/timerange"
 )
 
+// Querier runs queries against named datasources. *db.Manager implements it
+// against Postgres; dbtest.Fake implements it with scripted results for tests.
+type Querier interface {
+	// QueryValues runs a query against a datasource, the default one if empty
+	QueryValues(ctx context.Context, datasource, query string, args ...interface{}) (*db.Result, error)
+	// Names returns the datasource names in sorted order
+	Names() []string
+	// DefaultName returns the datasource used when none is given
+	DefaultName() string
+}
+
 // Service represents our MCP service
 type Service struct {
-	db *db.DB
+	dbs      Querier
+	router   *intent.Router
+	queries  map[string]cannedIntent
+	partners *entity.PartnerResolver
+	// sourceTags is the searchable index behind search_source_tags
+	sourceTags *entity.SourceTagIndex
+	tools      []Tool
+	// location is the business timezone time ranges are worked out in
+	location *time.Location
+}
+
+// NewService creates a new MCP service over the given datasources. Time ranges
+// are worked out in UTC until SetLocation picks the business timezone.
+func NewService(dbs Querier) *Service {
+	s := &Service{
+		dbs:        dbs,
+		router:     intent.NewRouter(),
+		queries:    make(map[string]cannedIntent),
+		partners:   entity.NewPartnerResolver(dbs),
+		sourceTags: entity.NewSourceTagIndex(dbs),
+		location:   time.UTC,
+	}
+	s.router.Now = func() time.Time {
+		return time.Now().In(s.location)
+	}
+	for _, c := range catalog {
+		s.router.Intents = append(s.router.Intents, c.intent)
+		s.queries[c.intent.Name] = c
+	}
+	s.registerTools()
+	return s
 }
 
-// NewService creates a new MCP service
-func NewService(db *db.DB) *Service {
-	return &Service{db: db}
+// SetLocation sets the business timezone, so "yesterday" and "last month"
+// follow its calendar rather than UTC's
+func (s *Service) SetLocation(loc *time.Location) {
+	s.location = loc
 }
 
 // QueryResult represents a single row from a query
@@ -22,194 +70,330 @@ type QueryResult map[string]interface{}
 
 // QueryResponse represents the response from a query
 type QueryResponse struct {
-	Columns []string      `json:"columns"`
-	Rows    []QueryResult `json:"rows"`
-	Error   string        `json:"error,omitempty"`
+	Datasource string        `json:"datasource,omitempty"`
+	Columns    []string      `json:"columns"`
+	Rows       []QueryResult `json:"rows"`
+	Error      string        `json:"error,omitempty"`
+	Meta       *QueryMeta    `json:"meta,omitempty"`
+	// Intent is the question the query was recognised as, if it wasn't SQL
+	Intent     string  `json:"intent,omitempty"`
+	Confidence float64 `json:"confidence,omitempty"`
+	// TimeRange is the period a question was answered for
+	TimeRange *TimeRange `json:"time_range,omitempty"`
+	// Suggestions are the closest questions when none matched
+	Suggestions []Suggestion `json:"suggestions,omitempty"`
+	// Partner is the partner a question was answered for, which may differ
+	// from how the question wrote it
+	Partner *PartnerMatch `json:"partner,omitempty"`
+	// Candidates are the partners a name could mean, when it matched none or
+	// several
+	Candidates []PartnerMatch `json:"candidates,omitempty"`
+}
+
+// PartnerMatch is a partner a name in a question was matched to
+type PartnerMatch struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+	// Input is the name as written in the question
+	Input string `json:"input"`
+	// Via says what matched: "id", "name", "alias" or "fuzzy"
+	Via     string  `json:"via"`
+	Matched string  `json:"matched"`
+	Score   float64 `json:"score"`
+}
+
+// newPartnerMatch describes a resolver candidate for a response
+func newPartnerMatch(input string, c entity.Candidate) PartnerMatch {
+	return PartnerMatch{ID: c.ID, Name: c.Name, Input: input, Via: c.Via, Matched: c.Matched, Score: c.Score}
+}
+
+// TimeRange is a resolved period as dates in the business timezone; End is
+// exclusive
+type TimeRange struct {
+	Label string `json:"label"`
+	Start string `json:"start"`
+	End   string `json:"end"`
+	// Compare is the period the results were compared against, if any
+	Compare *TimeRange `json:"compare,omitempty"`
+}
+
+// newTimeRange describes r for a response
+func newTimeRange(r timerange.Range) *TimeRange {
+	start, end := r.Dates()
+	t := &TimeRange{Label: r.Label, Start: start, End: end}
+	if r.Compare != nil {
+		t.Compare = newTimeRange(*r.Compare)
+	}
+	return t
+}
+
+// Suggestion is a question the service can answer, offered when a query
+// didn't match one
+type Suggestion struct {
+	Intent      string  `json:"intent"`
+	Description string  `json:"description"`
+	Example     string  `json:"example"`
+	Confidence  float64 `json:"confidence"`
+}
+
+// QueryMeta describes which host answered a query and how fresh its data was
+type QueryMeta struct {
+	Host string `json:"host"`
+	// ReplicationLagMillis is how far behind the primary the host was
+	ReplicationLagMillis int64 `json:"replication_lag_ms"`
+	// DataAsOf is when the newest data on the host was written
+	DataAsOf time.Time `json:"data_as_of"`
+}
+
+// HandleQuery handles a natural language query and returns the results. The
+// query may start with "datasource: <name>" to pick a datasource other than
+// the default.
+func (s *Service) HandleQuery(ctx context.Context, query string) (*QueryResponse, error) {
+	datasource, query := splitDatasource(query)
+	return s.HandleQueryOn(ctx, datasource, query)
+}
+
+// splitDatasource separates a leading "datasource: <name>" from the query. The
+// rest of the query may follow on the same line or the next.
+func splitDatasource(query string) (string, string) {
+	trimmed := strings.TrimSpace(query)
+	if !strings.HasPrefix(strings.ToLower(trimmed), "datasource:") {
+		return "", query
+	}
+	rest := strings.TrimSpace(trimmed[len("datasource:"):])
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return "", ""
+	}
+	return fields[0], strings.TrimSpace(strings.TrimPrefix(rest, fields[0]))
 }
 
-// HandleQuery handles a natural language query and returns the results
-func (s *Service) HandleQuery(query string) (*QueryResponse, error) {
+// HandleQueryOn handles a query against the named datasource. An empty
+// datasource means the default one, except for "show tables", which then lists
+// the tables of every datasource.
+func (s *Service) HandleQueryOn(ctx context.Context, datasource, query string) (*QueryResponse, error) {
 	// Convert query to lowercase for easier matching
 	queryLower := strings.ToLower(query)
 
 	// Handle special commands
 	if strings.HasPrefix(queryLower, "show tables") {
-		return s.handleShowTables()
+		return s.handleShowTables(ctx, datasource)
 	}
 
 	if strings.HasPrefix(queryLower, "describe table") {
-		return s.handleDescribeTable(query)
-	}
-
-	// Handle natural language queries
-	if strings.Contains(queryLower, "who are our partners") {
-		sql := `
-			SELECT DISTINCT p.id as partner_id, p.name, p.status, ps.status as status_name
-			FROM partners.partners p
-			JOIN partners.partner_status ps ON p.status = ps.id
-			ORDER BY p.name;
-		`
-		return s.executeQuery(sql)
-	}
-
-	if strings.Contains(queryLower, "which partner made the most money last month") {
-		sql := `
-			WITH last_month AS (
-				SELECT *
-				FROM yer_analysis.yer_reports
-				WHERE date_trunc('month', end_date) = date_trunc('month', current_date - interval '1 month')
-			)
-			SELECT 
-				p.id as partner_id,
-				p.name as partner_name,
-				yi.start_date,
-				yi.end_date,
-				sum(yi.amount) as total_revenue
-			FROM yer_analysis.v_yer_items yi
-			JOIN partners.partners p ON yi.partner_id = p.id
-			JOIN last_month r ON yi.yer_report_id = r.id
-			GROUP BY p.id, p.name, yi.start_date, yi.end_date
-			ORDER BY total_revenue DESC
-			LIMIT 5;
-		`
-		return s.executeQuery(sql)
-	}
-
-	if strings.Contains(queryLower, "which source tags does") && strings.Contains(queryLower, "use") {
-		// Extract partner name from query
-		parts := strings.Split(queryLower, "which source tags does")
-		if len(parts) < 2 {
-			return nil, fmt.Errorf("invalid query format")
+		return s.handleDescribeTable(ctx, datasource, query)
+	}
+
+	// SQL runs as written; anything else is a question for the router
+	if looksLikeSQL(query) {
+		return s.executeQuery(ctx, datasource, query)
+	}
+	return s.handleQuestion(ctx, datasource, query)
+}
+
+// sqlKeywords are the first words of statements that run as SQL
+var sqlKeywords = []string{"select", "with", "explain", "values", "table"}
+
+// showPattern matches SHOW as Postgres takes it: a single setting name, ALL
+// or one of the few settings spelled as several words. Questions starting
+// with "show" ("show me Acme's revenue") don't fit it.
+var showPattern = regexp.MustCompile(`^show\s+(all|time\s+zone|transaction\s+isolation\s+level|session\s+authorization|[a-z_][a-z0-9_.]*)\s*;?\s*$`)
+
+// looksLikeSQL reports whether query, once leading comments are skipped,
+// starts with a SQL keyword or is a SHOW statement
+func looksLikeSQL(query string) bool {
+	query = strings.ToLower(skipComments(query))
+	if showPattern.MatchString(query) {
+		return true
+	}
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return false
+	}
+	first := strings.TrimLeft(fields[0], "(")
+	for _, keyword := range sqlKeywords {
+		if first == keyword || strings.HasPrefix(first, keyword+"(") {
+			return true
+		}
+	}
+	return false
+}
+
+// skipComments drops the whitespace, -- line comments and /* */ block
+// comments at the start of query
+func skipComments(query string) string {
+	for {
+		query = strings.TrimSpace(query)
+		switch {
+		case strings.HasPrefix(query, "--"):
+			end := strings.IndexByte(query, '\n')
+			if end < 0 {
+				return ""
+			}
+			query = query[end+1:]
+		case strings.HasPrefix(query, "/*"):
+			end := strings.Index(query, "*/")
+			if end < 0 {
+				return ""
+			}
+			query = query[end+2:]
+		default:
+			return query
+		}
+	}
+}
+
+// handleQuestion routes a natural language question to the canned query that
+// answers it. A question that matches nothing closely enough, or lacks a value
+// the query needs, gets an error with suggestions rather than being run as SQL.
+func (s *Service) handleQuestion(ctx context.Context, datasource, question string) (*QueryResponse, error) {
+	best, matches := s.router.Route(question)
+	if best == nil {
+		return &QueryResponse{
+			Datasource:  datasource,
+			Error:       "couldn't work out what the question is asking; try one of the suggestions or send SQL",
+			Suggestions: s.suggest(matches),
+		}, nil
+	}
+
+	if len(best.Missing) > 0 {
+		return &QueryResponse{
+			Datasource: datasource,
+			Intent:     best.Intent.Name,
+			Confidence: best.Confidence,
+			Error: fmt.Sprintf("the question needs a %s, e.g. %q",
+				strings.Join(best.Missing, " and a "), best.Intent.Example),
+		}, nil
+	}
+
+	canned := s.queries[best.Intent.Name]
+	slots := best.Slots
+
+	// Names are matched loosely, so "acme" finds "Acme Media LLC"; the query
+	// then uses the partner's ID
+	var partner *PartnerMatch
+	if slots.Partner != "" {
+		name, err := s.datasourceName(datasource)
+		if err != nil {
+			return nil, err
+		}
+		res, err := s.partners.Resolve(ctx, name, slots.Partner)
+		if err != nil {
+			return &QueryResponse{Datasource: name, Intent: best.Intent.Name, Error: err.Error()}, nil
+		}
+		if res.Status != entity.Resolved {
+			return unresolvedPartner(name, best, res), nil
 		}
-		partnerPart := strings.Split(parts[1], "use")[0]
-		partnerName := strings.TrimSpace(partnerPart)
-
-		sql := `
-			SELECT DISTINCT 
-				st.id as sourcetag_id,
-				st.name as sourcetag_name
-			FROM yer_analysis.v_yer_items yi
-			JOIN partners.partners p ON yi.partner_id = p.id
-			JOIN yer_analysis.source_tags st ON yi.sourcetag_id = st.id
-			WHERE lower(p.name) = lower($1)
-			ORDER BY st.name;
-		`
-		return s.executeQuery(sql, partnerName)
-	}
-
-	if strings.Contains(queryLower, "which source tags went up in tq last month") {
-		sql := `
-			WITH last_month AS (
-				SELECT *
-				FROM yer_analysis.yer_reports
-				WHERE date_trunc('month', end_date) = date_trunc('month', current_date - interval '1 month')
-			),
-			prev_month AS (
-				SELECT *
-				FROM yer_analysis.yer_reports
-				WHERE date_trunc('month', end_date) = date_trunc('month', current_date - interval '2 month')
-			),
-			last_month_data AS (
-				SELECT 
-					st.id as sourcetag_id,
-					st.name as sourcetag_name,
-					avg(yi.traffic_quality) as traffic_quality
-				FROM yer_analysis.v_yer_items yi
-				JOIN yer_analysis.source_tags st ON yi.sourcetag_id = st.id
-				JOIN last_month lm ON yi.yer_report_id = lm.id
-				GROUP BY st.id, st.name
-			),
-			prev_month_data AS (
-				SELECT 
-					st.id as sourcetag_id,
-					avg(yi.traffic_quality) as traffic_quality
-				FROM yer_analysis.v_yer_items yi
-				JOIN yer_analysis.source_tags st ON yi.sourcetag_id = st.id
-				JOIN prev_month pm ON yi.yer_report_id = pm.id
-				GROUP BY st.id
-			)
-			SELECT 
-				curr.sourcetag_name,
-				curr.traffic_quality as current_tq,
-				prev.traffic_quality as previous_tq,
-				(curr.traffic_quality - prev.traffic_quality) as tq_change
-			FROM last_month_data curr
-			JOIN prev_month_data prev ON curr.sourcetag_id = prev.sourcetag_id
-			WHERE curr.traffic_quality > prev.traffic_quality
-			ORDER BY tq_change DESC
-			LIMIT 10;
-		`
-		return s.executeQuery(sql)
-	}
-
-	if strings.Contains(queryLower, "which partners have been on the yer the most in the last 6 months") {
-		sql := `
-			SELECT 
-				p.id as partner_id,
-				p.name as partner_name,
-				count(distinct yi.yer_report_id) as report_count
-			FROM yer_analysis.v_yer_items yi
-			JOIN partners.partners p ON yi.partner_id = p.id
-			JOIN yer_analysis.yer_reports r ON yi.yer_report_id = r.id
-			WHERE r.end_date >= current_date - interval '6 months'
-			GROUP BY p.id, p.name
-			ORDER BY report_count DESC
-			LIMIT 10;
-		`
-		return s.executeQuery(sql)
-	}
-
-	if strings.Contains(queryLower, "what traffic sources does") && strings.Contains(queryLower, "use") {
-		// Extract partner name from query
-		parts := strings.Split(queryLower, "what traffic sources does")
-		if len(parts) < 2 {
-			return nil, fmt.Errorf("invalid query format")
+		slots.PartnerID = res.Partner.ID
+		match := newPartnerMatch(slots.Partner, *res.Partner)
+		partner = &match
+	}
+	if slots.TimeRange == nil && canned.defaultRange != "" {
+		slots.TimeRange = timerange.Parse(canned.defaultRange, s.router.Now())
+	}
+
+	sql, args, err := canned.query(slots)
+	if err != nil {
+		return &QueryResponse{Datasource: datasource, Intent: best.Intent.Name, Confidence: best.Confidence, Error: err.Error()}, nil
+	}
+	resp, err := s.executeQuery(ctx, datasource, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	resp.Intent = best.Intent.Name
+	resp.Confidence = best.Confidence
+	resp.Partner = partner
+	if slots.TimeRange != nil {
+		resp.TimeRange = newTimeRange(*slots.TimeRange)
+	}
+	return resp, nil
+}
+
+// unresolvedPartner explains that the question's partner matched several
+// partners or none, listing the closest
+func unresolvedPartner(datasource string, best *intent.Match, res *entity.Resolution) *QueryResponse {
+	resp := &QueryResponse{Datasource: datasource, Intent: best.Intent.Name, Confidence: best.Confidence}
+	resp.Error, resp.Candidates = describeUnresolved(res)
+	return resp
+}
+
+// describeUnresolved returns an error message for a partner name that
+// matched several partners or none, and the closest candidates
+func describeUnresolved(res *entity.Resolution) (string, []PartnerMatch) {
+	var candidates []PartnerMatch
+	for _, c := range res.Candidates {
+		candidates = append(candidates, newPartnerMatch(res.Input, c))
+	}
+	switch {
+	case res.Status == entity.Ambiguous:
+		return fmt.Sprintf("%q could be several partners; ask again with one of the candidates' names or IDs", res.Input), candidates
+	case len(candidates) > 0:
+		return fmt.Sprintf("no partner is called %q; did you mean one of the candidates?", res.Input), candidates
+	}
+	return fmt.Sprintf("no partner is called %q", res.Input), nil
+}
+
+// maxSuggestions is how many intents a no-match response suggests
+const maxSuggestions = 3
+
+// suggest lists the closest intents, or every intent if none came close
+func (s *Service) suggest(matches []intent.Match) []Suggestion {
+	var suggestions []Suggestion
+	for _, m := range matches {
+		if len(suggestions) == maxSuggestions {
+			break
 		}
-		partnerPart := strings.Split(parts[1], "use")[0]
-		partnerName := strings.TrimSpace(partnerPart)
-
-		sql := `
-			WITH last_month AS (
-				SELECT *
-				FROM yer_analysis.yer_reports
-				WHERE date_trunc('month', end_date) = date_trunc('month', current_date - interval '1 month')
-			)
-			SELECT DISTINCT 
-				p.id as partner_id,
-				p.name as partner_name,
-				st.id as sourcetag_id,
-				st.name as sourcetag_name,
-				sum(yi.total_searches) as total_searches,
-				sum(yi.total_clicks) as total_clicks,
-				avg(yi.traffic_quality) as traffic_quality
-			FROM yer_analysis.v_yer_items yi
-			JOIN partners.partners p ON yi.partner_id = p.id
-			JOIN yer_analysis.source_tags st ON yi.sourcetag_id = st.id
-			JOIN last_month r ON yi.yer_report_id = r.id
-			WHERE lower(p.name) = lower($1)
-			GROUP BY p.id, p.name, st.id, st.name
-			ORDER BY total_searches DESC;
-		`
-		return s.executeQuery(sql, partnerName)
-	}
-
-	// If no natural language query matches, treat as direct SQL
-	return s.executeQuery(query)
+		suggestions = append(suggestions, Suggestion{
+			Intent:      m.Intent.Name,
+			Description: m.Intent.Description,
+			Example:     m.Intent.Example,
+			Confidence:  m.Confidence,
+		})
+	}
+	if len(suggestions) > 0 {
+		return suggestions
+	}
+
+	for _, in := range s.router.Intents {
+		suggestions = append(suggestions, Suggestion{
+			Intent:      in.Name,
+			Description: in.Description,
+			Example:     in.Example,
+		})
+	}
+	return suggestions
 }
 
-// handleShowTables returns a list of all tables in the database
-func (s *Service) handleShowTables() (*QueryResponse, error) {
+// handleShowTables returns a list of all tables in one datasource, or in every
+// datasource when none is given
+func (s *Service) handleShowTables(ctx context.Context, datasource string) (*QueryResponse, error) {
 	query := `
-		SELECT table_schema, table_name 
+		SELECT $1::text as datasource, table_schema, table_name 
 		FROM information_schema.tables 
 		WHERE table_schema NOT IN ('pg_catalog', 'information_schema')
 		ORDER BY table_schema, table_name
 	`
-	return s.executeQuery(query)
+	if datasource != "" {
+		return s.executeQuery(ctx, datasource, query, datasource)
+	}
+
+	combined := &QueryResponse{}
+	for _, name := range s.dbs.Names() {
+		resp, err := s.executeQuery(ctx, name, query, name)
+		if err != nil {
+			return nil, err
+		}
+		if resp.Error != "" {
+			return &QueryResponse{Datasource: name, Error: resp.Error}, nil
+		}
+		combined.Columns = resp.Columns
+		combined.Rows = append(combined.Rows, resp.Rows...)
+	}
+	return combined, nil
 }
 
 // handleDescribeTable returns the structure of a specific table
-func (s *Service) handleDescribeTable(query string) (*QueryResponse, error) {
+func (s *Service) handleDescribeTable(ctx context.Context, datasource, query string) (*QueryResponse, error) {
 	// Extract table name from query
 	parts := strings.Fields(query)
 	if len(parts) < 3 {
@@ -237,65 +421,74 @@ func (s *Service) handleDescribeTable(query string) (*QueryResponse, error) {
 		ORDER BY ordinal_position;
 	`
 
-	return s.executeQuery(sql, schema, tableName)
+	return s.executeQuery(ctx, datasource, sql, schema, tableName)
 }
 
 // handleDirectQuery executes a direct SQL query
-func (s *Service) handleDirectQuery(query string) (*QueryResponse, error) {
-	return s.executeQuery(query)
+func (s *Service) handleDirectQuery(ctx context.Context, datasource, query string) (*QueryResponse, error) {
+	return s.executeQuery(ctx, datasource, query)
 }
 
-// executeQuery executes a query and returns the results
-func (s *Service) executeQuery(query string, args ...interface{}) (*QueryResponse, error) {
-	rows, err := s.db.Query(query, args...)
+// executeQuery executes a query against a datasource and returns the results,
+// with values decoded to native JSON types. Cancelling ctx cancels the query.
+func (s *Service) executeQuery(ctx context.Context, datasource, query string, args ...interface{}) (*QueryResponse, error) {
+	datasource, err := s.datasourceName(datasource)
 	if err != nil {
-		return &QueryResponse{Error: err.Error()}, nil
+		return nil, err
 	}
-	defer rows.Close()
 
-	// Get column names
-	columns, err := rows.Columns()
+	result, err := s.dbs.QueryValues(ctx, datasource, query, args...)
 	if err != nil {
-		return &QueryResponse{Error: err.Error()}, nil
+		return &QueryResponse{Datasource: datasource, Error: err.Error()}, nil
 	}
 
-	// Create a slice to hold the values
-	values := make([]interface{}, len(columns))
-	valuePtrs := make([]interface{}, len(columns))
-	for i := range columns {
-		valuePtrs[i] = &values[i]
-	}
-
-	// Process rows
+	// Convert rows to maps keyed by column
 	var results []QueryResult
-	for rows.Next() {
-		err := rows.Scan(valuePtrs...)
-		if err != nil {
-			return &QueryResponse{Error: err.Error()}, nil
+	for _, values := range result.Rows {
+		row := make(QueryResult, len(result.Columns))
+		for i, col := range result.Columns {
+			row[col] = values[i]
 		}
+		results = append(results, row)
+	}
 
-		// Convert values to a map
-		row := make(QueryResult)
-		for i, col := range columns {
-			val := values[i]
-			switch v := val.(type) {
-			case []byte:
-				row[col] = string(v)
-			case nil:
-				row[col] = nil
-			default:
-				row[col] = v
-			}
+	resp := &QueryResponse{
+		Datasource: datasource,
+		Columns:    result.Columns,
+		Rows:       results,
+	}
+	if result.Host != "" {
+		resp.Meta = &QueryMeta{
+			Host:                 result.Host,
+			ReplicationLagMillis: result.Lag.Milliseconds(),
+			DataAsOf:             result.DataAsOf,
 		}
-		results = append(results, row)
 	}
+	return resp, nil
+}
 
-	if err := rows.Err(); err != nil {
-		return &QueryResponse{Error: err.Error()}, nil
+// datasourceName returns the datasource to use, the default one if name is
+// empty, or an error if it isn't configured
+func (s *Service) datasourceName(name string) (string, error) {
+	if name == "" {
+		name = s.dbs.DefaultName()
 	}
+	if !s.hasDatasource(name) {
+		return "", fmt.Errorf("unknown datasource: %q", name)
+	}
+	return name, nil
+}
+
+// hasDatasource reports whether name is one of the configured datasources
+func (s *Service) hasDatasource(name string) bool {
+	return contains(s.dbs.Names(), name)
+}
 
-	return &QueryResponse{
-		Columns: columns,
-		Rows:    results,
-	}, nil
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
 }
@@ -1,479 +1,415 @@
 package mcp
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
+	"strings"
 	"testing"
 	"time"
 
-	"github.com/dnc-data-mcp/config"
-	"github.com/dnc-data-mcp/db"
-	"github.com/dnc-data-mcp/tunnel"
+	"github.com/dnc-data-mcp/db/dbtest"
 )
 
-func TestMCPService(t *testing.T) {
-	// Load configuration
-	cfg, err := config.LoadConfig("")
-	if err != nil {
-		t.Fatalf("Failed to load config: %v", err)
-	}
-
-	// Set up SSH tunnel
-	sshTunnel, err := tunnel.NewSSHTunnel(cfg)
-	if err != nil {
-		t.Fatalf("Failed to create SSH tunnel: %v", err)
-	}
-	defer sshTunnel.Close()
-
-	// Wait a moment for the tunnel to be ready
-	time.Sleep(2 * time.Second)
-
-	// Update the database connection to use the tunnel
-	cfg.Database.ROTraffic.Server = "localhost"
-	cfg.Database.ROTraffic.Port = 5433
-
-	// Initialize database connection
-	database, err := db.NewDB(cfg)
-	if err != nil {
-		t.Fatalf("Failed to connect to database: %v", err)
-	}
-	defer database.Close()
-
-	// Create MCP service
-	service := NewService(database)
+// newFakeDatasources returns a fake with fixture data for the canned queries
+func newFakeDatasources() *dbtest.Fake {
+	return dbtest.New("ro-traffic", "billing").
+		On("from partners.partners p join partners.partner_status ps", dbtest.Result(
+			[]string{"partner_id", "name", "status", "status_name"},
+			[]interface{}{int64(1), "Acme Search", int64(1), "active"},
+			[]interface{}{int64(2), "DNC", int64(1), "active"},
+			[]interface{}{int64(3), "Old Partner", int64(3), "churned"},
+		)).
+		On("select id, name from partners.partners", dbtest.Result(
+			[]string{"id", "name"},
+			[]interface{}{int64(1), "Acme Search"},
+			[]interface{}{int64(2), "DNC"},
+			[]interface{}{int64(3), "Old Partner"},
+			[]interface{}{int64(4), "Orchid Search"},
+			[]interface{}{int64(5), "Orchid Search 2"},
+		)).
+		On("from partners.partner_aliases", dbtest.Result(
+			[]string{"partner_id", "alias"},
+			[]interface{}{int64(2), "dnc.io"},
+		)).
+		On("sum(yi.amount) as revenue", dbtest.Result(
+			[]string{"partner_id", "partner_name", "revenue"},
+			[]interface{}{int64(2), "DNC", 18250.75},
+			[]interface{}{int64(1), "Acme Search", 9120.5},
+		)).
+		On("st.name as sourcetag_name from yer_analysis.v_yer_items", dbtest.Result(
+			[]string{"sourcetag_id", "sourcetag_name"},
+			[]interface{}{int64(10), "dnc_display"},
+			[]interface{}{int64(11), "dnc_search"},
+		)).
+		OnDatasource("ro-traffic", "from information_schema.tables", dbtest.Result(
+			[]string{"datasource", "table_schema", "table_name"},
+			[]interface{}{"ro-traffic", "partners", "partners"},
+			[]interface{}{"ro-traffic", "yer_analysis", "yer_reports"},
+		)).
+		OnDatasource("billing", "from information_schema.tables", dbtest.Result(
+			[]string{"datasource", "table_schema", "table_name"},
+			[]interface{}{"billing", "public", "invoices"},
+		)).
+		OnDatasource("billing", "select count(*) from invoices", dbtest.Result(
+			[]string{"count"},
+			[]interface{}{int64(42)},
+		)).
+		OnError("from missing_table", errors.New(`relation "missing_table" does not exist`))
+}
 
-	// Test cases
+func TestHandleQuery(t *testing.T) {
 	testCases := []struct {
 		name     string
 		query    string
-		validate func(*testing.T, *QueryResponse)
+		validate func(*testing.T, *QueryResponse, *dbtest.Fake)
 	}{
 		{
-			name:  "Show Tables",
-			query: "show tables",
-			validate: func(t *testing.T, resp *QueryResponse) {
-				if resp.Error != "" {
-					t.Errorf("Unexpected error: %s", resp.Error)
+			name:  "List Partners",
+			query: "who are our partners",
+			validate: func(t *testing.T, resp *QueryResponse, fake *dbtest.Fake) {
+				if len(resp.Columns) != 4 || len(resp.Rows) != 3 {
+					t.Fatalf("Expected 4 columns and 3 rows, got %d and %d", len(resp.Columns), len(resp.Rows))
 				}
-				if len(resp.Columns) != 2 {
-					t.Errorf("Expected 2 columns, got %d", len(resp.Columns))
+				if resp.Rows[1]["name"] != "DNC" || resp.Rows[2]["status_name"] != "churned" {
+					t.Errorf("Unexpected partners: %+v", resp.Rows)
 				}
-				if len(resp.Rows) == 0 {
-					t.Error("Expected at least one table")
+				if resp.Datasource != "ro-traffic" {
+					t.Errorf("Expected the default datasource, got %q", resp.Datasource)
 				}
-				// Print the tables for debugging
-				jsonData, _ := json.MarshalIndent(resp, "", "  ")
-				t.Logf("Tables:\n%s", string(jsonData))
 			},
 		},
 		{
-			name:  "Describe Table",
-			query: "describe table yer_analysis.yer_reports",
-			validate: func(t *testing.T, resp *QueryResponse) {
-				if resp.Error != "" {
-					t.Errorf("Unexpected error: %s", resp.Error)
-				}
-				if len(resp.Columns) != 3 {
-					t.Errorf("Expected 3 columns, got %d", len(resp.Columns))
+			name:  "Top Revenue Partners",
+			query: "Which partner made the most money last month?",
+			validate: func(t *testing.T, resp *QueryResponse, fake *dbtest.Fake) {
+				if len(resp.Columns) != 3 || len(resp.Rows) != 2 {
+					t.Fatalf("Expected 3 columns and 2 rows, got %d and %d", len(resp.Columns), len(resp.Rows))
 				}
-				if len(resp.Rows) == 0 {
-					t.Error("Expected at least one column")
+				if resp.Rows[0]["partner_name"] != "DNC" || resp.Rows[0]["revenue"] != 18250.75 {
+					t.Errorf("Unexpected top partner: %+v", resp.Rows[0])
 				}
-				// Print the table structure for debugging
-				jsonData, _ := json.MarshalIndent(resp, "", "  ")
-				t.Logf("Table structure:\n%s", string(jsonData))
 			},
 		},
 		{
-			name:  "Query Data",
-			query: "SELECT * FROM yer_analysis.yer_reports LIMIT 2",
-			validate: func(t *testing.T, resp *QueryResponse) {
-				if resp.Error != "" {
-					t.Errorf("Unexpected error: %s", resp.Error)
+			name:  "Partner Source Tags",
+			query: "which source tags does DNC use",
+			validate: func(t *testing.T, resp *QueryResponse, fake *dbtest.Fake) {
+				if len(resp.Columns) != 2 || len(resp.Rows) != 2 {
+					t.Fatalf("Expected 2 columns and 2 rows, got %d and %d", len(resp.Columns), len(resp.Rows))
+				}
+				// The partner is looked up first, then queried by ID over all time
+				calls := fake.Calls()
+				last := calls[len(calls)-1]
+				if len(last.Args) != 3 || last.Args[0] != int64(2) || last.Args[1] != nil {
+					t.Errorf("Expected the partner ID and no time range as arguments, got %+v", last)
 				}
-				if len(resp.Rows) != 2 {
-					t.Errorf("Expected 2 rows, got %d", len(resp.Rows))
+				if resp.Partner == nil || resp.Partner.Name != "DNC" || resp.Partner.Via != "name" {
+					t.Errorf("Expected the response to say DNC was used, got %+v", resp.Partner)
 				}
-				// Print the data for debugging
-				jsonData, _ := json.MarshalIndent(resp, "", "  ")
-				t.Logf("Query results:\n%s", string(jsonData))
 			},
 		},
 		{
-			name:  "List Partners",
-			query: "who are our partners",
-			validate: func(t *testing.T, resp *QueryResponse) {
-				if resp.Error != "" {
-					t.Errorf("Unexpected error: %s", resp.Error)
+			name:  "Reworded Top Revenue Partners",
+			query: "what partner earned the most in September?",
+			validate: func(t *testing.T, resp *QueryResponse, fake *dbtest.Fake) {
+				if resp.Intent != "top_partners" || len(resp.Rows) != 2 {
+					t.Fatalf("Expected top_partners with 2 rows, got %q with %d (error %q)", resp.Intent, len(resp.Rows), resp.Error)
 				}
-				if len(resp.Columns) != 4 {
-					t.Errorf("Expected 4 columns, got %d", len(resp.Columns))
+				calls := fake.Calls()
+				september := time.Date(2023, time.September, 1, 0, 0, 0, 0, time.UTC)
+				if len(calls) != 1 || len(calls[0].Args) != 3 ||
+					calls[0].Args[0] != september || calls[0].Args[1] != september.AddDate(0, 1, 0) || calls[0].Args[2] != 5 {
+					t.Errorf("Expected last September and the default limit as arguments, got %+v", calls)
 				}
-				if len(resp.Rows) == 0 {
-					t.Error("Expected at least one partner")
+			},
+		},
+		{
+			name:  "No Matching Question",
+			query: "what's the weather like in the office?",
+			validate: func(t *testing.T, resp *QueryResponse, fake *dbtest.Fake) {
+				if resp.Error == "" || len(resp.Suggestions) == 0 {
+					t.Fatalf("Expected an error with suggestions, got %+v", resp)
+				}
+				if len(fake.Calls()) != 0 {
+					t.Errorf("Expected the question not to be run as SQL, got %+v", fake.Calls())
 				}
-				// Print the partners for debugging
-				jsonData, _ := json.MarshalIndent(resp, "", "  ")
-				t.Logf("Partners:\n%s", string(jsonData))
 			},
 		},
 		{
-			name:  "Top Revenue Partners",
-			query: "which partner made the most money last month",
-			validate: func(t *testing.T, resp *QueryResponse) {
-				if resp.Error != "" {
-					t.Errorf("Unexpected error: %s", resp.Error)
+			name:  "Close Question Suggestions",
+			query: "how did source tags do?",
+			validate: func(t *testing.T, resp *QueryResponse, fake *dbtest.Fake) {
+				if resp.Error == "" || len(resp.Suggestions) == 0 {
+					t.Fatalf("Expected an error with suggestions, got %+v", resp)
 				}
-				if len(resp.Columns) != 5 {
-					t.Errorf("Expected 5 columns, got %d", len(resp.Columns))
+				for _, s := range resp.Suggestions {
+					if s.Confidence == 0 || s.Example == "" {
+						t.Errorf("Expected scored suggestions with examples, got %+v", s)
+					}
 				}
-				if len(resp.Rows) == 0 {
-					t.Error("Expected at least one partner")
+			},
+		},
+		{
+			name:  "Partner Alias",
+			query: "which source tags does dnc.io use",
+			validate: func(t *testing.T, resp *QueryResponse, fake *dbtest.Fake) {
+				if resp.Partner == nil || resp.Partner.ID != 2 || resp.Partner.Via != "alias" || len(resp.Rows) != 2 {
+					t.Errorf("Expected DNC through its alias, got %+v", resp)
 				}
-				// Print the revenue data for debugging
-				jsonData, _ := json.MarshalIndent(resp, "", "  ")
-				t.Logf("Revenue data:\n%s", string(jsonData))
 			},
 		},
 		{
-			name:  "Partner Source Tags",
-			query: "which source tags does DNC use",
-			validate: func(t *testing.T, resp *QueryResponse) {
-				if resp.Error != "" {
-					t.Errorf("Unexpected error: %s", resp.Error)
+			name:  "Misspelled Partner",
+			query: "what traffic sources does Acme Serch use?",
+			validate: func(t *testing.T, resp *QueryResponse, fake *dbtest.Fake) {
+				if resp.Partner == nil || resp.Partner.Name != "Acme Search" || resp.Partner.Input != "Acme Serch" {
+					t.Errorf("Expected Acme Search to be used, got %+v", resp.Partner)
+				}
+			},
+		},
+		{
+			name:  "Ambiguous Partner",
+			query: "which source tags does orchid use",
+			validate: func(t *testing.T, resp *QueryResponse, fake *dbtest.Fake) {
+				if resp.Error == "" || len(resp.Candidates) != 2 || resp.Candidates[0].Name != "Orchid Search" {
+					t.Errorf("Expected a choice between the Orchid partners, got %+v", resp)
 				}
-				if len(resp.Columns) != 2 {
-					t.Errorf("Expected 2 columns, got %d", len(resp.Columns))
+				for _, c := range fake.Calls() {
+					if strings.Contains(c.SQL, "source_tags") {
+						t.Errorf("Expected no query until the partner is clear, got %s", c.SQL)
+					}
 				}
-				// Print the source tags for debugging
-				jsonData, _ := json.MarshalIndent(resp, "", "  ")
-				t.Logf("Source tags:\n%s", string(jsonData))
 			},
 		},
 		{
-			name:  "TQ Improvement",
-			query: "which source tags went up in tq last month",
-			validate: func(t *testing.T, resp *QueryResponse) {
-				if resp.Error != "" {
-					t.Errorf("Unexpected error: %s", resp.Error)
+			name:  "Unknown Partner",
+			query: "which source tags does Zebra Corp use",
+			validate: func(t *testing.T, resp *QueryResponse, fake *dbtest.Fake) {
+				if !strings.Contains(resp.Error, "Zebra Corp") || resp.Partner != nil {
+					t.Errorf("Expected an error naming the unknown partner, got %+v", resp)
 				}
-				if len(resp.Columns) != 4 {
-					t.Errorf("Expected 4 columns, got %d", len(resp.Columns))
+			},
+		},
+		{
+			name:  "Missing Partner",
+			query: "which source tags are used?",
+			validate: func(t *testing.T, resp *QueryResponse, fake *dbtest.Fake) {
+				if resp.Intent != "partner_source_tags" || !strings.Contains(resp.Error, "partner") {
+					t.Errorf("Expected an error asking for a partner, got %+v", resp)
 				}
-				// Print the TQ changes for debugging
-				jsonData, _ := json.MarshalIndent(resp, "", "  ")
-				t.Logf("TQ changes:\n%s", string(jsonData))
 			},
 		},
 		{
-			name:  "YER Frequency",
-			query: "which partners have been on the yer the most in the last 6 months",
-			validate: func(t *testing.T, resp *QueryResponse) {
-				if resp.Error != "" {
-					t.Errorf("Unexpected error: %s", resp.Error)
+			name:  "Show Tables Across Datasources",
+			query: "show tables",
+			validate: func(t *testing.T, resp *QueryResponse, fake *dbtest.Fake) {
+				if len(resp.Columns) != 3 || len(resp.Rows) != 3 {
+					t.Fatalf("Expected 3 columns and 3 rows, got %d and %d", len(resp.Columns), len(resp.Rows))
 				}
-				if len(resp.Columns) != 3 {
-					t.Errorf("Expected 3 columns, got %d", len(resp.Columns))
+				// Datasources are listed in name order
+				if resp.Rows[0]["datasource"] != "billing" || resp.Rows[2]["table_name"] != "yer_reports" {
+					t.Errorf("Unexpected tables: %+v", resp.Rows)
 				}
-				// Print the YER frequency for debugging
-				jsonData, _ := json.MarshalIndent(resp, "", "  ")
-				t.Logf("YER frequency:\n%s", string(jsonData))
 			},
 		},
 		{
-			name:  "Partner Traffic Sources",
-			query: "what traffic sources does DNC use",
-			validate: func(t *testing.T, resp *QueryResponse) {
-				if resp.Error != "" {
-					t.Errorf("Unexpected error: %s", resp.Error)
+			name:  "Datasource Prefix",
+			query: "datasource: billing\nSELECT count(*) FROM invoices",
+			validate: func(t *testing.T, resp *QueryResponse, fake *dbtest.Fake) {
+				if resp.Datasource != "billing" || len(resp.Rows) != 1 || resp.Rows[0]["count"] != int64(42) {
+					t.Errorf("Unexpected response: %+v", resp)
 				}
-				if len(resp.Columns) != 7 {
-					t.Errorf("Expected 7 columns, got %d", len(resp.Columns))
+			},
+		},
+		{
+			name:  "SQL Error",
+			query: "SELECT * FROM missing_table",
+			validate: func(t *testing.T, resp *QueryResponse, fake *dbtest.Fake) {
+				if resp.Error == "" {
+					t.Error("Expected the query error in the response")
 				}
-				// Print the traffic sources for debugging
-				jsonData, _ := json.MarshalIndent(resp, "", "  ")
-				t.Logf("Traffic sources:\n%s", string(jsonData))
 			},
 		},
 	}
 
-	// Run test cases
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			resp, err := service.HandleQuery(tc.query)
+			fake := newFakeDatasources()
+			service := newToolService(fake)
+
+			resp, err := service.HandleQuery(context.Background(), tc.query)
 			if err != nil {
 				t.Fatalf("Failed to handle query: %v", err)
 			}
-			tc.validate(t, resp)
+			tc.validate(t, resp, fake)
 		})
 	}
 }
 
-func TestDescribePartners(t *testing.T) {
-	// Load configuration
-	cfg, err := config.LoadConfig("")
-	if err != nil {
-		t.Fatalf("Failed to load config: %v", err)
-	}
-
-	// Set up SSH tunnel
-	sshTunnel, err := tunnel.NewSSHTunnel(cfg)
-	if err != nil {
-		t.Fatalf("Failed to create SSH tunnel: %v", err)
-	}
-	defer sshTunnel.Close()
-
-	// Wait a moment for the tunnel to be ready
-	time.Sleep(2 * time.Second)
-
-	// Update the database connection to use the tunnel
-	cfg.Database.ROTraffic.Server = "localhost"
-	cfg.Database.ROTraffic.Port = 5433
-
-	// Initialize database connection
-	database, err := db.NewDB(cfg)
-	if err != nil {
-		t.Fatalf("Failed to connect to database: %v", err)
-	}
-	defer database.Close()
-
-	// Create MCP service
-	service := NewService(database)
-
-	// Test describing partners table
-	resp, err := service.HandleQuery("describe table partners.partners")
-	if err != nil {
-		t.Fatalf("Failed to describe partners table: %v", err)
-	}
-
-	// Print the table structure
-	jsonData, _ := json.MarshalIndent(resp, "", "  ")
-	t.Logf("Partners table structure:\n%s", string(jsonData))
-}
-
-func TestDescribePartnerStatus(t *testing.T) {
-	// Load configuration
-	cfg, err := config.LoadConfig("")
+func TestHandleQueryTimeRange(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
 	if err != nil {
-		t.Fatalf("Failed to load config: %v", err)
+		t.Skipf("No timezone data: %v", err)
 	}
-
-	// Set up SSH tunnel
-	sshTunnel, err := tunnel.NewSSHTunnel(cfg)
-	if err != nil {
-		t.Fatalf("Failed to create SSH tunnel: %v", err)
+	date := func(month time.Month, day int) time.Time {
+		return time.Date(2024, month, day, 0, 0, 0, 0, ny)
 	}
-	defer sshTunnel.Close()
 
-	// Wait a moment for the tunnel to be ready
-	time.Sleep(2 * time.Second)
-
-	// Update the database connection to use the tunnel
-	cfg.Database.ROTraffic.Server = "localhost"
-	cfg.Database.ROTraffic.Port = 5433
-
-	// Initialize database connection
-	database, err := db.NewDB(cfg)
-	if err != nil {
-		t.Fatalf("Failed to connect to database: %v", err)
+	testCases := []struct {
+		query     string
+		args      []interface{}
+		label     string
+		compareTo string
+	}{
+		{
+			// Still the 15th in New York although it's the 16th in UTC
+			query: "which partner made the most money yesterday?",
+			args:  []interface{}{date(time.March, 14), date(time.March, 15), 5},
+			label: "yesterday",
+		},
+		{
+			query: "top 3 partners by revenue in Q3",
+			args:  []interface{}{date(time.July, 1).AddDate(-1, 0, 0), date(time.October, 1).AddDate(-1, 0, 0), 3},
+			label: "q3",
+		},
+		{
+			query: "top 3 partners by click-through rate last month",
+			args:  []interface{}{date(time.February, 1), date(time.March, 1), 3},
+			label: "last month",
+		},
+		{
+			query:     "which source tags went up in tq week over week",
+			args:      []interface{}{date(time.March, 4), date(time.March, 11), date(time.February, 26), date(time.March, 4), int64(1000), 10},
+			label:     "week over week",
+			compareTo: "2024-02-26",
+		},
+		{
+			query: "which partners have been on the yer the most",
+			args:  []interface{}{date(time.September, 16).AddDate(-1, 0, 0), date(time.March, 16), 10},
+			label: "last 6 months",
+		},
 	}
-	defer database.Close()
-
-	// Create MCP service
-	service := NewService(database)
 
-	// Test describing partner_status table
-	resp, err := service.HandleQuery("describe table partners.partner_status")
-	if err != nil {
-		t.Fatalf("Failed to describe partner_status table: %v", err)
+	for _, tc := range testCases {
+		fake := dbtest.New().
+			On("as revenue", dbtest.Result([]string{"revenue"})).
+			On("as ctr", dbtest.Result([]string{"ctr"})).
+			On("as percent_change", dbtest.Result([]string{"percent_change"})).
+			On("as report_count", dbtest.Result([]string{"report_count"}))
+		service := NewService(fake)
+		service.SetLocation(ny)
+		service.router.Now = func() time.Time {
+			return time.Date(2024, time.March, 16, 2, 0, 0, 0, time.UTC).In(ny)
+		}
+
+		resp, err := service.HandleQuery(context.Background(), tc.query)
+		if err != nil {
+			t.Fatalf("Failed to handle %q: %v", tc.query, err)
+		}
+		if resp.TimeRange == nil || resp.TimeRange.Label != tc.label {
+			t.Errorf("%q: expected the time range %q in the response, got %+v", tc.query, tc.label, resp.TimeRange)
+		}
+		if tc.compareTo != "" && (resp.TimeRange == nil || resp.TimeRange.Compare == nil || resp.TimeRange.Compare.Start != tc.compareTo) {
+			t.Errorf("%q: expected a comparison from %s, got %+v", tc.query, tc.compareTo, resp.TimeRange)
+		}
+
+		calls := fake.Calls()
+		if len(calls) != 1 || len(calls[0].Args) != len(tc.args) {
+			t.Fatalf("%q: expected one query with %d arguments, got %+v", tc.query, len(tc.args), calls)
+		}
+		for i, want := range tc.args {
+			got := calls[0].Args[i]
+			if wantTime, ok := want.(time.Time); ok {
+				if gotTime, ok := got.(time.Time); !ok || !gotTime.Equal(wantTime) {
+					t.Errorf("%q: argument %d is %v, expected %v", tc.query, i+1, got, want)
+				}
+				continue
+			}
+			if got != want {
+				t.Errorf("%q: argument %d is %v, expected %v", tc.query, i+1, got, want)
+			}
+		}
 	}
-
-	// Print the table structure
-	jsonData, _ := json.MarshalIndent(resp, "", "  ")
-	t.Logf("Partner status table structure:\n%s", string(jsonData))
 }
 
-func TestDescribeYerData(t *testing.T) {
-	// Load configuration
-	cfg, err := config.LoadConfig("")
-	if err != nil {
-		t.Fatalf("Failed to load config: %v", err)
-	}
+func TestHandleQueryMeta(t *testing.T) {
+	asOf := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	result := dbtest.Result([]string{"n"}, []interface{}{int64(1)})
+	result.Host = "replica-2.internal:5432"
+	result.Lag = 2500 * time.Millisecond
+	result.DataAsOf = asOf
 
-	// Set up SSH tunnel
-	sshTunnel, err := tunnel.NewSSHTunnel(cfg)
+	service := NewService(dbtest.New().On("select 1", result))
+	resp, err := service.HandleQuery(context.Background(), "SELECT 1")
 	if err != nil {
-		t.Fatalf("Failed to create SSH tunnel: %v", err)
+		t.Fatalf("Failed to handle query: %v", err)
 	}
-	defer sshTunnel.Close()
-
-	// Wait a moment for the tunnel to be ready
-	time.Sleep(2 * time.Second)
-
-	// Update the database connection to use the tunnel
-	cfg.Database.ROTraffic.Server = "localhost"
-	cfg.Database.ROTraffic.Port = 5433
-
-	// Initialize database connection
-	database, err := db.NewDB(cfg)
-	if err != nil {
-		t.Fatalf("Failed to connect to database: %v", err)
+	if resp.Meta == nil {
+		t.Fatal("Expected metadata about the answering host")
 	}
-	defer database.Close()
-
-	// Create MCP service
-	service := NewService(database)
-
-	// Test describing yer_data table
-	resp, err := service.HandleQuery("describe table yer_analysis.yer_data")
-	if err != nil {
-		t.Fatalf("Failed to describe yer_data table: %v", err)
+	if resp.Meta.Host != "replica-2.internal:5432" || resp.Meta.ReplicationLagMillis != 2500 || !resp.Meta.DataAsOf.Equal(asOf) {
+		t.Errorf("Unexpected metadata: %+v", resp.Meta)
 	}
-
-	// Print the table structure
-	jsonData, _ := json.MarshalIndent(resp, "", "  ")
-	t.Logf("YER data table structure:\n%s", string(jsonData))
 }
 
-func TestDescribeYerDataDirect(t *testing.T) {
-	// Load configuration
-	cfg, err := config.LoadConfig("")
-	if err != nil {
-		t.Fatalf("Failed to load config: %v", err)
-	}
-
-	// Set up SSH tunnel
-	sshTunnel, err := tunnel.NewSSHTunnel(cfg)
-	if err != nil {
-		t.Fatalf("Failed to create SSH tunnel: %v", err)
-	}
-	defer sshTunnel.Close()
-
-	// Wait a moment for the tunnel to be ready
-	time.Sleep(2 * time.Second)
-
-	// Update the database connection to use the tunnel
-	cfg.Database.ROTraffic.Server = "localhost"
-	cfg.Database.ROTraffic.Port = 5433
-
-	// Initialize database connection
-	database, err := db.NewDB(cfg)
-	if err != nil {
-		t.Fatalf("Failed to connect to database: %v", err)
+func TestHandleQueryRawSQL(t *testing.T) {
+	testCases := []struct {
+		name  string
+		query string
+		sql   bool
+	}{
+		{"Select", "SELECT 1", true},
+		{"Line Comment", "-- how many partners\nSELECT count(*) FROM partners.partners", true},
+		{"Block Comment", "/* check */ select 1", true},
+		{"Comments And Parentheses", "  /* a */ -- b\n  (SELECT 1)", true},
+		{"Show Setting", "SHOW search_path", true},
+		{"Show Time Zone", "show time zone;", true},
+		{"Show All", "SHOW ALL", true},
+		{"Only A Comment", "-- nothing else", false},
+		{"Show Question", "show me the top partners by revenue", false},
+		{"Question", "what were the top partners last month?", false},
 	}
-	defer database.Close()
 
-	// Create MCP service
-	service := NewService(database)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := dbtest.New()
+			service := newToolService(fake)
 
-	// Test describing yer_data table with a direct query
-	resp, err := service.HandleQuery(`
-		SELECT column_name, data_type, is_nullable
-		FROM information_schema.columns
-		WHERE table_schema = 'yer_analysis'
-		AND table_name = 'yer_data'
-		ORDER BY ordinal_position;
-	`)
-	if err != nil {
-		t.Fatalf("Failed to describe yer_data table: %v", err)
+			if _, err := service.HandleQuery(context.Background(), tc.query); err != nil {
+				t.Fatalf("Failed to handle query: %v", err)
+			}
+			calls := fake.Calls()
+			ranAsWritten := len(calls) == 1 && calls[0].SQL == tc.query
+			if ranAsWritten != tc.sql {
+				t.Errorf("Expected %q to run as SQL: %v, got calls %+v", tc.query, tc.sql, calls)
+			}
+		})
 	}
-
-	// Print the table structure
-	jsonData, _ := json.MarshalIndent(resp, "", "  ")
-	t.Logf("YER data table structure (direct query):\n%s", string(jsonData))
 }
 
-func TestDescribeYerItems(t *testing.T) {
-	// Load configuration
-	cfg, err := config.LoadConfig("")
-	if err != nil {
-		t.Fatalf("Failed to load config: %v", err)
-	}
-
-	// Set up SSH tunnel
-	sshTunnel, err := tunnel.NewSSHTunnel(cfg)
-	if err != nil {
-		t.Fatalf("Failed to create SSH tunnel: %v", err)
+func TestHandleQueryUnknownDatasource(t *testing.T) {
+	service := NewService(newFakeDatasources())
+	if _, err := service.HandleQueryOn(context.Background(), "nope", "select 1"); err == nil {
+		t.Error("Expected an error for an unknown datasource")
 	}
-	defer sshTunnel.Close()
-
-	// Wait a moment for the tunnel to be ready
-	time.Sleep(2 * time.Second)
-
-	// Update the database connection to use the tunnel
-	cfg.Database.ROTraffic.Server = "localhost"
-	cfg.Database.ROTraffic.Port = 5433
-
-	// Initialize database connection
-	database, err := db.NewDB(cfg)
-	if err != nil {
-		t.Fatalf("Failed to connect to database: %v", err)
-	}
-	defer database.Close()
-
-	// Create MCP service
-	service := NewService(database)
-
-	// Test describing v_yer_items view
-	resp, err := service.HandleQuery(`
-		SELECT column_name, data_type, is_nullable
-		FROM information_schema.columns
-		WHERE table_schema = 'yer_analysis'
-		AND table_name = 'v_yer_items'
-		ORDER BY ordinal_position;
-	`)
-	if err != nil {
-		t.Fatalf("Failed to describe v_yer_items view: %v", err)
-	}
-
-	// Print the view structure
-	jsonData, _ := json.MarshalIndent(resp, "", "  ")
-	t.Logf("YER items view structure:\n%s", string(jsonData))
 }
 
-func TestDescribeYerItemsTags(t *testing.T) {
-	// Load configuration
-	cfg, err := config.LoadConfig("")
-	if err != nil {
-		t.Fatalf("Failed to load config: %v", err)
-	}
-
-	// Set up SSH tunnel
-	sshTunnel, err := tunnel.NewSSHTunnel(cfg)
-	if err != nil {
-		t.Fatalf("Failed to create SSH tunnel: %v", err)
-	}
-	defer sshTunnel.Close()
-
-	// Wait a moment for the tunnel to be ready
-	time.Sleep(2 * time.Second)
-
-	// Update the database connection to use the tunnel
-	cfg.Database.ROTraffic.Server = "localhost"
-	cfg.Database.ROTraffic.Port = 5433
-
-	// Initialize database connection
-	database, err := db.NewDB(cfg)
-	if err != nil {
-		t.Fatalf("Failed to connect to database: %v", err)
+func TestSplitDatasource(t *testing.T) {
+	testCases := []struct {
+		query      string
+		datasource string
+		rest       string
+	}{
+		{"show tables", "", "show tables"},
+		{"datasource: billing show tables", "billing", "show tables"},
+		{"Datasource: billing\nselect 1", "billing", "select 1"},
+		{"  datasource:ro-traffic describe table partners.partners", "ro-traffic", "describe table partners.partners"},
 	}
-	defer database.Close()
 
-	// Create MCP service
-	service := NewService(database)
-
-	// Test describing v_yer_items_tags view
-	resp, err := service.HandleQuery(`
-		SELECT column_name, data_type, is_nullable
-		FROM information_schema.columns
-		WHERE table_schema = 'yer_analysis'
-		AND table_name = 'v_yer_items_tags'
-		ORDER BY ordinal_position;
-	`)
-	if err != nil {
-		t.Fatalf("Failed to describe v_yer_items_tags view: %v", err)
+	for _, tc := range testCases {
+		datasource, rest := splitDatasource(tc.query)
+		if datasource != tc.datasource || rest != tc.rest {
+			t.Errorf("splitDatasource(%q) = %q, %q; expected %q, %q", tc.query, datasource, rest, tc.datasource, tc.rest)
+		}
 	}
-
-	// Print the view structure
-	jsonData, _ := json.MarshalIndent(resp, "", "  ")
-	t.Logf("YER items tags view structure:\n%s", string(jsonData))
 }
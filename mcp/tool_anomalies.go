@@ -0,0 +1,298 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dnc-data-mcp/analytics"
+	"github.com/dnc-data-mcp/semantic"
+)
+
+const (
+	// defaultAnomalyMonths is how many full months find_anomalies reads; two
+	// years give every month a seasonal baseline
+	defaultAnomalyMonths = 24
+	// maxAnomalyMonths caps the months read
+	maxAnomalyMonths = 60
+	// defaultAnomalyRecent is how many of the latest periods are judged
+	defaultAnomalyRecent = 3
+	// defaultAnomalyLimit is how many findings are returned
+	defaultAnomalyLimit = 20
+	// maxAnomalyLimit caps the findings
+	maxAnomalyLimit = 200
+)
+
+// defaultAnomalyMetrics cover the usual worries: revenue spikes, traffic
+// disappearing and TQ drops
+var defaultAnomalyMetrics = []string{"revenue", "searches", "tq"}
+
+// seriesGranularities are the periods a series, or a cohort, can be made of
+var seriesGranularities = []string{"month", "report"}
+
+// findAnomaliesArgs are the arguments of find_anomalies
+type findAnomaliesArgs struct {
+	Datasource  string                   `json:"datasource"`
+	Metrics     []string                 `json:"metrics"`
+	By          string                   `json:"by"`
+	Granularity string                   `json:"granularity"`
+	Filters     map[string][]interface{} `json:"filters"`
+	Months      int                      `json:"months"`
+	Recent      int                      `json:"recent"`
+	Threshold   float64                  `json:"threshold"`
+	// MinSearches is a pointer so an explicit 0 can turn the default off
+	MinSearches *int64 `json:"min_searches"`
+	Limit       int    `json:"limit"`
+}
+
+// AnomaliesResult is the result of find_anomalies
+type AnomaliesResult struct {
+	Datasource string `json:"datasource"`
+	// Period is the months read; the latest Recent periods of it are judged
+	Period *TimeRange `json:"period,omitempty"`
+	// Partners are the partners the partner filter resolved to
+	Partners []PartnerMatch `json:"partners,omitempty"`
+	// Findings are the anomalies, most anomalous first
+	Findings []analytics.Finding `json:"findings"`
+	// Scanned is how many series were checked
+	Scanned    int            `json:"series_scanned"`
+	Candidates []PartnerMatch `json:"candidates,omitempty"`
+	Error      string         `json:"error,omitempty"`
+}
+
+// findAnomaliesTool scans each partner's or source tag's metrics for
+// unusual periods
+func (s *Service) findAnomaliesTool() Tool {
+	return Tool{
+		Name: "find_anomalies",
+		Description: "Scan monthly (or per-report) series of each partner or source tag for anomalies such as sudden " +
+			"TQ drops, revenue spikes or traffic disappearing. Each period is compared with the median of the 12 before " +
+			"it, adjusted by the same month a year earlier, using the median absolute deviation as the spread. Returns " +
+			"findings ranked by how unusual they are, each with an explanation; values back from a baseline of zero " +
+			"are reported as appeared, unscored and last.",
+		InputSchema: schema(nil, map[string]interface{}{
+			"datasource": datasourceProperty,
+			"metrics": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string", "enum": semantic.MetricNames()},
+				"description": "Metrics to scan; defaults to revenue, searches and tq",
+			},
+			"by": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"partner", "source_tag"},
+				"description": "Scan each partner or each source tag; defaults to source_tag",
+			},
+			"granularity": map[string]interface{}{
+				"type":        "string",
+				"enum":        seriesGranularities,
+				"description": "Periods of the series; defaults to month",
+			},
+			"filters": filtersProperty,
+			"months":  property("integer", fmt.Sprintf("Full months of history to read; defaults to %d, at most %d", defaultAnomalyMonths, maxAnomalyMonths)),
+			"recent":  property("integer", fmt.Sprintf("How many of the latest periods to judge; defaults to %d", defaultAnomalyRecent)),
+			"threshold": property("number", fmt.Sprintf("Robust z-score a period needs to be reported; defaults to %g, higher finds fewer",
+				analytics.DefaultThreshold)),
+			"min_searches": property("integer", fmt.Sprintf("Least searches a period needs for its ratio metrics (tq, ctr, rpm, rpc) "+
+				"to count; defaults to %d, 0 for no minimum", semantic.DefaultMinSearches)),
+			"limit": property("integer", fmt.Sprintf("Most findings to return; defaults to %d, at most %d", defaultAnomalyLimit, maxAnomalyLimit)),
+		}),
+		run: s.findAnomalies,
+	}
+}
+
+func (s *Service) findAnomalies(ctx context.Context, raw json.RawMessage) (interface{}, error) {
+	const tool = "find_anomalies"
+	var args findAnomaliesArgs
+	if err := decodeArgs(tool, raw, &args); err != nil {
+		return nil, err
+	}
+	if args.By == "" {
+		args.By = "source_tag"
+	}
+	if args.By != "partner" && args.By != "source_tag" {
+		return nil, &ArgumentError{Tool: tool, Problem: "by must be partner or source_tag"}
+	}
+	if args.Granularity == "" {
+		args.Granularity = "month"
+	}
+	if !contains(seriesGranularities, args.Granularity) {
+		return nil, &ArgumentError{Tool: tool, Problem: "granularity must be one of " + strings.Join(seriesGranularities, ", ")}
+	}
+	if len(args.Metrics) == 0 {
+		args.Metrics = defaultAnomalyMetrics
+	}
+	var metrics []semantic.Metric
+	for _, name := range args.Metrics {
+		m, ok := semantic.MetricByName(name)
+		if !ok {
+			return nil, &ArgumentError{Tool: tool, Problem: fmt.Sprintf("unknown metric %q; use one of %s", name, strings.Join(semantic.MetricNames(), ", "))}
+		}
+		metrics = append(metrics, m)
+	}
+	months, err := boundedArg("months", args.Months, defaultAnomalyMonths, maxAnomalyMonths)
+	if err != nil {
+		return nil, &ArgumentError{Tool: tool, Problem: err.Error()}
+	}
+	recent, err := boundedArg("recent", args.Recent, defaultAnomalyRecent, months)
+	if err != nil {
+		return nil, &ArgumentError{Tool: tool, Problem: err.Error()}
+	}
+	limit, err := boundedArg("limit", args.Limit, defaultAnomalyLimit, maxAnomalyLimit)
+	if err != nil {
+		return nil, &ArgumentError{Tool: tool, Problem: err.Error()}
+	}
+	if args.Threshold < 0 {
+		return nil, &ArgumentError{Tool: tool, Problem: "threshold must be positive"}
+	}
+	minSearches := float64(semantic.DefaultMinSearches)
+	if args.MinSearches != nil {
+		minSearches = float64(*args.MinSearches)
+	}
+	datasource, err := s.datasourceName(args.Datasource)
+	if err != nil {
+		return nil, &ArgumentError{Tool: tool, Problem: err.Error()}
+	}
+
+	period, _ := summaryPeriods(s.router.Now(), months)
+	result := &AnomaliesResult{Datasource: datasource, Period: newTimeRange(period), Findings: []analytics.Finding{}}
+
+	filters, err := s.metricFilters(ctx, tool, datasource, args.Filters)
+	if err != nil {
+		return nil, err
+	}
+	result.Partners = filters.partners
+	if filters.unresolved != "" {
+		result.Error, result.Candidates = filters.unresolved, filters.candidates
+		return result, nil
+	}
+
+	// Searches come along whatever the metrics, as the volume behind ratios
+	names := append(append([]string(nil), args.Metrics...), "searches")
+	sql, sqlArgs, err := semantic.Compile(semantic.Query{
+		Metrics:    names,
+		Dimensions: []string{args.By, args.Granularity},
+		Filters:    filters.ids,
+		TimeRange:  &period,
+		Unlimited:  true,
+	})
+	if err != nil {
+		return nil, &ArgumentError{Tool: tool, Problem: err.Error()}
+	}
+	resp, err := s.executeQuery(ctx, datasource, sql, sqlArgs...)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		result.Error = resp.Error
+		return result, nil
+	}
+
+	opts := analytics.Options{Recent: recent, Threshold: args.Threshold, MinVolume: minSearches}
+	periods := analytics.MonthPeriods(period.Start, period.End)
+	if args.Granularity == "report" {
+		// Reports aren't evenly spaced, so there's no seasonal cycle to use
+		periods = reportPeriods(resp.Rows)
+	} else {
+		opts.Season = 12
+	}
+
+	dim, _ := semantic.DimensionByName(args.By)
+	for _, m := range metrics {
+		observations := seriesObservations(resp.Rows, dim, args.Granularity, m.Name)
+		for _, series := range analytics.BuildSeries(m.Name, !m.Ratio, periods, observations) {
+			result.Scanned++
+			result.Findings = append(result.Findings, analytics.Detect(series, opts)...)
+		}
+	}
+	analytics.Rank(result.Findings)
+	if len(result.Findings) > limit {
+		result.Findings = result.Findings[:limit]
+	}
+	return result, nil
+}
+
+// seriesObservations reads one metric's observations from the rows of a
+// query by dimension and month or report. Rows without a value are skipped.
+func seriesObservations(rows []QueryResult, dim semantic.Dimension, granularity, metric string) []analytics.Observation {
+	var observations []analytics.Observation
+	for _, row := range rows {
+		id, ok := toFloat(row[dim.Columns[0].Name])
+		key, period, isPeriod := rowPeriod(row, granularity)
+		value, hasValue := toFloat(row[metric])
+		if !ok || !isPeriod || !hasValue {
+			continue
+		}
+		volume, _ := toFloat(row["searches"])
+		name, _ := row[dim.Columns[1].Name].(string)
+		observations = append(observations, analytics.Observation{
+			Entity: analytics.Entity{Dimension: dim.Name, ID: int64(id), Name: name},
+			Key:    key,
+			Period: period,
+			Value:  value,
+			Volume: volume,
+		})
+	}
+	return observations
+}
+
+// rowPeriod reads the period of a row by month or report. Months are known by
+// their dates; reports by their IDs, since reruns can share an end date.
+func rowPeriod(row QueryResult, granularity string) (string, time.Time, bool) {
+	if granularity != "report" {
+		month, ok := row["month"].(time.Time)
+		return "", month, ok
+	}
+	id, hasID := toFloat(row["report_id"])
+	end, hasEnd := row["report_end_date"].(time.Time)
+	return fmt.Sprint(int64(id)), end, hasID && hasEnd
+}
+
+// reportPeriods returns the distinct reports in rows, known by ID and
+// reported as their end dates, oldest first
+func reportPeriods(rows []QueryResult) []analytics.Period {
+	seen := make(map[string]bool)
+	var periods []analytics.Period
+	for _, row := range rows {
+		key, end, ok := rowPeriod(row, "report")
+		if !ok || seen[key] {
+			continue
+		}
+		seen[key] = true
+		periods = append(periods, analytics.Period{Key: key, Start: end})
+	}
+	// Report IDs break ties, so a rerun follows the report it replaces
+	sort.Slice(periods, func(i, j int) bool {
+		if !periods[i].Start.Equal(periods[j].Start) {
+			return periods[i].Start.Before(periods[j].Start)
+		}
+		return reportID(periods[i]) < reportID(periods[j])
+	})
+	return periods
+}
+
+// reportID is the ID a report period is known by
+func reportID(p analytics.Period) int64 {
+	id, _ := strconv.ParseInt(p.Key, 10, 64)
+	return id
+}
+
+// toFloat converts the numeric types a query may return
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	}
+	return 0, false
+}
@@ -0,0 +1,161 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/dnc-data-mcp/analytics"
+	"github.com/dnc-data-mcp/semantic"
+)
+
+const (
+	// defaultCohorts is how many of the latest months (or reports) start a
+	// cohort
+	defaultCohorts = 12
+	// maxCohorts caps the cohorts
+	maxCohorts = 36
+)
+
+// cohortRetentionArgs are the arguments of cohort_retention
+type cohortRetentionArgs struct {
+	Datasource  string                   `json:"datasource"`
+	By          string                   `json:"by"`
+	Granularity string                   `json:"granularity"`
+	Filters     map[string][]interface{} `json:"filters"`
+	Cohorts     int                      `json:"cohorts"`
+}
+
+// CohortsResult is the result of cohort_retention
+type CohortsResult struct {
+	Datasource  string `json:"datasource"`
+	By          string `json:"by"`
+	Granularity string `json:"granularity"`
+	// Period is the months cohorts were followed over, by month
+	Period *TimeRange `json:"period,omitempty"`
+	// Partners are the partners the partner filter resolved to
+	Partners []PartnerMatch `json:"partners,omitempty"`
+	// Cohorts are oldest first; periods with no one new start none
+	Cohorts []analytics.Cohort `json:"cohorts"`
+	// Average pools the cohorts by how long since they started
+	Average    []analytics.RetentionPeriod `json:"average"`
+	Candidates []PartnerMatch              `json:"candidates,omitempty"`
+	Error      string                      `json:"error,omitempty"`
+}
+
+// cohortRetentionTool groups partners or source tags by when they first
+// appeared in YER data and follows how many stay
+func (s *Service) cohortRetentionTool() Tool {
+	return Tool{
+		Name: "cohort_retention",
+		Description: "Are new partners sticking around? Groups partners (or source tags) into cohorts by the month " +
+			"(or yield enhancement report) they first had traffic in, across all YER history, then reports for each " +
+			"later period how many of each cohort were still active and what share of their first period's revenue " +
+			"they kept, plus an average over cohorts by periods since starting.",
+		InputSchema: schema(nil, map[string]interface{}{
+			"datasource": datasourceProperty,
+			"by": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"partner", "source_tag"},
+				"description": "Group partners or source tags; defaults to partner",
+			},
+			"granularity": map[string]interface{}{
+				"type":        "string",
+				"enum":        seriesGranularities,
+				"description": "Periods of the cohorts; defaults to month",
+			},
+			"filters": filtersProperty,
+			"cohorts": property("integer", fmt.Sprintf("How many of the latest full months (or reports) start a cohort; defaults to %d, at most %d",
+				defaultCohorts, maxCohorts)),
+		}),
+		run: s.cohortRetention,
+	}
+}
+
+func (s *Service) cohortRetention(ctx context.Context, raw json.RawMessage) (interface{}, error) {
+	const tool = "cohort_retention"
+	var args cohortRetentionArgs
+	if err := decodeArgs(tool, raw, &args); err != nil {
+		return nil, err
+	}
+	if args.By == "" {
+		args.By = "partner"
+	}
+	if args.By != "partner" && args.By != "source_tag" {
+		return nil, &ArgumentError{Tool: tool, Problem: "by must be partner or source_tag"}
+	}
+	if args.Granularity == "" {
+		args.Granularity = "month"
+	}
+	if !contains(seriesGranularities, args.Granularity) {
+		return nil, &ArgumentError{Tool: tool, Problem: "granularity must be one of " + strings.Join(seriesGranularities, ", ")}
+	}
+	cohorts, err := boundedArg("cohorts", args.Cohorts, defaultCohorts, maxCohorts)
+	if err != nil {
+		return nil, &ArgumentError{Tool: tool, Problem: err.Error()}
+	}
+	datasource, err := s.datasourceName(args.Datasource)
+	if err != nil {
+		return nil, &ArgumentError{Tool: tool, Problem: err.Error()}
+	}
+
+	result := &CohortsResult{
+		Datasource:  datasource,
+		By:          args.By,
+		Granularity: args.Granularity,
+		Cohorts:     []analytics.Cohort{},
+		Average:     []analytics.RetentionPeriod{},
+	}
+
+	filters, err := s.metricFilters(ctx, tool, datasource, args.Filters)
+	if err != nil {
+		return nil, err
+	}
+	result.Partners = filters.partners
+	if filters.unresolved != "" {
+		result.Error, result.Candidates = filters.unresolved, filters.candidates
+		return result, nil
+	}
+
+	// All of history, since an entity only starts a cohort when it's never
+	// been seen before
+	sql, sqlArgs, err := semantic.Compile(semantic.Query{
+		Metrics:    []string{"revenue", "searches"},
+		Dimensions: []string{args.By, args.Granularity},
+		Filters:    filters.ids,
+		Unlimited:  true,
+	})
+	if err != nil {
+		return nil, &ArgumentError{Tool: tool, Problem: err.Error()}
+	}
+	resp, err := s.executeQuery(ctx, datasource, sql, sqlArgs...)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		result.Error = resp.Error
+		return result, nil
+	}
+
+	var periods []analytics.Period
+	if args.Granularity == "report" {
+		periods = reportPeriods(resp.Rows)
+		if len(periods) > cohorts {
+			periods = periods[len(periods)-cohorts:]
+		}
+	} else {
+		// Full months only; this month's cohort is still arriving
+		period, _ := summaryPeriods(s.router.Now(), cohorts)
+		result.Period = newTimeRange(period)
+		periods = analytics.MonthPeriods(period.Start, period.End)
+	}
+
+	dim, _ := semantic.DimensionByName(args.By)
+	observations := seriesObservations(resp.Rows, dim, args.Granularity, "revenue")
+	result.Cohorts = analytics.BuildCohorts(periods, observations)
+	if len(result.Cohorts) > 0 {
+		result.Average = analytics.AverageRetention(result.Cohorts)
+	}
+	return result, nil
+}
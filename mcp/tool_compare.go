@@ -0,0 +1,161 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/dnc-data-mcp/semantic"
+	"github.com/dnc-data-mcp/timerange"
+)
+
+// compareMetricsArgs are the arguments of compare_metrics
+type compareMetricsArgs struct {
+	Datasource string                   `json:"datasource"`
+	Metric     string                   `json:"metric"`
+	Dimensions []string                 `json:"dimensions"`
+	Filters    map[string][]interface{} `json:"filters"`
+	Current    string                   `json:"current"`
+	Previous   string                   `json:"previous"`
+	// MinSearches is a pointer so an explicit 0 can turn the default off
+	MinSearches *int64 `json:"min_searches"`
+	Direction   string `json:"direction"`
+	OrderBy     string `json:"order_by"`
+	Limit       int    `json:"limit"`
+}
+
+// yearEarlier are the ways of asking compare_metrics for the same period a
+// year before the current one
+var yearEarlier = []string{"year ago", "a year ago", "year earlier", "a year earlier", "same period last year", "yoy"}
+
+// compareMetricsTool compares a metric between two periods, broken down by
+// dimensions, and ranks the changes
+func (s *Service) compareMetricsTool() Tool {
+	return Tool{
+		Name: "compare_metrics",
+		Description: "Compare a metric between two periods, broken down by dimensions, e.g. which source tags' TQ rose " +
+			"month over month or which partners' revenue fell year over year. Rows give current, previous, change and " +
+			"percent_change. Ratio metrics (tq, ctr, rpm, rpc) skip rows under 1000 searches in either period unless " +
+			"min_searches says otherwise, so tiny, noisy tags don't dominate.",
+		InputSchema: schema([]string{"metric"}, map[string]interface{}{
+			"datasource": datasourceProperty,
+			"metric": map[string]interface{}{
+				"type":        "string",
+				"enum":        semantic.MetricNames(),
+				"description": "Metric to compare",
+			},
+			"dimensions": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string", "enum": []string{"partner", "source_tag", "report"}},
+				"description": "Dimensions to compare by; the totals if omitted",
+			},
+			"filters": filtersProperty,
+			"current": property("string", "Current period, e.g. \"last month\", \"Q3\" or \"week over week\"; defaults to last month"),
+			"previous": property("string", "Period to compare against: a time range, or \"year ago\" for the same period a year "+
+				"earlier; defaults to the period just before the current one"),
+			"min_searches": property("integer", "Skip rows with fewer searches than this in either period; 0 for no minimum"),
+			"direction": map[string]interface{}{
+				"type":        "string",
+				"enum":        semantic.Directions,
+				"description": "Only rows that went up, or only rows that went down; the biggest moves either way if omitted",
+			},
+			"order_by": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{semantic.ByChange, semantic.ByPercentChange},
+				"description": "Rank by absolute or percent change; defaults to change",
+			},
+			"limit": property("integer", fmt.Sprintf("Most rows to return; defaults to %d, at most %d", semantic.DefaultLimit, semantic.MaxLimit)),
+		}),
+		run: s.compareMetrics,
+	}
+}
+
+func (s *Service) compareMetrics(ctx context.Context, raw json.RawMessage) (interface{}, error) {
+	const tool = "compare_metrics"
+	var args compareMetricsArgs
+	if err := decodeArgs(tool, raw, &args); err != nil {
+		return nil, err
+	}
+	datasource, err := s.datasourceName(args.Datasource)
+	if err != nil {
+		return nil, &ArgumentError{Tool: tool, Problem: err.Error()}
+	}
+
+	current, err := s.parseTimeRange(args.Current, defaultMetricsRange)
+	if err != nil {
+		return nil, &ArgumentError{Tool: tool, Problem: err.Error()}
+	}
+	if current == nil {
+		return nil, &ArgumentError{Tool: tool, Problem: "the current period can't be all time"}
+	}
+	previous, err := s.baselineRange(*current, args.Previous)
+	if err != nil {
+		return nil, &ArgumentError{Tool: tool, Problem: err.Error()}
+	}
+
+	c := semantic.Comparison{
+		Metric:     args.Metric,
+		Dimensions: args.Dimensions,
+		Current:    *current,
+		Previous:   previous,
+		Direction:  args.Direction,
+		OrderBy:    args.OrderBy,
+		Limit:      args.Limit,
+	}
+	if args.MinSearches != nil {
+		c.MinSearches = *args.MinSearches
+		if c.MinSearches <= 0 {
+			c.MinSearches = -1
+		}
+	}
+
+	result := &MetricsResult{QueryResponse: QueryResponse{Datasource: datasource}}
+	period := *current
+	period.Compare = &previous
+	result.TimeRange = newTimeRange(period)
+
+	filters, err := s.metricFilters(ctx, tool, datasource, args.Filters)
+	if err != nil {
+		return nil, err
+	}
+	result.Partners = filters.partners
+	if filters.unresolved != "" {
+		result.Error, result.Candidates = filters.unresolved, filters.candidates
+		return result, nil
+	}
+	c.Filters = filters.ids
+
+	sql, sqlArgs, err := semantic.CompileComparison(c)
+	if err != nil {
+		return nil, &ArgumentError{Tool: tool, Problem: err.Error()}
+	}
+	result.SQL = sql
+
+	resp, err := s.executeQuery(ctx, datasource, sql, sqlArgs...)
+	if err != nil {
+		return nil, err
+	}
+	result.Columns, result.Rows, result.Meta, result.Error = resp.Columns, resp.Rows, resp.Meta, resp.Error
+	return result, nil
+}
+
+// baselineRange returns the period to compare current against: its baseline
+// by default, the same period a year earlier, or any other time range
+func (s *Service) baselineRange(current timerange.Range, text string) (timerange.Range, error) {
+	text = strings.TrimSpace(text)
+	switch {
+	case text == "":
+		return current.Baseline(), nil
+	case contains(yearEarlier, strings.ToLower(text)):
+		return current.YearEarlier(), nil
+	}
+	r, err := s.parseTimeRange(text, "")
+	if err != nil {
+		return timerange.Range{}, err
+	}
+	if r == nil {
+		return timerange.Range{}, fmt.Errorf("the previous period can't be all time")
+	}
+	return *r, nil
+}
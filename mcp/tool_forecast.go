@@ -0,0 +1,235 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dnc-data-mcp/analytics"
+	"github.com/dnc-data-mcp/semantic"
+)
+
+const (
+	// defaultForecastHistory is how many full months a forecast learns from;
+	// three years give Holt-Winters a seasonal cycle to spare
+	defaultForecastHistory = 36
+	// maxForecastHistory caps the history read
+	maxForecastHistory = 60
+	// defaultForecastHorizon is how many months are projected
+	defaultForecastHorizon = 3
+	// maxForecastHorizon caps the horizon; past a year the intervals say
+	// little
+	maxForecastHorizon = 12
+)
+
+// forecastCaveat goes with every forecast so it isn't read as a promise
+const forecastCaveat = "Projections assume recent trend and seasonality hold; they don't know about new deals, " +
+	"lost partners or reporting delays. Quote the interval, not just the value."
+
+// forecastMetricArgs are the arguments of forecast_metric
+type forecastMetricArgs struct {
+	Datasource string                   `json:"datasource"`
+	Metric     string                   `json:"metric"`
+	Filters    map[string][]interface{} `json:"filters"`
+	History    int                      `json:"history"`
+	Horizon    int                      `json:"horizon"`
+	Level      float64                  `json:"level"`
+}
+
+// ForecastPeriod is a month's actual or projected value. Lower and Upper
+// are only set on projections.
+type ForecastPeriod struct {
+	// Period is the start of the month, as YYYY-MM-DD
+	Period string   `json:"period"`
+	Value  float64  `json:"value"`
+	Lower  *float64 `json:"lower,omitempty"`
+	Upper  *float64 `json:"upper,omitempty"`
+}
+
+// ForecastMetricResult is the result of forecast_metric
+type ForecastMetricResult struct {
+	Datasource string `json:"datasource"`
+	Metric     string `json:"metric"`
+	// Period is the months the model learned from
+	Period *TimeRange `json:"period,omitempty"`
+	// Partners are the partners the partner filter resolved to
+	Partners []PartnerMatch `json:"partners,omitempty"`
+	// Model is holt_winters with two years of history, linear_trend otherwise
+	Model  string             `json:"model,omitempty"`
+	Params map[string]float64 `json:"params,omitempty"`
+	// Level is the coverage of the projections' intervals
+	Level      float64          `json:"level,omitempty"`
+	History    []ForecastPeriod `json:"history"`
+	Forecast   []ForecastPeriod `json:"forecast"`
+	Caveat     string           `json:"caveat,omitempty"`
+	Candidates []PartnerMatch   `json:"candidates,omitempty"`
+	Error      string           `json:"error,omitempty"`
+}
+
+// forecastMetricTool projects a metric's monthly totals a few months ahead
+func (s *Service) forecastMetricTool() Tool {
+	return Tool{
+		Name: "forecast_metric",
+		Description: "Project a metric's monthly value for the next few months if trends hold, e.g. what a partner " +
+			"will make next month. Fits Holt-Winters (trend and yearly seasonality) to the monthly history, or a linear " +
+			"trend when there's less than two years of it, and returns each projected month with a prediction interval. " +
+			"Use this rather than estimating from raw numbers.",
+		InputSchema: schema(nil, map[string]interface{}{
+			"datasource": datasourceProperty,
+			"metric": map[string]interface{}{
+				"type":        "string",
+				"enum":        semantic.MetricNames(),
+				"description": "Metric to forecast; defaults to revenue",
+			},
+			"filters": filtersProperty,
+			"history": property("integer", fmt.Sprintf("Full months of history to learn from; defaults to %d, at most %d",
+				defaultForecastHistory, maxForecastHistory)),
+			"horizon": property("integer", fmt.Sprintf("Months to project; defaults to %d, at most %d", defaultForecastHorizon, maxForecastHorizon)),
+			"level": map[string]interface{}{
+				"type":        "number",
+				"enum":        analytics.ForecastLevels,
+				"description": "Coverage of the prediction intervals; defaults to 0.8",
+			},
+		}),
+		run: s.forecastMetric,
+	}
+}
+
+func (s *Service) forecastMetric(ctx context.Context, raw json.RawMessage) (interface{}, error) {
+	const tool = "forecast_metric"
+	var args forecastMetricArgs
+	if err := decodeArgs(tool, raw, &args); err != nil {
+		return nil, err
+	}
+	if args.Metric == "" {
+		args.Metric = "revenue"
+	}
+	metric, ok := semantic.MetricByName(args.Metric)
+	if !ok {
+		return nil, &ArgumentError{Tool: tool, Problem: fmt.Sprintf("unknown metric %q; use one of %s", args.Metric, strings.Join(semantic.MetricNames(), ", "))}
+	}
+	history, err := boundedArg("history", args.History, defaultForecastHistory, maxForecastHistory)
+	if err != nil {
+		return nil, &ArgumentError{Tool: tool, Problem: err.Error()}
+	}
+	horizon, err := boundedArg("horizon", args.Horizon, defaultForecastHorizon, maxForecastHorizon)
+	if err != nil {
+		return nil, &ArgumentError{Tool: tool, Problem: err.Error()}
+	}
+	if args.Level == 0 {
+		args.Level = analytics.ForecastLevels[0]
+	}
+	validLevel := false
+	for _, l := range analytics.ForecastLevels {
+		validLevel = validLevel || l == args.Level
+	}
+	if !validLevel {
+		return nil, &ArgumentError{Tool: tool, Problem: fmt.Sprintf("level must be one of %v", analytics.ForecastLevels)}
+	}
+	datasource, err := s.datasourceName(args.Datasource)
+	if err != nil {
+		return nil, &ArgumentError{Tool: tool, Problem: err.Error()}
+	}
+
+	period, _ := summaryPeriods(s.router.Now(), history)
+	result := &ForecastMetricResult{
+		Datasource: datasource,
+		Metric:     metric.Name,
+		Period:     newTimeRange(period),
+		History:    []ForecastPeriod{},
+		Forecast:   []ForecastPeriod{},
+	}
+
+	filters, err := s.metricFilters(ctx, tool, datasource, args.Filters)
+	if err != nil {
+		return nil, err
+	}
+	result.Partners = filters.partners
+	if filters.unresolved != "" {
+		result.Error, result.Candidates = filters.unresolved, filters.candidates
+		return result, nil
+	}
+
+	sql, sqlArgs, err := semantic.Compile(semantic.Query{
+		Metrics:    []string{metric.Name},
+		Dimensions: []string{"month"},
+		Filters:    filters.ids,
+		TimeRange:  &period,
+		Unlimited:  true,
+	})
+	if err != nil {
+		return nil, &ArgumentError{Tool: tool, Problem: err.Error()}
+	}
+	resp, err := s.executeQuery(ctx, datasource, sql, sqlArgs...)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		result.Error = resp.Error
+		return result, nil
+	}
+
+	months, values, gaps := forecastHistory(resp.Rows, analytics.Months(period.Start, period.End), metric)
+	for i, m := range months {
+		result.History = append(result.History, ForecastPeriod{Period: m.Format("2006-01-02"), Value: values[i]})
+	}
+	opts := analytics.ForecastOptions{Season: 12, Level: args.Level, NonNegative: true}
+	if gaps {
+		// Skipped months would put the seasonal cycle out of step
+		opts.Season = 0
+	}
+	forecast, err := analytics.Forecast(values, horizon, opts)
+	if err != nil {
+		result.Error = fmt.Sprintf("Can't forecast %s: %v", metric.Name, err)
+		return result, nil
+	}
+
+	result.Model, result.Params, result.Level, result.Caveat = forecast.Model, forecast.Params, args.Level, forecastCaveat
+	for i, p := range forecast.Projections {
+		lower, upper := p.Lower, p.Upper
+		result.Forecast = append(result.Forecast, ForecastPeriod{
+			Period: period.End.AddDate(0, i, 0).Format("2006-01-02"),
+			Value:  p.Value,
+			Lower:  &lower,
+			Upper:  &upper,
+		})
+	}
+	return result, nil
+}
+
+// forecastHistory reads a metric's monthly values from the rows of a query,
+// starting at the first month with data. Additive metrics count a missing
+// month as zero; ratio metrics skip it, and gaps reports that they did.
+func forecastHistory(rows []QueryResult, months []time.Time, metric semantic.Metric) ([]time.Time, []float64, bool) {
+	byMonth := make(map[string]float64)
+	for _, row := range rows {
+		month, isTime := row["month"].(time.Time)
+		value, hasValue := toFloat(row[metric.Name])
+		if isTime && hasValue {
+			byMonth[month.Format("2006-01-02")] = value
+		}
+	}
+
+	var (
+		kept   []time.Time
+		values []float64
+		gaps   bool
+	)
+	for _, m := range months {
+		value, found := byMonth[m.Format("2006-01-02")]
+		if !found {
+			if len(values) == 0 {
+				continue
+			}
+			if metric.Ratio {
+				gaps = true
+				continue
+			}
+		}
+		kept = append(kept, m)
+		values = append(values, value)
+	}
+	return kept, values, gaps
+}
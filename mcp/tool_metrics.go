@@ -0,0 +1,244 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/dnc-data-mcp/entity"
+	"github.com/dnc-data-mcp/semantic"
+	"github.com/dnc-data-mcp/timerange"
+)
+
+// defaultMetricsRange is the period query_metrics covers when given none
+const defaultMetricsRange = "last month"
+
+// queryMetricsArgs are the arguments of query_metrics
+type queryMetricsArgs struct {
+	Datasource string   `json:"datasource"`
+	Metrics    []string `json:"metrics"`
+	Dimensions []string `json:"dimensions"`
+	// Filters map a dimension to the values it's limited to. Partners may be
+	// given by name or ID, everything else by ID.
+	Filters   map[string][]interface{} `json:"filters"`
+	TimeRange string                   `json:"time_range"`
+	OrderBy   string                   `json:"order_by"`
+	// Ascending is a pointer so an explicit false can reverse a dimension's
+	// natural order
+	Ascending *bool `json:"ascending"`
+	Limit     int   `json:"limit"`
+}
+
+// MetricsResult is the result of query_metrics
+type MetricsResult struct {
+	QueryResponse
+	// Partners are the partners the partner filter resolved to
+	Partners []PartnerMatch `json:"partners,omitempty"`
+	// SQL is the query the request compiled to
+	SQL string `json:"sql,omitempty"`
+}
+
+// queryMetricsTool computes metrics from the semantic layer, broken down by
+// dimensions, so agents don't have to write the aggregates themselves
+func (s *Service) queryMetricsTool() Tool {
+	var metrics, dimensions []string
+	for _, m := range semantic.Metrics {
+		metrics = append(metrics, m.Name+" ("+m.Description+")")
+	}
+	for _, d := range semantic.Dimensions {
+		dimensions = append(dimensions, d.Name+" ("+d.Description+")")
+	}
+	return Tool{
+		Name: "query_metrics",
+		Description: "Compute metrics, optionally broken down by dimensions, filtered and over a period. " +
+			"Ratios are computed from totals, so TQ is weighted by searches and CTR is clicks / searches. " +
+			"Metrics: " + strings.Join(metrics, "; ") + ". Dimensions: " + strings.Join(dimensions, "; ") + ".",
+		InputSchema: schema([]string{"metrics"}, map[string]interface{}{
+			"datasource": datasourceProperty,
+			"metrics": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string", "enum": semantic.MetricNames()},
+				"minItems":    1,
+				"description": "Metrics to compute",
+			},
+			"dimensions": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string", "enum": semantic.DimensionNames()},
+				"description": "Dimensions to break the metrics down by; totals if omitted",
+			},
+			"filters":    filtersProperty,
+			"time_range": property("string", "Period such as \"last month\", \"Q3\", \"past 90 days\" or \"all time\"; defaults to last month"),
+			"order_by":   property("string", "Metric or dimension to order by; by default month if it's a dimension, else the first metric"),
+			"ascending":  property("boolean", "Order smallest first; metrics default to largest first, dimensions to A to Z or oldest first (false reverses them)"),
+			"limit":      property("integer", fmt.Sprintf("Most rows to return; defaults to %d, at most %d", semantic.DefaultLimit, semantic.MaxLimit)),
+		}),
+		run: s.queryMetrics,
+	}
+}
+
+func (s *Service) queryMetrics(ctx context.Context, raw json.RawMessage) (interface{}, error) {
+	const tool = "query_metrics"
+	var args queryMetricsArgs
+	if err := decodeArgs(tool, raw, &args); err != nil {
+		return nil, err
+	}
+	datasource, err := s.datasourceName(args.Datasource)
+	if err != nil {
+		return nil, &ArgumentError{Tool: tool, Problem: err.Error()}
+	}
+
+	q := semantic.Query{
+		Metrics:    args.Metrics,
+		Dimensions: args.Dimensions,
+		OrderBy:    args.OrderBy,
+		Ascending:  args.Ascending,
+		Limit:      args.Limit,
+	}
+	q.TimeRange, err = s.parseTimeRange(args.TimeRange, defaultMetricsRange)
+	if err != nil {
+		return nil, &ArgumentError{Tool: tool, Problem: err.Error()}
+	}
+
+	result := &MetricsResult{QueryResponse: QueryResponse{Datasource: datasource}}
+	if q.TimeRange != nil {
+		result.TimeRange = newTimeRange(*q.TimeRange)
+	}
+
+	filters, err := s.metricFilters(ctx, tool, datasource, args.Filters)
+	if err != nil {
+		return nil, err
+	}
+	result.Partners = filters.partners
+	if filters.unresolved != "" {
+		result.Error, result.Candidates = filters.unresolved, filters.candidates
+		return result, nil
+	}
+	q.Filters = filters.ids
+
+	sql, sqlArgs, err := semantic.Compile(q)
+	if err != nil {
+		return nil, &ArgumentError{Tool: tool, Problem: err.Error()}
+	}
+	result.SQL = sql
+
+	resp, err := s.executeQuery(ctx, datasource, sql, sqlArgs...)
+	if err != nil {
+		return nil, err
+	}
+	result.Columns, result.Rows, result.Meta, result.Error = resp.Columns, resp.Rows, resp.Meta, resp.Error
+	return result, nil
+}
+
+// resolvedFilters are a tool's filters as IDs by dimension, along with the
+// partners the partner filter named. When a partner can't be resolved,
+// unresolved says why, candidates lists what it might have meant and ids is
+// nil.
+type resolvedFilters struct {
+	ids        map[string][]int64
+	partners   []PartnerMatch
+	unresolved string
+	candidates []PartnerMatch
+}
+
+// metricFilters turns a tool's filters into IDs by dimension. Bad filters give
+// an *ArgumentError; a partner name that can't be resolved is reported on the
+// result instead.
+func (s *Service) metricFilters(ctx context.Context, tool, datasource string, raw map[string][]interface{}) (*resolvedFilters, error) {
+	for name := range raw {
+		if !contains(semantic.FilterDimensions, name) {
+			return nil, &ArgumentError{Tool: tool, Problem: fmt.Sprintf("can't filter by %q; use one of %s", name, strings.Join(semantic.FilterDimensions, ", "))}
+		}
+	}
+	filters := &resolvedFilters{ids: make(map[string][]int64)}
+	for _, name := range semantic.FilterDimensions {
+		values, given := raw[name]
+		if !given {
+			continue
+		}
+		if len(values) == 0 {
+			return nil, &ArgumentError{Tool: tool, Problem: fmt.Sprintf("the %s filter is empty", name)}
+		}
+		if name == "partner" {
+			if !s.resolvePartnerFilter(ctx, datasource, values, filters) {
+				filters.ids = nil
+				return filters, nil
+			}
+			continue
+		}
+		for _, v := range values {
+			id, ok := v.(float64)
+			if !ok || id != float64(int64(id)) {
+				return nil, &ArgumentError{Tool: tool, Problem: fmt.Sprintf("%s filter values must be IDs, got %v", name, v)}
+			}
+			filters.ids[name] = append(filters.ids[name], int64(id))
+		}
+	}
+	return filters, nil
+}
+
+// resolvePartnerFilter adds the IDs of partners given by name or ID to
+// filters, recording the partners used. If one can't be resolved it records
+// why and returns false.
+func (s *Service) resolvePartnerFilter(ctx context.Context, datasource string, values []interface{}, filters *resolvedFilters) bool {
+	for _, v := range values {
+		input := fmt.Sprint(v)
+		if id, ok := v.(float64); ok {
+			input = fmt.Sprintf("#%d", int64(id))
+		}
+		res, err := s.partners.Resolve(ctx, datasource, input)
+		if err != nil {
+			filters.unresolved = err.Error()
+			return false
+		}
+		if res.Status != entity.Resolved {
+			filters.unresolved, filters.candidates = describeUnresolved(res)
+			return false
+		}
+		filters.ids["partner"] = append(filters.ids["partner"], res.Partner.ID)
+		filters.partners = append(filters.partners, newPartnerMatch(fmt.Sprint(v), *res.Partner))
+	}
+	return true
+}
+
+// filtersProperty describes the filters argument of the metrics tools
+var filtersProperty = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"partner": map[string]interface{}{
+			"type":        "array",
+			"items":       map[string]interface{}{"type": []string{"string", "integer"}},
+			"description": "Partner names (matched loosely) or IDs",
+		},
+		"source_tag": map[string]interface{}{
+			"type":        "array",
+			"items":       map[string]interface{}{"type": "integer"},
+			"description": "Source tag IDs; find them with search_source_tags",
+		},
+		"report": map[string]interface{}{
+			"type":        "array",
+			"items":       map[string]interface{}{"type": "integer"},
+			"description": "Report IDs",
+		},
+	},
+	"additionalProperties": false,
+	"description":          "Limit the results to these partners, source tags or reports",
+}
+
+// parseTimeRange parses a tool's time range in the business timezone, using
+// fallback if it's empty. "all time" means no range.
+func (s *Service) parseTimeRange(text, fallback string) (*timerange.Range, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		text = fallback
+	}
+	switch strings.ToLower(text) {
+	case "all", "all time", "ever":
+		return nil, nil
+	}
+	r := timerange.Parse(text, s.router.Now())
+	if r == nil {
+		return nil, fmt.Errorf("couldn't understand the time range %q; try e.g. \"last month\", \"Q3\" or \"from 2024-01-01 to 2024-03-31\"", text)
+	}
+	return r, nil
+}
@@ -0,0 +1,105 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/dnc-data-mcp/entity"
+)
+
+// searchSourceTagsArgs are the arguments of search_source_tags
+type searchSourceTagsArgs struct {
+	Datasource string  `json:"datasource"`
+	Query      string  `json:"query"`
+	Mode       string  `json:"mode"`
+	IDs        []int64 `json:"ids"`
+	Partner    string  `json:"partner"`
+	Limit      int     `json:"limit"`
+}
+
+// SourceTagsResult is the result of search_source_tags
+type SourceTagsResult struct {
+	Datasource string `json:"datasource"`
+	// Partner is the partner the search was limited to, if any
+	Partner *PartnerMatch           `json:"partner,omitempty"`
+	Tags    []entity.SourceTagMatch `json:"tags"`
+	// Candidates are the partners the partner argument could mean, when it
+	// matched none or several
+	Candidates []PartnerMatch `json:"candidates,omitempty"`
+	Error      string         `json:"error,omitempty"`
+}
+
+// searchSourceTagsTool finds source tags (traffic sources) by name, ID or
+// partner, so agents can turn "the bing tags for Acme" into tag IDs
+func (s *Service) searchSourceTagsTool() Tool {
+	return Tool{
+		Name: "search_source_tags",
+		Description: "Find source tags (traffic sources) by name, ID or partner. Names match by prefix, " +
+			"substring or fuzzily, best first, e.g. query \"bing\" with partner \"Acme\" for Acme's bing tags. " +
+			"Use the returned IDs in later queries.",
+		InputSchema: schema(nil, map[string]interface{}{
+			"datasource": datasourceProperty,
+			"query":      property("string", "Text to match against tag names, e.g. \"bing\" or \"acme_search_disp\""),
+			"mode": map[string]interface{}{
+				"type":        "string",
+				"enum":        entity.SearchModes,
+				"description": "Only allow this kind of match; every kind if omitted",
+			},
+			"ids": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "integer"},
+				"description": "Only these tag IDs",
+			},
+			"partner": property("string", "Only this partner's tags; a name (matched loosely) or an ID"),
+			"limit":   property("integer", "Most tags to return; defaults to 20"),
+		}),
+		run: s.searchSourceTags,
+	}
+}
+
+func (s *Service) searchSourceTags(ctx context.Context, raw json.RawMessage) (interface{}, error) {
+	const tool = "search_source_tags"
+	var args searchSourceTagsArgs
+	if err := decodeArgs(tool, raw, &args); err != nil {
+		return nil, err
+	}
+	if args.Mode != "" && !contains(entity.SearchModes, args.Mode) {
+		return nil, &ArgumentError{Tool: tool, Problem: "mode must be one of " + strings.Join(entity.SearchModes, ", ")}
+	}
+	if args.Limit < 0 {
+		return nil, &ArgumentError{Tool: tool, Problem: "limit must be positive"}
+	}
+	datasource, err := s.datasourceName(args.Datasource)
+	if err != nil {
+		return nil, &ArgumentError{Tool: tool, Problem: err.Error()}
+	}
+
+	result := &SourceTagsResult{Datasource: datasource, Tags: []entity.SourceTagMatch{}}
+	q := entity.SourceTagQuery{Text: args.Query, Mode: args.Mode, IDs: args.IDs, Limit: args.Limit}
+
+	if args.Partner != "" {
+		res, err := s.partners.Resolve(ctx, datasource, args.Partner)
+		if err != nil {
+			result.Error = err.Error()
+			return result, nil
+		}
+		if res.Status != entity.Resolved {
+			result.Error, result.Candidates = describeUnresolved(res)
+			return result, nil
+		}
+		match := newPartnerMatch(args.Partner, *res.Partner)
+		result.Partner = &match
+		q.PartnerID = res.Partner.ID
+	}
+
+	tags, err := s.sourceTags.Search(ctx, datasource, q)
+	if err != nil {
+		result.Error = err.Error()
+		return result, nil
+	}
+	if tags != nil {
+		result.Tags = tags
+	}
+	return result, nil
+}
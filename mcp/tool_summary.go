@@ -0,0 +1,266 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dnc-data-mcp/entity"
+	"github.com/dnc-data-mcp/semantic"
+	"github.com/dnc-data-mcp/timerange"
+)
+
+const (
+	// defaultSummaryMonths is how many full months a partner summary's trend covers
+	defaultSummaryMonths = 6
+	// maxSummaryMonths caps the trend
+	maxSummaryMonths = 24
+	// defaultSummaryMovers is how many of the partner's tags are listed as movers
+	defaultSummaryMovers = 5
+	// maxSummaryMovers caps the movers
+	maxSummaryMovers = 50
+)
+
+// partnerSummaryArgs are the arguments of partner_summary
+type partnerSummaryArgs struct {
+	Datasource string `json:"datasource"`
+	Partner    string `json:"partner"`
+	Months     int    `json:"months"`
+	Movers     int    `json:"movers"`
+}
+
+// PartnerSummary is the result of partner_summary. A section whose query
+// failed is left empty and its error recorded in Errors.
+type PartnerSummary struct {
+	Datasource string        `json:"datasource"`
+	Partner    *PartnerMatch `json:"partner,omitempty"`
+	// Candidates are the partners the partner argument could mean, when it
+	// matched none or several
+	Candidates []PartnerMatch `json:"candidates,omitempty"`
+	// Profile is the partner's row with its status name and start date
+	Profile QueryResult `json:"profile,omitempty"`
+	// Period is the full months the trend, reports and tags cover
+	Period *TimeRange `json:"period,omitempty"`
+	// SourceTags are the partner's tags with traffic in the last month,
+	// busiest first
+	SourceTags []QueryResult `json:"source_tags"`
+	// Trend is revenue, searches, clicks and TQ by month
+	Trend []QueryResult `json:"trend"`
+	// Reports are the yield enhancement reports the partner appears on
+	Reports []QueryResult `json:"reports"`
+	// Movers are the partner's tags whose revenue changed most in the last
+	// month against the month before
+	Movers []QueryResult     `json:"movers"`
+	Errors map[string]string `json:"errors,omitempty"`
+	Error  string            `json:"error,omitempty"`
+}
+
+// summaryQuery is one section of a partner summary
+type summaryQuery struct {
+	name string
+	sql  string
+	args []interface{}
+	// into receives the section's rows
+	into func(rows []QueryResult)
+}
+
+// partnerSummaryTool answers the questions account managers ask about one
+// partner every day in a single call
+func (s *Service) partnerSummaryTool() Tool {
+	return Tool{
+		Name: "partner_summary",
+		Description: "Everything about one partner at once: status, source tags active last month, a monthly trend of " +
+			"revenue, searches, clicks and TQ, the yield enhancement reports it appears on, and its source tags whose " +
+			"revenue moved most last month.",
+		InputSchema: schema([]string{"partner"}, map[string]interface{}{
+			"datasource": datasourceProperty,
+			"partner":    property("string", "The partner; a name (matched loosely) or an ID"),
+			"months":     property("integer", fmt.Sprintf("Full months of trend and reports; defaults to %d, at most %d", defaultSummaryMonths, maxSummaryMonths)),
+			"movers":     property("integer", fmt.Sprintf("How many moving source tags to list; defaults to %d, at most %d", defaultSummaryMovers, maxSummaryMovers)),
+		}),
+		run: s.partnerSummary,
+	}
+}
+
+func (s *Service) partnerSummary(ctx context.Context, raw json.RawMessage) (interface{}, error) {
+	const tool = "partner_summary"
+	var args partnerSummaryArgs
+	if err := decodeArgs(tool, raw, &args); err != nil {
+		return nil, err
+	}
+	if args.Partner == "" {
+		return nil, &ArgumentError{Tool: tool, Problem: "partner is required"}
+	}
+	months, err := boundedArg("months", args.Months, defaultSummaryMonths, maxSummaryMonths)
+	if err != nil {
+		return nil, &ArgumentError{Tool: tool, Problem: err.Error()}
+	}
+	movers, err := boundedArg("movers", args.Movers, defaultSummaryMovers, maxSummaryMovers)
+	if err != nil {
+		return nil, &ArgumentError{Tool: tool, Problem: err.Error()}
+	}
+	datasource, err := s.datasourceName(args.Datasource)
+	if err != nil {
+		return nil, &ArgumentError{Tool: tool, Problem: err.Error()}
+	}
+
+	summary := &PartnerSummary{
+		Datasource: datasource,
+		SourceTags: []QueryResult{},
+		Trend:      []QueryResult{},
+		Reports:    []QueryResult{},
+		Movers:     []QueryResult{},
+	}
+	res, err := s.partners.Resolve(ctx, datasource, args.Partner)
+	if err != nil {
+		summary.Error = err.Error()
+		return summary, nil
+	}
+	if res.Status != entity.Resolved {
+		summary.Error, summary.Candidates = describeUnresolved(res)
+		return summary, nil
+	}
+	match := newPartnerMatch(args.Partner, *res.Partner)
+	summary.Partner = &match
+
+	period, lastMonth := summaryPeriods(s.router.Now(), months)
+	summary.Period = newTimeRange(period)
+
+	queries, err := summaryQueries(res.Partner.ID, period, lastMonth, movers, summary)
+	if err != nil {
+		return nil, err
+	}
+	summary.Errors = s.runSummaryQueries(ctx, datasource, queries)
+	return summary, nil
+}
+
+// summaryPeriods returns the last n full months before now, and the last of
+// them
+func summaryPeriods(now time.Time, n int) (timerange.Range, timerange.Range) {
+	thisMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	period := timerange.Range{Start: thisMonth.AddDate(0, -n, 0), End: thisMonth, Label: fmt.Sprintf("last %d months", n)}
+	lastMonth := timerange.Range{Start: thisMonth.AddDate(0, -1, 0), End: thisMonth, Label: "last month"}
+	return period, lastMonth
+}
+
+// summaryQueries builds the queries of a partner summary, each filling its
+// section of summary
+func summaryQueries(partnerID int64, period, lastMonth timerange.Range, movers int, summary *PartnerSummary) ([]summaryQuery, error) {
+	partner := map[string][]int64{"partner": {partnerID}}
+	queries := []summaryQuery{{
+		name: "profile",
+		sql: `
+			SELECT p.id as partner_id, p.name, ps.status, p.created_at
+			FROM partners.partners p
+			JOIN partners.partner_status ps ON p.status = ps.id
+			WHERE p.id = $1
+		`,
+		args: []interface{}{partnerID},
+		into: func(rows []QueryResult) {
+			if len(rows) > 0 {
+				summary.Profile = rows[0]
+			}
+		},
+	}}
+
+	sql, args, err := semantic.Compile(semantic.Query{
+		Metrics:    []string{"searches", "revenue", "tq"},
+		Dimensions: []string{"source_tag"},
+		Filters:    partner,
+		TimeRange:  &lastMonth,
+		Limit:      semantic.MaxLimit,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to build the source tags query: %v", err)
+	}
+	queries = append(queries, summaryQuery{name: "source_tags", sql: sql, args: args, into: func(rows []QueryResult) { summary.SourceTags = rows }})
+
+	sql, args, err = semantic.Compile(semantic.Query{
+		Metrics:    []string{"revenue", "searches", "clicks", "tq"},
+		Dimensions: []string{"month"},
+		Filters:    partner,
+		TimeRange:  &period,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to build the trend query: %v", err)
+	}
+	queries = append(queries, summaryQuery{name: "trend", sql: sql, args: args, into: func(rows []QueryResult) { summary.Trend = rows }})
+
+	sql, args, err = semantic.Compile(semantic.Query{
+		Metrics:    []string{"revenue", "searches"},
+		Dimensions: []string{"report"},
+		Filters:    partner,
+		TimeRange:  &period,
+		OrderBy:    "report",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to build the reports query: %v", err)
+	}
+	queries = append(queries, summaryQuery{name: "reports", sql: sql, args: args, into: func(rows []QueryResult) { summary.Reports = rows }})
+
+	sql, args, err = semantic.CompileComparison(semantic.Comparison{
+		Metric:     "revenue",
+		Dimensions: []string{"source_tag"},
+		Filters:    partner,
+		Current:    lastMonth,
+		Previous:   lastMonth.Previous(),
+		Limit:      movers,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to build the movers query: %v", err)
+	}
+	queries = append(queries, summaryQuery{name: "movers", sql: sql, args: args, into: func(rows []QueryResult) { summary.Movers = rows }})
+	return queries, nil
+}
+
+// runSummaryQueries runs the queries concurrently, handing each its rows, and
+// returns the errors of those that failed by name
+func (s *Service) runSummaryQueries(ctx context.Context, datasource string, queries []summaryQuery) map[string]string {
+	responses := make([]*QueryResponse, len(queries))
+	errs := make([]error, len(queries))
+	var wg sync.WaitGroup
+	for i, q := range queries {
+		wg.Add(1)
+		go func(i int, q summaryQuery) {
+			defer wg.Done()
+			responses[i], errs[i] = s.executeQuery(ctx, datasource, q.sql, q.args...)
+		}(i, q)
+	}
+	wg.Wait()
+
+	var failed map[string]string
+	for i, q := range queries {
+		problem := ""
+		switch {
+		case errs[i] != nil:
+			problem = errs[i].Error()
+		case responses[i].Error != "":
+			problem = responses[i].Error
+		}
+		if problem != "" {
+			if failed == nil {
+				failed = make(map[string]string)
+			}
+			failed[q.name] = problem
+			continue
+		}
+		if responses[i].Rows != nil {
+			q.into(responses[i].Rows)
+		}
+	}
+	return failed
+}
+
+// boundedArg returns an integer argument, fallback if it's 0, or an error if
+// it's outside 1 to limit
+func boundedArg(name string, value, fallback, limit int) (int, error) {
+	if value == 0 {
+		return fallback, nil
+	}
+	if value < 0 || value > limit {
+		return 0, fmt.Errorf("%s must be between 1 and %d", name, limit)
+	}
+	return value, nil
+}
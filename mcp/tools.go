@@ -0,0 +1,102 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// UnknownToolError is returned by CallTool for a tool that doesn't exist
+type UnknownToolError struct {
+	Name string
+}
+
+func (e *UnknownToolError) Error() string {
+	return fmt.Sprintf("unknown tool: %q", e.Name)
+}
+
+// ArgumentError reports arguments a tool can't run with
+type ArgumentError struct {
+	Tool    string
+	Problem string
+}
+
+func (e *ArgumentError) Error() string {
+	return fmt.Sprintf("invalid arguments for %s: %s", e.Tool, e.Problem)
+}
+
+// Tool is an operation agents can call with JSON arguments, alongside free
+// text queries
+type Tool struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// InputSchema is a JSON Schema describing the arguments
+	InputSchema map[string]interface{} `json:"input_schema"`
+
+	run func(ctx context.Context, args json.RawMessage) (interface{}, error)
+}
+
+// Tools returns every tool in the order they were registered
+func (s *Service) Tools() []Tool {
+	return s.tools
+}
+
+// CallTool runs the named tool with JSON arguments. Bad arguments give an
+// *ArgumentError and an unknown tool an *UnknownToolError.
+func (s *Service) CallTool(ctx context.Context, name string, args json.RawMessage) (interface{}, error) {
+	for _, t := range s.tools {
+		if t.Name == name {
+			if len(bytes.TrimSpace(args)) == 0 {
+				args = json.RawMessage("{}")
+			}
+			return t.run(ctx, args)
+		}
+	}
+	return nil, &UnknownToolError{Name: name}
+}
+
+// registerTools sets up every tool the service offers
+func (s *Service) registerTools() {
+	s.tools = []Tool{
+		s.searchSourceTagsTool(),
+		s.queryMetricsTool(),
+		s.compareMetricsTool(),
+		s.partnerSummaryTool(),
+		s.findAnomaliesTool(),
+		s.forecastMetricTool(),
+		s.cohortRetentionTool(),
+	}
+}
+
+// decodeArgs decodes a tool's JSON arguments into v, rejecting unknown fields
+// so typos don't go unnoticed
+func decodeArgs(tool string, args json.RawMessage, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(args))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return &ArgumentError{Tool: tool, Problem: err.Error()}
+	}
+	return nil
+}
+
+// schema builds a JSON Schema for an object with the given properties
+func schema(required []string, properties map[string]interface{}) map[string]interface{} {
+	s := map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
+
+// property builds a JSON Schema property of the given type
+func property(typ, description string) map[string]interface{} {
+	return map[string]interface{}{"type": typ, "description": description}
+}
+
+// datasourceProperty is the optional datasource argument every tool takes
+var datasourceProperty = property("string", "Datasource to use; the default one if omitted")
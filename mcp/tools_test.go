@@ -0,0 +1,534 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dnc-data-mcp/db/dbtest"
+	"github.com/dnc-data-mcp/semantic"
+)
+
+// newFakeTags returns a fake with partners and source tags to search
+func newFakeTags() *dbtest.Fake {
+	return dbtest.New("ro-traffic", "billing").
+		On("select id, name from partners.partners", dbtest.Result(
+			[]string{"id", "name"},
+			[]interface{}{int64(1), "DNC"},
+			[]interface{}{int64(2), "Acme Media LLC"},
+		)).
+		On("from partners.partner_aliases", dbtest.Result([]string{"partner_id", "alias"})).
+		On("from yer_analysis.source_tags", dbtest.Result(
+			[]string{"id", "name", "partner_id", "partner_name"},
+			[]interface{}{int64(10), "acme_search_bing_display", int64(2), "Acme Media LLC"},
+			[]interface{}{int64(11), "acme_search_bing_mobile", int64(2), "Acme Media LLC"},
+			[]interface{}{int64(12), "acme_search_yahoo", int64(2), "Acme Media LLC"},
+			[]interface{}{int64(20), "dnc_bing_newtab", int64(1), "DNC"},
+		))
+}
+
+// newToolService returns a service over fake with the clock pinned to
+// 15 March 2024, so "last month" is February
+func newToolService(fake *dbtest.Fake) *Service {
+	service := NewService(fake)
+	service.router.Now = func() time.Time {
+		return time.Date(2024, time.March, 15, 10, 0, 0, 0, time.UTC)
+	}
+	return service
+}
+
+func TestSearchSourceTagsTool(t *testing.T) {
+	testCases := []struct {
+		name     string
+		args     string
+		validate func(*testing.T, *SourceTagsResult)
+	}{
+		{
+			name: "Bing Tags For Acme",
+			args: `{"query": "bing", "partner": "acme"}`,
+			validate: func(t *testing.T, r *SourceTagsResult) {
+				if r.Partner == nil || r.Partner.ID != 2 {
+					t.Errorf("Expected Acme Media LLC to be used, got %+v", r.Partner)
+				}
+				if len(r.Tags) != 2 || r.Tags[0].ID != 10 || r.Tags[1].ID != 11 {
+					t.Errorf("Expected Acme's two bing tags, got %+v", r.Tags)
+				}
+			},
+		},
+		{
+			name: "All Partners",
+			args: `{"query": "bing", "mode": "prefix"}`,
+			validate: func(t *testing.T, r *SourceTagsResult) {
+				if len(r.Tags) != 3 || r.Partner != nil {
+					t.Errorf("Expected every bing tag, got %+v", r)
+				}
+			},
+		},
+		{
+			name: "By ID",
+			args: `{"ids": [12]}`,
+			validate: func(t *testing.T, r *SourceTagsResult) {
+				if len(r.Tags) != 1 || r.Tags[0].Name != "acme_search_yahoo" {
+					t.Errorf("Expected the yahoo tag, got %+v", r.Tags)
+				}
+			},
+		},
+		{
+			name: "Unknown Partner",
+			args: `{"query": "bing", "partner": "zebra"}`,
+			validate: func(t *testing.T, r *SourceTagsResult) {
+				if r.Error == "" || len(r.Tags) != 0 {
+					t.Errorf("Expected an error and no tags, got %+v", r)
+				}
+			},
+		},
+		{
+			name: "No Matches",
+			args: `{"query": "zzz", "mode": "substring"}`,
+			validate: func(t *testing.T, r *SourceTagsResult) {
+				if r.Error != "" || r.Tags == nil || len(r.Tags) != 0 {
+					t.Errorf("Expected an empty list, got %+v", r)
+				}
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			service := NewService(newFakeTags())
+			result, err := service.CallTool(context.Background(), "search_source_tags", json.RawMessage(tc.args))
+			if err != nil {
+				t.Fatalf("Failed to call tool: %v", err)
+			}
+			tc.validate(t, result.(*SourceTagsResult))
+		})
+	}
+}
+
+func TestQueryMetricsTool(t *testing.T) {
+	testCases := []struct {
+		name     string
+		args     string
+		validate func(*testing.T, *MetricsResult, *dbtest.Fake)
+	}{
+		{
+			name: "Revenue By Partner",
+			args: `{"metrics": ["revenue", "tq"], "dimensions": ["partner"], "time_range": "Q3"}`,
+			validate: func(t *testing.T, r *MetricsResult, fake *dbtest.Fake) {
+				if r.Error != "" || len(r.Rows) != 1 || r.Rows[0]["revenue"] != 1200.5 {
+					t.Fatalf("Expected one row of revenue, got %+v", r)
+				}
+				if r.TimeRange == nil || r.TimeRange.Start != "2023-07-01" {
+					t.Errorf("Expected last Q3, got %+v", r.TimeRange)
+				}
+				if !strings.Contains(r.SQL, "GROUP BY p.id, p.name") {
+					t.Errorf("Expected the SQL to group by partner, got %s", r.SQL)
+				}
+			},
+		},
+		{
+			name: "Partner Filter By Name And ID",
+			args: `{"metrics": ["ctr"], "filters": {"partner": ["acme", 1], "source_tag": [10]}, "time_range": "all time"}`,
+			validate: func(t *testing.T, r *MetricsResult, fake *dbtest.Fake) {
+				if len(r.Partners) != 2 || r.Partners[0].ID != 2 || r.Partners[1].ID != 1 {
+					t.Fatalf("Expected Acme and DNC to be used, got %+v", r.Partners)
+				}
+				if r.TimeRange != nil {
+					t.Errorf("Expected no time range, got %+v", r.TimeRange)
+				}
+				calls := fake.Calls()
+				last := calls[len(calls)-1]
+				ids, ok := last.Args[0].([]int64)
+				if !ok || len(ids) != 2 || ids[0] != 2 || ids[1] != 1 {
+					t.Errorf("Expected the partner IDs as the first argument, got %+v", last.Args)
+				}
+			},
+		},
+		{
+			name: "Unknown Partner",
+			args: `{"metrics": ["revenue"], "filters": {"partner": ["zebra"]}}`,
+			validate: func(t *testing.T, r *MetricsResult, fake *dbtest.Fake) {
+				if r.Error == "" || r.SQL != "" {
+					t.Errorf("Expected an error and no query, got %+v", r)
+				}
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := newFakeTags().On("from yer_analysis.v_yer_items yi", dbtest.Result(
+				[]string{"partner_id", "partner_name", "revenue", "tq"},
+				[]interface{}{int64(2), "Acme Media LLC", 1200.5, 0.82},
+			))
+			service := newToolService(fake)
+			result, err := service.CallTool(context.Background(), "query_metrics", json.RawMessage(tc.args))
+			if err != nil {
+				t.Fatalf("Failed to call tool: %v", err)
+			}
+			tc.validate(t, result.(*MetricsResult), fake)
+		})
+	}
+}
+
+func TestCompareMetricsTool(t *testing.T) {
+	testCases := []struct {
+		name     string
+		args     string
+		validate func(*testing.T, *MetricsResult, []interface{})
+	}{
+		{
+			name: "Month Over Month",
+			args: `{"metric": "tq", "dimensions": ["source_tag"], "direction": "increase"}`,
+			validate: func(t *testing.T, r *MetricsResult, args []interface{}) {
+				if r.TimeRange == nil || r.TimeRange.Start != "2024-02-01" || r.TimeRange.Compare == nil || r.TimeRange.Compare.Start != "2024-01-01" {
+					t.Errorf("Expected February against January, got %+v", r.TimeRange)
+				}
+				if len(args) != 6 || args[4] != int64(semantic.DefaultMinSearches) {
+					t.Errorf("Expected the default minimum searches for TQ, got %+v", args)
+				}
+				if len(r.Rows) != 1 || r.Rows[0]["change"] != 0.05 {
+					t.Errorf("Unexpected rows: %+v", r.Rows)
+				}
+			},
+		},
+		{
+			name: "Year Over Year For A Partner",
+			args: `{"metric": "revenue", "dimensions": ["source_tag"], "current": "Q3", "previous": "year ago", "filters": {"partner": ["acme"]}}`,
+			validate: func(t *testing.T, r *MetricsResult, args []interface{}) {
+				if r.TimeRange == nil || r.TimeRange.Start != "2023-07-01" || r.TimeRange.Compare == nil || r.TimeRange.Compare.Start != "2022-07-01" {
+					t.Errorf("Expected Q3 against the Q3 before, got %+v", r.TimeRange)
+				}
+				if len(r.Partners) != 1 || r.Partners[0].ID != 2 {
+					t.Errorf("Expected Acme to be used, got %+v", r.Partners)
+				}
+				if len(args) != 6 {
+					t.Errorf("Expected two periods, the partner and the limit as arguments, got %+v", args)
+				}
+			},
+		},
+		{
+			name: "No Minimum",
+			args: `{"metric": "ctr", "current": "last week", "previous": "from 2024-01-01 to 2024-01-07", "min_searches": 0}`,
+			validate: func(t *testing.T, r *MetricsResult, args []interface{}) {
+				if r.TimeRange.Compare == nil || r.TimeRange.Compare.Start != "2024-01-01" || r.TimeRange.Compare.End != "2024-01-08" {
+					t.Errorf("Expected the given previous period, got %+v", r.TimeRange)
+				}
+				if strings.Contains(r.SQL, "searches >=") {
+					t.Errorf("Expected no minimum searches, got %s", r.SQL)
+				}
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := newFakeTags().On("with current_data as", dbtest.Result(
+				[]string{"sourcetag_id", "sourcetag_name", "current_tq", "previous_tq", "change", "percent_change"},
+				[]interface{}{int64(10), "acme_search_bing_display", 0.85, 0.8, 0.05, 6.25},
+			))
+			service := newToolService(fake)
+			result, err := service.CallTool(context.Background(), "compare_metrics", json.RawMessage(tc.args))
+			if err != nil {
+				t.Fatalf("Failed to call tool: %v", err)
+			}
+			calls := fake.Calls()
+			tc.validate(t, result.(*MetricsResult), calls[len(calls)-1].Args)
+		})
+	}
+}
+
+func TestPartnerSummaryTool(t *testing.T) {
+	fake := newFakeTags().
+		On("ps.status, p.created_at", dbtest.Result(
+			[]string{"partner_id", "name", "status", "created_at"},
+			[]interface{}{int64(2), "Acme Media LLC", "active", "2021-04-01"},
+		)).
+		On("with current_data as", dbtest.Result(
+			[]string{"sourcetag_id", "sourcetag_name", "change"},
+			[]interface{}{int64(11), "acme_search_bing_mobile", -820.0},
+		)).
+		On("as month", dbtest.Result(
+			[]string{"month", "revenue", "searches", "clicks", "tq"},
+			[]interface{}{"2024-01-01", 1000.0, int64(50000), int64(900), 0.8},
+			[]interface{}{"2024-02-01", 1100.0, int64(52000), int64(950), 0.82},
+		)).
+		On("as report_id", dbtest.Result(
+			[]string{"report_id", "report_name", "revenue", "searches"},
+			[]interface{}{int64(7), "YER 2024-02", 1100.0, int64(52000)},
+		)).
+		OnError("as sourcetag_id", errors.New("canceling statement due to statement timeout"))
+	service := newToolService(fake)
+
+	result, err := service.CallTool(context.Background(), "partner_summary", json.RawMessage(`{"partner": "acme", "months": 2}`))
+	if err != nil {
+		t.Fatalf("Failed to call tool: %v", err)
+	}
+	summary := result.(*PartnerSummary)
+
+	if summary.Partner == nil || summary.Partner.ID != 2 || summary.Profile["status"] != "active" {
+		t.Errorf("Expected Acme Media LLC's profile, got %+v and %+v", summary.Partner, summary.Profile)
+	}
+	if summary.Period == nil || summary.Period.Start != "2024-01-01" || summary.Period.End != "2024-03-01" {
+		t.Errorf("Expected January and February, got %+v", summary.Period)
+	}
+	if len(summary.Trend) != 2 || len(summary.Reports) != 1 || len(summary.Movers) != 1 {
+		t.Errorf("Expected every section but the tags, got %+v", summary)
+	}
+	// A failed section leaves the rest intact
+	if len(summary.SourceTags) != 0 || summary.Errors["source_tags"] == "" || len(summary.Errors) != 1 {
+		t.Errorf("Expected only the source tags to fail, got %+v", summary.Errors)
+	}
+
+	// Every section is a query of its own, all filtered to the partner
+	var sections int
+	for _, c := range fake.Calls() {
+		if strings.Contains(c.SQL, "yi.partner_id = ANY(") || strings.Contains(c.SQL, "ps.status") {
+			sections++
+		}
+	}
+	if sections != 5 {
+		t.Errorf("Expected 5 queries for the summary, got %d", sections)
+	}
+
+	unresolved, err := service.CallTool(context.Background(), "partner_summary", json.RawMessage(`{"partner": "zebra"}`))
+	if err != nil {
+		t.Fatalf("Failed to call tool: %v", err)
+	}
+	if s := unresolved.(*PartnerSummary); s.Error == "" || s.Profile != nil {
+		t.Errorf("Expected an error and no summary for an unknown partner, got %+v", s)
+	}
+}
+
+func TestFindAnomaliesTool(t *testing.T) {
+	// Eight months of two tags: the display tag's TQ collapses in February
+	// and the mobile tag's traffic stops
+	columns := []string{"sourcetag_id", "sourcetag_name", "month", "tq", "searches"}
+	var rows [][]interface{}
+	for i := 0; i < 8; i++ {
+		month := time.Date(2023, time.July, 1, 0, 0, 0, 0, time.UTC).AddDate(0, i, 0)
+		tq := 0.8 + float64(i%2)/100
+		if i == 7 {
+			tq = 0.4
+		}
+		rows = append(rows, []interface{}{int64(10), "acme_search_bing_display", month, tq, 20000.0})
+		if i < 7 {
+			rows = append(rows, []interface{}{int64(11), "acme_search_bing_mobile", month, 0.7, 9000.0 + float64(i*10)})
+		}
+	}
+	fake := newFakeTags().On("as month", dbtest.Result(columns, rows...))
+	service := newToolService(fake)
+
+	result, err := service.CallTool(context.Background(), "find_anomalies",
+		json.RawMessage(`{"metrics": ["tq", "searches"], "months": 8, "filters": {"partner": ["acme"]}}`))
+	if err != nil {
+		t.Fatalf("Failed to call tool: %v", err)
+	}
+	r := result.(*AnomaliesResult)
+
+	if r.Period == nil || r.Period.Start != "2023-07-01" || r.Period.End != "2024-03-01" {
+		t.Errorf("Expected July to February, got %+v", r.Period)
+	}
+	if len(r.Partners) != 1 || r.Partners[0].ID != 2 || r.Scanned != 4 {
+		t.Errorf("Expected Acme's 2 tags scanned for 2 metrics, got %+v", r)
+	}
+	kinds := make(map[string]bool)
+	for _, f := range r.Findings {
+		kinds[f.Metric+" "+f.Kind+" "+f.Name] = true
+	}
+	if len(r.Findings) != 2 || !kinds["tq drop acme_search_bing_display"] || !kinds["searches disappeared acme_search_bing_mobile"] {
+		t.Errorf("Expected a TQ drop and disappearing traffic, got %+v", r.Findings)
+	}
+
+	calls := fake.Calls()
+	if sql := calls[len(calls)-1].SQL; strings.Contains(sql, "LIMIT") || !strings.Contains(sql, "yi.partner_id = ANY(") {
+		t.Errorf("Expected every row of the partner's tags, got %s", sql)
+	}
+}
+
+func TestForecastMetricTool(t *testing.T) {
+	// Acme's revenue starts in May and grows 100 a month, with nothing in
+	// August
+	var rows [][]interface{}
+	for i := 0; i < 10; i++ {
+		if i == 3 {
+			continue
+		}
+		month := time.Date(2023, time.May, 1, 0, 0, 0, 0, time.UTC).AddDate(0, i, 0)
+		rows = append(rows, []interface{}{month, 1000 + 100*float64(i)})
+	}
+	fake := newFakeTags().On("as month", dbtest.Result([]string{"month", "revenue"}, rows...))
+	service := newToolService(fake)
+
+	result, err := service.CallTool(context.Background(), "forecast_metric",
+		json.RawMessage(`{"filters": {"partner": ["acme"]}, "history": 12, "horizon": 2, "level": 0.95}`))
+	if err != nil {
+		t.Fatalf("Failed to call tool: %v", err)
+	}
+	r := result.(*ForecastMetricResult)
+
+	if r.Period == nil || r.Period.Start != "2023-03-01" || r.Period.End != "2024-03-01" {
+		t.Errorf("Expected March to February, got %+v", r.Period)
+	}
+	if len(r.Partners) != 1 || r.Partners[0].ID != 2 || r.Metric != "revenue" || r.Level != 0.95 {
+		t.Errorf("Expected Acme's revenue at 95%%, got %+v", r)
+	}
+	// History starts with the first month of revenue; August counts as zero
+	if len(r.History) != 10 || r.History[0].Period != "2023-05-01" || r.History[3].Value != 0 {
+		t.Errorf("Expected May to February with August empty, got %+v", r.History)
+	}
+	if r.Model != "linear_trend" || len(r.Forecast) != 2 || r.Forecast[0].Period != "2024-03-01" || r.Forecast[1].Period != "2024-04-01" {
+		t.Fatalf("Expected a linear trend over March and April, got %+v", r)
+	}
+	for _, f := range r.Forecast {
+		if f.Lower == nil || f.Upper == nil {
+			t.Fatalf("Expected an interval around %+v", f)
+		}
+		if *f.Lower > f.Value || *f.Upper < f.Value {
+			t.Errorf("Expected an interval around %+v", f)
+		}
+	}
+	if r.Caveat == "" {
+		t.Errorf("Expected a caveat with the forecast")
+	}
+
+	calls := fake.Calls()
+	if sql := calls[len(calls)-1].SQL; strings.Contains(sql, "LIMIT") || !strings.Contains(sql, "yi.partner_id = ANY(") {
+		t.Errorf("Expected every month of the partner's revenue, got %s", sql)
+	}
+
+	// Two months aren't enough to forecast from
+	service = newToolService(newFakeTags().On("as month", dbtest.Result([]string{"month", "revenue"}, rows[len(rows)-2:]...)))
+	result, err = service.CallTool(context.Background(), "forecast_metric", json.RawMessage(`{"metric": "revenue", "history": 12}`))
+	if err != nil {
+		t.Fatalf("Failed to call tool: %v", err)
+	}
+	if r := result.(*ForecastMetricResult); r.Error == "" || len(r.Forecast) != 0 {
+		t.Errorf("Expected too little history to be an error, got %+v", r)
+	}
+}
+
+func TestCohortRetentionTool(t *testing.T) {
+	columns := []string{"partner_id", "partner_name", "month", "revenue", "searches"}
+	month := func(year int, m time.Month) time.Time {
+		return time.Date(year, m, 1, 0, 0, 0, 0, time.UTC)
+	}
+	// DNC is old; Acme starts in December and stays, Zeta starts in January
+	// and leaves; Nova's first month is this one, which isn't over
+	fake := newFakeTags().On("as month", dbtest.Result(columns,
+		[]interface{}{int64(1), "DNC", month(2023, time.October), 500.0, 9000.0},
+		[]interface{}{int64(1), "DNC", month(2024, time.January), 480.0, 8800.0},
+		[]interface{}{int64(2), "Acme Media LLC", month(2023, time.December), 100.0, 2000.0},
+		[]interface{}{int64(2), "Acme Media LLC", month(2024, time.January), 150.0, 2500.0},
+		[]interface{}{int64(2), "Acme Media LLC", month(2024, time.February), 80.0, 1900.0},
+		[]interface{}{int64(3), "Zeta", month(2024, time.January), 40.0, 700.0},
+		[]interface{}{int64(5), "Nova", month(2024, time.March), 10.0, 100.0},
+	))
+	service := newToolService(fake)
+
+	result, err := service.CallTool(context.Background(), "cohort_retention", json.RawMessage(`{"cohorts": 3}`))
+	if err != nil {
+		t.Fatalf("Failed to call tool: %v", err)
+	}
+	r := result.(*CohortsResult)
+
+	if r.By != "partner" || r.Granularity != "month" || r.Period == nil || r.Period.Start != "2023-12-01" || r.Period.End != "2024-03-01" {
+		t.Errorf("Expected partners by month from December to February, got %+v", r)
+	}
+	if len(r.Cohorts) != 2 || r.Cohorts[0].Period != "2023-12-01" || r.Cohorts[1].Period != "2024-01-01" {
+		t.Fatalf("Expected December's and January's cohorts, got %+v", r.Cohorts)
+	}
+	if p := r.Cohorts[0].Periods; len(p) != 3 || p[2].Active != 1 || p[2].RevenueRetention == nil || *p[2].RevenueRetention != 80 {
+		t.Errorf("Expected Acme still active in February on 80%% of December's revenue, got %+v", p)
+	}
+	if p := r.Cohorts[1].Periods; len(p) != 2 || p[1].Active != 0 || p[1].ActiveRetention != 0 {
+		t.Errorf("Expected Zeta gone in February, got %+v", p)
+	}
+	if len(r.Average) != 3 || r.Average[1].Active != 1 || r.Average[1].ActiveRetention != 50 {
+		t.Errorf("Expected one of two partners left a month on, got %+v", r.Average)
+	}
+
+	calls := fake.Calls()
+	if sql := calls[len(calls)-1].SQL; strings.Contains(sql, "LIMIT") || strings.Contains(sql, "r.end_date >=") {
+		t.Errorf("Expected all of history, got %s", sql)
+	}
+
+	// By report, a rerun ending the same day as the report it replaces is
+	// a period of its own rather than counted twice in one
+	january, february := time.Date(2024, time.January, 31, 0, 0, 0, 0, time.UTC), time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC)
+	service = newToolService(newFakeTags().On("as report_id", dbtest.Result(
+		[]string{"partner_id", "partner_name", "report_id", "report_name", "report_end_date", "revenue", "searches"},
+		[]interface{}{int64(2), "Acme Media LLC", int64(7), "YER 2024-01", january, 100.0, 2000.0},
+		[]interface{}{int64(2), "Acme Media LLC", int64(9), "YER 2024-02 rerun", february, 90.0, 1900.0},
+		[]interface{}{int64(2), "Acme Media LLC", int64(8), "YER 2024-02", february, 80.0, 1800.0},
+	)))
+	result, err = service.CallTool(context.Background(), "cohort_retention", json.RawMessage(`{"granularity": "report"}`))
+	if err != nil {
+		t.Fatalf("Failed to call tool: %v", err)
+	}
+	r = result.(*CohortsResult)
+	if len(r.Cohorts) != 1 || len(r.Cohorts[0].Periods) != 3 {
+		t.Fatalf("Expected one cohort over three reports, got %+v", r.Cohorts)
+	}
+	if p := r.Cohorts[0].Periods; p[1].Period != "2024-02-29" || p[1].Revenue != 80 || p[2].Period != "2024-02-29" || p[2].Revenue != 90 {
+		t.Errorf("Expected reports 8 and 9 apart, in ID order, got %+v", p)
+	}
+}
+
+func TestCallToolErrors(t *testing.T) {
+	service := NewService(newFakeTags())
+
+	testCases := []struct {
+		name    string
+		tool    string
+		args    string
+		unknown bool
+	}{
+		{"Unknown Tool", "drop_tables", `{}`, true},
+		{"Unknown Argument", "search_source_tags", `{"qeury": "bing"}`, false},
+		{"Bad Mode", "search_source_tags", `{"mode": "regex"}`, false},
+		{"Unknown Datasource", "search_source_tags", `{"datasource": "nope"}`, false},
+		{"Not JSON", "search_source_tags", `bing`, false},
+		{"No Metrics", "query_metrics", `{"dimensions": ["partner"]}`, false},
+		{"Unknown Metric", "query_metrics", `{"metrics": ["profit"]}`, false},
+		{"Bad Time Range", "query_metrics", `{"metrics": ["revenue"], "time_range": "whenever"}`, false},
+		{"Bad Filter", "query_metrics", `{"metrics": ["revenue"], "filters": {"month": [1]}}`, false},
+		{"Source Tag By Name", "query_metrics", `{"metrics": ["revenue"], "filters": {"source_tag": ["bing"]}}`, false},
+		{"No Metric To Compare", "compare_metrics", `{"dimensions": ["partner"]}`, false},
+		{"Compare By Month", "compare_metrics", `{"metric": "revenue", "dimensions": ["month"]}`, false},
+		{"Compare All Time", "compare_metrics", `{"metric": "revenue", "current": "all time"}`, false},
+		{"Bad Previous Period", "compare_metrics", `{"metric": "revenue", "previous": "whenever"}`, false},
+		{"No Partner To Summarize", "partner_summary", `{}`, false},
+		{"Too Many Months", "partner_summary", `{"partner": "acme", "months": 100}`, false},
+		{"Bad Anomaly Dimension", "find_anomalies", `{"by": "month"}`, false},
+		{"Bad Granularity", "find_anomalies", `{"granularity": "week"}`, false},
+		{"Unknown Anomaly Metric", "find_anomalies", `{"metrics": ["profit"]}`, false},
+		{"Unknown Forecast Metric", "forecast_metric", `{"metric": "profit"}`, false},
+		{"Horizon Too Far", "forecast_metric", `{"horizon": 24}`, false},
+		{"Bad Forecast Level", "forecast_metric", `{"level": 0.5}`, false},
+		{"Bad Cohort Dimension", "cohort_retention", `{"by": "report"}`, false},
+		{"Too Many Cohorts", "cohort_retention", `{"cohorts": 100}`, false},
+	}
+
+	for _, tc := range testCases {
+		_, err := service.CallTool(context.Background(), tc.tool, json.RawMessage(tc.args))
+		var unknown *UnknownToolError
+		var argErr *ArgumentError
+		switch {
+		case tc.unknown && !errors.As(err, &unknown):
+			t.Errorf("%s: expected an *UnknownToolError, got %v", tc.name, err)
+		case !tc.unknown && !errors.As(err, &argErr):
+			t.Errorf("%s: expected an *ArgumentError, got %v", tc.name, err)
+		}
+	}
+
+	// Every tool describes its arguments
+	for _, tool := range service.Tools() {
+		if tool.Description == "" || tool.InputSchema["type"] != "object" {
+			t.Errorf("Tool %s is missing its description or schema", tool.Name)
+		}
+	}
+}
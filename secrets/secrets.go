@@ -0,0 +1,198 @@
+package secrets
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Provider supplies a secret, such as a database password, from somewhere other
+// than the config file
+type Provider interface {
+	// Name describes where the secret comes from, for error messages. It never
+	// includes the secret itself.
+	Name() string
+	// Secret returns the secret value
+	Secret(ctx context.Context) (string, error)
+}
+
+// Static is a secret given directly in the config
+type Static string
+
+func (s Static) Name() string { return "config" }
+
+func (s Static) Secret(ctx context.Context) (string, error) {
+	return string(s), nil
+}
+
+// Env reads a secret from an environment variable
+type Env struct {
+	Var string
+}
+
+func (e Env) Name() string { return "environment variable " + e.Var }
+
+func (e Env) Secret(ctx context.Context) (string, error) {
+	value, ok := os.LookupEnv(e.Var)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", e.Var)
+	}
+	return value, nil
+}
+
+// File reads a secret from a file, ignoring a trailing newline. This also works
+// with mounted secrets such as Docker or Kubernetes secret files.
+type File struct {
+	Path string
+}
+
+func (f File) Name() string { return "file " + f.Path }
+
+func (f File) Secret(ctx context.Context) (string, error) {
+	data, err := os.ReadFile(expandPath(f.Path))
+	if err != nil {
+		return "", fmt.Errorf("error reading secret file: %v", err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// Command runs a shell command, such as "pass show db/ro-traffic", and uses the
+// first line of its output
+type Command struct {
+	Command string
+}
+
+func (c Command) Name() string { return "command " + c.Command }
+
+func (c Command) Secret(ctx context.Context) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "sh", "-c", c.Command)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("password command failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	line, _, _ := strings.Cut(stdout.String(), "\n")
+	line = strings.TrimRight(line, "\r")
+	if line == "" {
+		return "", fmt.Errorf("password command printed nothing")
+	}
+	return line, nil
+}
+
+// PgPass looks up a password in a PostgreSQL password file the way libpq does.
+// Path defaults to $PGPASSFILE, then ~/.pgpass.
+type PgPass struct {
+	Path     string
+	Host     string
+	Port     int
+	Database string
+	User     string
+}
+
+func (p PgPass) Name() string { return "pgpass file " + p.path() }
+
+func (p PgPass) path() string {
+	if p.Path != "" {
+		return expandPath(p.Path)
+	}
+	if env := os.Getenv("PGPASSFILE"); env != "" {
+		return env
+	}
+	return expandPath("~/.pgpass")
+}
+
+func (p PgPass) Secret(ctx context.Context) (string, error) {
+	path := p.path()
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("error reading pgpass file: %v", err)
+	}
+	// libpq ignores password files others can read, and so do we
+	if info.Mode().Perm()&0077 != 0 {
+		return "", fmt.Errorf("pgpass file %s has group or world access; run chmod 0600 %s", path, path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("error reading pgpass file: %v", err)
+	}
+	defer f.Close()
+
+	want := []string{p.Host, strconv.Itoa(p.Port), p.Database, p.User}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := splitPgPassLine(line)
+		if len(fields) != 5 {
+			continue
+		}
+		if pgPassMatch(fields[:4], want) {
+			return fields[4], nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("error reading pgpass file: %v", err)
+	}
+
+	return "", fmt.Errorf("no entry for %s:%d:%s:%s in %s", p.Host, p.Port, p.Database, p.User, path)
+}
+
+// splitPgPassLine splits a pgpass line on unescaped colons, unescaping \: and \\
+func splitPgPassLine(line string) []string {
+	var fields []string
+	var current strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && i+1 < len(line):
+			i++
+			current.WriteByte(line[i])
+		case line[i] == ':':
+			fields = append(fields, current.String())
+			current.Reset()
+		default:
+			current.WriteByte(line[i])
+		}
+	}
+	return append(fields, current.String())
+}
+
+// pgPassMatch compares host, port, database and user, where * matches anything
+func pgPassMatch(fields, want []string) bool {
+	for i := range fields {
+		if fields[i] != "*" && fields[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// expandPath expands a leading ~ to the user's home directory
+func expandPath(p string) string {
+	if !strings.HasPrefix(p, "~") {
+		return p
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return p
+	}
+	return filepath.Join(homeDir, p[1:])
+}
+
+// Mask hides a secret for display, keeping only whether it was set
+func Mask(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return "********"
+}
@@ -0,0 +1,88 @@
+package secrets
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProviders(t *testing.T) {
+	dir := t.TempDir()
+	secretFile := filepath.Join(dir, "password")
+	if err := os.WriteFile(secretFile, []byte("from file\n"), 0600); err != nil {
+		t.Fatalf("Failed to write secret file: %v", err)
+	}
+	t.Setenv("DNC_TEST_PASSWORD", "from env")
+
+	testCases := []struct {
+		name     string
+		provider Provider
+		want     string
+		wantErr  string
+	}{
+		{"Static", Static("from config"), "from config", ""},
+		{"Env", Env{Var: "DNC_TEST_PASSWORD"}, "from env", ""},
+		{"Env missing", Env{Var: "DNC_TEST_PASSWORD_MISSING"}, "", "is not set"},
+		{"File", File{Path: secretFile}, "from file", ""},
+		{"File missing", File{Path: filepath.Join(dir, "nope")}, "", "error reading secret file"},
+		{"Command", Command{Command: "printf 'from command\\nsecond line\\n'"}, "from command", ""},
+		{"Command failure", Command{Command: "echo oops >&2; exit 3"}, "", "oops"},
+		{"Command silent", Command{Command: "true"}, "", "printed nothing"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := tc.provider.Secret(context.Background())
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Errorf("Expected error containing %q, got: %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("Expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestPgPass(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pgpass")
+	content := `# comment
+other.internal:5432:traffic:reader:wrong
+db.internal:5432:traffic:reader:p\:ss\\word
+*:*:*:admin:wildcard
+`
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write pgpass: %v", err)
+	}
+
+	p := PgPass{Path: path, Host: "db.internal", Port: 5432, Database: "traffic", User: "reader"}
+	if got, err := p.Secret(context.Background()); err != nil || got != `p:ss\word` {
+		t.Errorf("Expected unescaped password, got %q (err: %v)", got, err)
+	}
+
+	p.User = "admin"
+	if got, err := p.Secret(context.Background()); err != nil || got != "wildcard" {
+		t.Errorf("Expected wildcard match, got %q (err: %v)", got, err)
+	}
+
+	p.User = "nobody"
+	if _, err := p.Secret(context.Background()); err == nil {
+		t.Error("Expected an error when no entry matches")
+	}
+
+	// Like libpq, refuse a file others can read
+	if err := os.Chmod(path, 0644); err != nil {
+		t.Fatalf("Failed to chmod pgpass: %v", err)
+	}
+	p.User = "reader"
+	if _, err := p.Secret(context.Background()); err == nil || !strings.Contains(err.Error(), "chmod 0600") {
+		t.Errorf("Expected a permissions error, got: %v", err)
+	}
+}
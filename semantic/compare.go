@@ -0,0 +1,155 @@
+package semantic
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dnc-data-mcp/timerange"
+)
+
+// Comparison directions
+const (
+	// Increase keeps only rows whose metric went up, biggest rise first
+	Increase = "increase"
+	// Decrease keeps only rows whose metric went down, biggest fall first
+	Decrease = "decrease"
+)
+
+// Directions lists the valid comparison directions
+var Directions = []string{Increase, Decrease}
+
+// Comparison orderings
+const (
+	// ByChange orders by the absolute change
+	ByChange = "change"
+	// ByPercentChange orders by the change as a percentage of the previous value
+	ByPercentChange = "percent_change"
+)
+
+// DefaultMinSearches is the least searches a row needs in both periods when
+// comparing a ratio metric and no minimum is given, so a tag with a handful of
+// searches can't top the ranking with a noisy TQ or CTR
+const DefaultMinSearches = 1000
+
+// Comparison asks how a metric changed between two periods, broken down by
+// dimensions
+type Comparison struct {
+	Metric     string
+	Dimensions []string
+	// Filters limit both periods to the given IDs of each dimension
+	Filters  map[string][]int64
+	Current  timerange.Range
+	Previous timerange.Range
+	// MinSearches drops rows with fewer searches than this in either period.
+	// Negative means no minimum; 0 means DefaultMinSearches for ratio
+	// metrics and no minimum otherwise.
+	MinSearches int64
+	// Direction is Increase, Decrease or empty for the biggest moves either way
+	Direction string
+	// OrderBy is ByChange (the default) or ByPercentChange
+	OrderBy string
+	// Limit caps the rows; DefaultLimit if 0
+	Limit int
+}
+
+// CompileComparison turns a comparison into SQL and its arguments. Only rows
+// present in both periods are compared. The columns are the dimensions',
+// then current_<metric>, previous_<metric>, change, percent_change,
+// current_searches and previous_searches.
+func CompileComparison(c Comparison) (string, []interface{}, error) {
+	m, ok := MetricByName(c.Metric)
+	if !ok {
+		return "", nil, fmt.Errorf("unknown metric %q; use one of %s", c.Metric, strings.Join(MetricNames(), ", "))
+	}
+	limit, err := checkLimit(c.Limit)
+	if err != nil {
+		return "", nil, err
+	}
+	dims, err := dimensions(c.Dimensions)
+	if err != nil {
+		return "", nil, err
+	}
+	// Rows are matched across periods by their dimensions, and the periods
+	// never share a month
+	if contains(c.Dimensions, "month") {
+		return "", nil, fmt.Errorf("can't compare by month; each period is compared as a whole")
+	}
+	if c.Direction != "" && !contains(Directions, c.Direction) {
+		return "", nil, fmt.Errorf("direction must be one of %s", strings.Join(Directions, ", "))
+	}
+	change := "curr.value - prev.value"
+	percentChange := "round((curr.value - prev.value)::numeric * 100 / nullif(abs(prev.value), 0), 2)"
+	// ORDER BY can't use output names inside expressions, so it gets these
+	order := change
+	switch c.OrderBy {
+	case "", ByChange:
+	case ByPercentChange:
+		order = percentChange
+	default:
+		return "", nil, fmt.Errorf("can't order a comparison by %q; use %s or %s", c.OrderBy, ByChange, ByPercentChange)
+	}
+	minSearches := c.MinSearches
+	if minSearches == 0 && m.Ratio {
+		minSearches = DefaultMinSearches
+	}
+
+	var p params
+	columns := []string{m.Expr + " as value", "sum(yi.total_searches) as searches"}
+	current := []string{rangeClause(p.add(c.Current.Start), p.add(c.Current.End))}
+	previous := []string{rangeClause(p.add(c.Previous.Start), p.add(c.Previous.End))}
+	// Both periods share the filters' parameters
+	filters, err := filterClauses(c.Filters, &p)
+	if err != nil {
+		return "", nil, err
+	}
+	current = append(current, filters...)
+	previous = append(previous, filters...)
+
+	var selects, on []string
+	for _, d := range dims {
+		// The first column of a dimension identifies it
+		on = append(on, "curr."+d.Columns[0].Name+" = prev."+d.Columns[0].Name)
+		for _, col := range d.Columns {
+			selects = append(selects, "curr."+col.Name)
+		}
+	}
+	if len(on) == 0 {
+		on = []string{"true"}
+	}
+	selects = append(selects,
+		"curr.value as current_"+m.Name,
+		"prev.value as previous_"+m.Name,
+		change+" as change",
+		percentChange+" as percent_change",
+		"curr.searches as current_searches",
+		"prev.searches as previous_searches",
+	)
+
+	var where []string
+	if minSearches > 0 {
+		least := p.add(minSearches)
+		where = append(where, "curr.searches >= "+least+" AND prev.searches >= "+least)
+	}
+	orderBy := "abs(" + order + ") DESC NULLS LAST"
+	switch c.Direction {
+	case Increase:
+		where = append(where, "curr.value > prev.value")
+		orderBy = order + " DESC NULLS LAST"
+	case Decrease:
+		where = append(where, "curr.value < prev.value")
+		orderBy = order + " ASC NULLS LAST"
+	}
+
+	var sql strings.Builder
+	sql.WriteString("WITH current_data AS (\n" + aggregate(dims, columns, current) + "),\n")
+	sql.WriteString("previous_data AS (\n" + aggregate(dims, columns, previous) + ")\n")
+	sql.WriteString("SELECT\n\t" + strings.Join(selects, ",\n\t") + "\n")
+	sql.WriteString("FROM current_data curr\n")
+	sql.WriteString("JOIN previous_data prev ON " + strings.Join(on, " AND ") + "\n")
+	if len(where) > 0 {
+		sql.WriteString("WHERE " + strings.Join(where, "\nAND ") + "\n")
+	}
+	sql.WriteString("ORDER BY " + orderBy + "\n")
+	sql.WriteString("LIMIT " + p.add(limit))
+	return sql.String(), p, nil
+}
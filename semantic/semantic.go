@@ -0,0 +1,361 @@
+// Package semantic defines the reporting metrics and dimensions once, with
+// their aggregation rules, and compiles requests for them into SQL over
+// yer_analysis.v_yer_items. Ratios are computed from sums rather than
+// averaged, so TQ is weighted by searches and CTR is total clicks over total
+// searches at whatever level the results are grouped.
+package semantic
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dnc-data-mcp/timerange"
+)
+
+// Metric is an aggregate over YER items
+type Metric struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Expr is the SQL aggregate, over v_yer_items aliased yi
+	Expr string `json:"-"`
+	// Ratio is true for metrics that divide one total by another, which swing
+	// wildly when the totals are small
+	Ratio bool `json:"ratio,omitempty"`
+}
+
+// Dimension is something metrics can be broken down by
+type Dimension struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Columns are the SQL expressions selected, with their column names
+	Columns []Column `json:"-"`
+	// Join is the join the columns need, if any
+	Join string `json:"-"`
+}
+
+// Column is a selected SQL expression and its name
+type Column struct {
+	Expr string
+	Name string
+}
+
+// Metrics lists every metric, in the order they're documented
+var Metrics = []Metric{
+	{Name: "revenue", Description: "Total revenue (sum of amount)", Expr: "sum(yi.amount)"},
+	{Name: "searches", Description: "Total searches", Expr: "sum(yi.total_searches)"},
+	{Name: "clicks", Description: "Total clicks", Expr: "sum(yi.total_clicks)"},
+	{
+		Name:        "tq",
+		Description: "Traffic quality, averaged weighting each item by its searches",
+		Expr:        "round(sum(yi.traffic_quality * yi.total_searches) / nullif(sum(yi.total_searches), 0), 2)",
+		Ratio:       true,
+	},
+	{
+		Name:        "ctr",
+		Description: "Click-through rate: clicks / searches",
+		Expr:        "round(sum(yi.total_clicks)::numeric / nullif(sum(yi.total_searches), 0), 4)",
+		Ratio:       true,
+	},
+	{
+		Name:        "rpm",
+		Description: "Revenue per thousand searches",
+		Expr:        "round(sum(yi.amount) * 1000 / nullif(sum(yi.total_searches), 0), 2)",
+		Ratio:       true,
+	},
+	{
+		Name:        "rpc",
+		Description: "Revenue per click",
+		Expr:        "round(sum(yi.amount) / nullif(sum(yi.total_clicks), 0), 4)",
+		Ratio:       true,
+	},
+}
+
+// Dimensions lists every dimension
+var Dimensions = []Dimension{
+	{
+		Name:        "partner",
+		Description: "The partner",
+		Columns:     []Column{{"p.id", "partner_id"}, {"p.name", "partner_name"}},
+		Join:        "JOIN partners.partners p ON yi.partner_id = p.id",
+	},
+	{
+		Name:        "source_tag",
+		Description: "The source tag (traffic source)",
+		Columns:     []Column{{"st.id", "sourcetag_id"}, {"st.name", "sourcetag_name"}},
+		Join:        "JOIN yer_analysis.source_tags st ON yi.sourcetag_id = st.id",
+	},
+	{
+		Name:        "month",
+		Description: "The calendar month the report covers",
+		Columns:     []Column{{"date_trunc('month', yi.start_date)::date", "month"}},
+	},
+	{
+		Name:        "report",
+		Description: "The yield enhancement report",
+		Columns:     []Column{{"r.id", "report_id"}, {"r.name", "report_name"}, {"r.end_date", "report_end_date"}},
+	},
+}
+
+// Filterable dimensions and the ID column they filter on
+var filterColumns = map[string]string{
+	"partner":    "yi.partner_id",
+	"source_tag": "yi.sourcetag_id",
+	"report":     "yi.yer_report_id",
+}
+
+// FilterDimensions lists the dimensions that can be filtered by ID
+var FilterDimensions = []string{"partner", "source_tag", "report"}
+
+const (
+	// DefaultLimit is how many rows a query returns unless told otherwise
+	DefaultLimit = 100
+	// MaxLimit caps the rows a query may ask for
+	MaxLimit = 1000
+)
+
+// Query asks for metrics broken down by dimensions
+type Query struct {
+	Metrics    []string
+	Dimensions []string
+	// Filters limit results to the given IDs of each dimension, e.g.
+	// {"partner": {2, 5}}
+	Filters map[string][]int64
+	// TimeRange limits results to reports ending in it; nil means all time
+	TimeRange *timerange.Range
+	// OrderBy is a metric or dimension name. By default results are ordered
+	// by month if that's a dimension, otherwise by the first metric.
+	OrderBy string
+	// Ascending sets the order's direction. Metrics default to largest
+	// first and dimensions to ascending, so nil leaves each to its default.
+	Ascending *bool
+	// Limit caps the rows; DefaultLimit if 0
+	Limit int
+	// Unlimited drops the limit, for callers that need every row to analyse
+	// rather than to show
+	Unlimited bool
+}
+
+// MetricByName returns the named metric
+func MetricByName(name string) (Metric, bool) {
+	for _, m := range Metrics {
+		if m.Name == name {
+			return m, true
+		}
+	}
+	return Metric{}, false
+}
+
+// DimensionByName returns the named dimension
+func DimensionByName(name string) (Dimension, bool) {
+	for _, d := range Dimensions {
+		if d.Name == name {
+			return d, true
+		}
+	}
+	return Dimension{}, false
+}
+
+// MetricNames returns the names of every metric
+func MetricNames() []string {
+	names := make([]string, len(Metrics))
+	for i, m := range Metrics {
+		names[i] = m.Name
+	}
+	return names
+}
+
+// DimensionNames returns the names of every dimension
+func DimensionNames() []string {
+	names := make([]string, len(Dimensions))
+	for i, d := range Dimensions {
+		names[i] = d.Name
+	}
+	return names
+}
+
+// Compile turns a query into SQL and its arguments, or explains what's wrong
+// with it. Only names from Metrics and Dimensions reach the SQL; every value
+// is a parameter.
+func Compile(q Query) (string, []interface{}, error) {
+	if len(q.Metrics) == 0 {
+		return "", nil, fmt.Errorf("no metrics given; use one or more of %s", strings.Join(MetricNames(), ", "))
+	}
+	limit, err := checkLimit(q.Limit)
+	if err != nil && !q.Unlimited {
+		return "", nil, err
+	}
+	dims, err := dimensions(q.Dimensions)
+	if err != nil {
+		return "", nil, err
+	}
+	var columns []string
+	seen := make(map[string]bool)
+	for _, name := range q.Metrics {
+		m, ok := MetricByName(name)
+		if !ok {
+			return "", nil, fmt.Errorf("unknown metric %q; use one of %s", name, strings.Join(MetricNames(), ", "))
+		}
+		if !seen[name] {
+			seen[name] = true
+			columns = append(columns, m.Expr+" as "+m.Name)
+		}
+	}
+	order, err := orderBy(q)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var p params
+	var where []string
+	if q.TimeRange != nil {
+		where = append(where, rangeClause(p.add(q.TimeRange.Start), p.add(q.TimeRange.End)))
+	}
+	filters, err := filterClauses(q.Filters, &p)
+	if err != nil {
+		return "", nil, err
+	}
+	where = append(where, filters...)
+
+	sql := aggregate(dims, columns, where) + "ORDER BY " + order
+	if !q.Unlimited {
+		sql += "\nLIMIT " + p.add(limit)
+	}
+	return sql, p, nil
+}
+
+// params collects a query's arguments, numbering them $1, $2, ...
+type params []interface{}
+
+// add appends an argument and returns its placeholder
+func (p *params) add(v interface{}) string {
+	*p = append(*p, v)
+	return fmt.Sprintf("$%d", len(*p))
+}
+
+// checkLimit returns the row limit to use, DefaultLimit for 0
+func checkLimit(limit int) (int, error) {
+	switch {
+	case limit == 0:
+		return DefaultLimit, nil
+	case limit < 0 || limit > MaxLimit:
+		return 0, fmt.Errorf("limit %d is out of range; use 1 to %d", limit, MaxLimit)
+	}
+	return limit, nil
+}
+
+// dimensions looks up dimensions by name, dropping repeats
+func dimensions(names []string) ([]Dimension, error) {
+	var dims []Dimension
+	seen := make(map[string]bool)
+	for _, name := range names {
+		d, ok := DimensionByName(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown dimension %q; use one of %s", name, strings.Join(DimensionNames(), ", "))
+		}
+		if !seen[name] {
+			seen[name] = true
+			dims = append(dims, d)
+		}
+	}
+	return dims, nil
+}
+
+// rangeClause limits items to reports ending between the start and end
+// placeholders, end being exclusive
+func rangeClause(start, end string) string {
+	return "r.end_date >= " + start + "::date AND r.end_date < " + end + "::date"
+}
+
+// filterClauses returns a WHERE condition for each filtered dimension, adding
+// the IDs to p
+func filterClauses(filters map[string][]int64, p *params) ([]string, error) {
+	for name := range filters {
+		if _, ok := filterColumns[name]; !ok {
+			return nil, fmt.Errorf("can't filter by %q; use one of %s", name, strings.Join(FilterDimensions, ", "))
+		}
+	}
+	var where []string
+	// In a fixed order so the same query always gets the same SQL
+	for _, name := range FilterDimensions {
+		if ids, ok := filters[name]; ok {
+			where = append(where, filterColumns[name]+" = ANY("+p.add(ids)+")")
+		}
+	}
+	return where, nil
+}
+
+// aggregate builds a SELECT of the dimensions' columns and the given
+// aggregate columns over YER items, grouped by the dimensions
+func aggregate(dims []Dimension, columns, where []string) string {
+	var selects, groupBy []string
+	var sql strings.Builder
+	for _, d := range dims {
+		for _, c := range d.Columns {
+			selects = append(selects, c.Expr+" as "+c.Name)
+			groupBy = append(groupBy, c.Expr)
+		}
+	}
+	selects = append(selects, columns...)
+
+	sql.WriteString("SELECT\n\t" + strings.Join(selects, ",\n\t") + "\n")
+	sql.WriteString("FROM yer_analysis.v_yer_items yi\n")
+	sql.WriteString("JOIN yer_analysis.yer_reports r ON yi.yer_report_id = r.id\n")
+	for _, d := range dims {
+		if d.Join != "" {
+			sql.WriteString(d.Join + "\n")
+		}
+	}
+	if len(where) > 0 {
+		sql.WriteString("WHERE " + strings.Join(where, "\nAND ") + "\n")
+	}
+	if len(groupBy) > 0 {
+		sql.WriteString("GROUP BY " + strings.Join(groupBy, ", ") + "\n")
+	}
+	return sql.String()
+}
+
+// orderBy returns the ORDER BY clause for a query
+func orderBy(q Query) (string, error) {
+	name := q.OrderBy
+	if name == "" {
+		name = q.Metrics[0]
+		for _, d := range q.Dimensions {
+			if d == "month" {
+				return "month", nil
+			}
+		}
+	}
+
+	ascending := q.Ascending != nil && *q.Ascending
+	if _, ok := MetricByName(name); ok {
+		if !contains(q.Metrics, name) {
+			return "", fmt.Errorf("can't order by %q as it isn't one of the metrics asked for", name)
+		}
+		direction := " DESC NULLS LAST"
+		if ascending {
+			direction = " ASC NULLS LAST"
+		}
+		return name + direction, nil
+	}
+	if d, ok := DimensionByName(name); ok {
+		if !contains(q.Dimensions, name) {
+			return "", fmt.Errorf("can't order by %q as it isn't one of the dimensions asked for", name)
+		}
+		// Dimensions read naturally in ascending order unless asked otherwise
+		direction := " ASC"
+		if q.Ascending != nil && !*q.Ascending {
+			direction = " DESC"
+		}
+		return d.Columns[len(d.Columns)-1].Name + direction, nil
+	}
+	return "", fmt.Errorf("can't order by unknown %q", name)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,215 @@
+package semantic
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dnc-data-mcp/timerange"
+)
+
+func TestCompile(t *testing.T) {
+	march := &timerange.Range{
+		Start: time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC),
+		End:   time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC),
+	}
+	yes, no := true, false
+
+	testCases := []struct {
+		name     string
+		query    Query
+		contains []string
+		excludes []string
+		args     int
+		err      string
+	}{
+		{
+			name:     "Total Revenue",
+			query:    Query{Metrics: []string{"revenue"}},
+			contains: []string{"sum(yi.amount) as revenue", "ORDER BY revenue DESC NULLS LAST", "LIMIT $1"},
+			excludes: []string{"GROUP BY", "WHERE", "partners.partners"},
+			args:     1,
+		},
+		{
+			name:  "Weighted TQ By Partner",
+			query: Query{Metrics: []string{"tq", "ctr"}, Dimensions: []string{"partner"}, TimeRange: march},
+			contains: []string{
+				"sum(yi.traffic_quality * yi.total_searches) / nullif(sum(yi.total_searches), 0)",
+				"sum(yi.total_clicks)::numeric / nullif(sum(yi.total_searches), 0)",
+				"JOIN partners.partners p",
+				"r.end_date >= $1::date AND r.end_date < $2::date",
+				"GROUP BY p.id, p.name",
+				"ORDER BY tq DESC",
+			},
+			excludes: []string{"avg("},
+			args:     3,
+		},
+		{
+			name: "Filtered By Month",
+			query: Query{
+				Metrics:    []string{"rpm"},
+				Dimensions: []string{"month", "source_tag"},
+				Filters:    map[string][]int64{"partner": {2}, "source_tag": {10, 11}},
+			},
+			contains: []string{
+				"yi.partner_id = ANY($1)",
+				"yi.sourcetag_id = ANY($2)",
+				"JOIN yer_analysis.source_tags st",
+				"ORDER BY month\n",
+			},
+			excludes: []string{"partners.partners"},
+			args:     3,
+		},
+		{
+			name:     "Order By Dimension",
+			query:    Query{Metrics: []string{"clicks"}, Dimensions: []string{"partner"}, OrderBy: "partner"},
+			contains: []string{"ORDER BY partner_name ASC"},
+			args:     1,
+		},
+		{
+			name:     "Order By Dimension Descending",
+			query:    Query{Metrics: []string{"clicks"}, Dimensions: []string{"partner"}, OrderBy: "partner", Ascending: &no},
+			contains: []string{"ORDER BY partner_name DESC"},
+			args:     1,
+		},
+		{
+			name:     "Order By Metric Ascending",
+			query:    Query{Metrics: []string{"clicks"}, Dimensions: []string{"partner"}, Ascending: &yes},
+			contains: []string{"ORDER BY clicks ASC NULLS LAST"},
+			args:     1,
+		},
+		{
+			name:  "Duplicate Names",
+			query: Query{Metrics: []string{"clicks", "clicks"}, Dimensions: []string{"report", "report"}},
+			args:  1,
+		},
+		{
+			name:     "Unlimited",
+			query:    Query{Metrics: []string{"searches"}, Dimensions: []string{"report"}, Unlimited: true},
+			contains: []string{"r.end_date as report_end_date", "ORDER BY searches DESC NULLS LAST"},
+			excludes: []string{"LIMIT"},
+			args:     0,
+		},
+		{name: "No Metrics", query: Query{}, err: "no metrics"},
+		{name: "Unknown Metric", query: Query{Metrics: []string{"profit"}}, err: `unknown metric "profit"`},
+		{name: "Unknown Dimension", query: Query{Metrics: []string{"revenue"}, Dimensions: []string{"country"}}, err: "unknown dimension"},
+		{name: "Unknown Filter", query: Query{Metrics: []string{"revenue"}, Filters: map[string][]int64{"month": {1}}}, err: "can't filter"},
+		{name: "Order By Missing Metric", query: Query{Metrics: []string{"revenue"}, OrderBy: "clicks"}, err: "isn't one of the metrics"},
+		{name: "Limit Too Big", query: Query{Metrics: []string{"revenue"}, Limit: MaxLimit + 1}, err: "out of range"},
+	}
+
+	for _, tc := range testCases {
+		sql, args, err := Compile(tc.query)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%s: expected an error containing %q, got %v", tc.name, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: failed to compile: %v", tc.name, err)
+			continue
+		}
+		for _, want := range tc.contains {
+			if !strings.Contains(sql, want) {
+				t.Errorf("%s: expected the SQL to contain %q", tc.name, want)
+			}
+		}
+		for _, unwanted := range tc.excludes {
+			if strings.Contains(sql, unwanted) {
+				t.Errorf("%s: expected the SQL not to contain %q", tc.name, unwanted)
+			}
+		}
+		if len(args) != tc.args {
+			t.Errorf("%s: expected %d arguments, got %+v", tc.name, tc.args, args)
+		}
+		if strings.Count(sql, " as clicks") > 1 || strings.Count(sql, " as report_id") > 1 {
+			t.Errorf("%s: expected repeated names to be selected once", tc.name)
+		}
+	}
+}
+
+func TestCompileComparison(t *testing.T) {
+	feb := timerange.Range{
+		Start: time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC),
+		End:   time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC),
+	}
+	jan := feb.Previous()
+
+	testCases := []struct {
+		name       string
+		comparison Comparison
+		contains   []string
+		excludes   []string
+		args       int
+		err        string
+	}{
+		{
+			name:       "TQ Increase By Source Tag",
+			comparison: Comparison{Metric: "tq", Dimensions: []string{"source_tag"}, Direction: Increase},
+			contains: []string{
+				"WITH current_data AS",
+				"JOIN previous_data prev ON curr.sourcetag_id = prev.sourcetag_id",
+				"curr.value as current_tq",
+				"curr.searches >= $5 AND prev.searches >= $5",
+				"curr.value > prev.value",
+				"ORDER BY curr.value - prev.value DESC",
+			},
+			// Two periods, the default minimum searches and the limit
+			args: 6,
+		},
+		{
+			name: "Revenue Fall By Partner Percent",
+			comparison: Comparison{
+				Metric:     "revenue",
+				Dimensions: []string{"partner"},
+				Filters:    map[string][]int64{"source_tag": {10}},
+				Direction:  Decrease,
+				OrderBy:    ByPercentChange,
+			},
+			contains: []string{"yi.sourcetag_id = ANY($5)", "curr.value < prev.value", "nullif(abs(prev.value), 0), 2) ASC"},
+			// Revenue isn't a ratio, so there's no default minimum
+			excludes: []string{"searches >="},
+			args:     6,
+		},
+		{
+			name:       "Totals Either Way",
+			comparison: Comparison{Metric: "ctr", MinSearches: -1},
+			contains:   []string{"ON true", "ORDER BY abs(curr.value - prev.value) DESC"},
+			excludes:   []string{"GROUP BY", "searches >="},
+			args:       5,
+		},
+		{name: "Unknown Metric", comparison: Comparison{Metric: "profit"}, err: "unknown metric"},
+		{name: "By Month", comparison: Comparison{Metric: "revenue", Dimensions: []string{"month"}}, err: "can't compare by month"},
+		{name: "Bad Direction", comparison: Comparison{Metric: "revenue", Direction: "sideways"}, err: "direction"},
+		{name: "Bad Order", comparison: Comparison{Metric: "revenue", OrderBy: "revenue"}, err: "can't order"},
+	}
+
+	for _, tc := range testCases {
+		tc.comparison.Current, tc.comparison.Previous = feb, jan
+		sql, args, err := CompileComparison(tc.comparison)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%s: expected an error containing %q, got %v", tc.name, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: failed to compile: %v", tc.name, err)
+			continue
+		}
+		for _, want := range tc.contains {
+			if !strings.Contains(sql, want) {
+				t.Errorf("%s: expected the SQL to contain %q", tc.name, want)
+			}
+		}
+		for _, unwanted := range tc.excludes {
+			if strings.Contains(sql, unwanted) {
+				t.Errorf("%s: expected the SQL not to contain %q", tc.name, unwanted)
+			}
+		}
+		if len(args) != tc.args {
+			t.Errorf("%s: expected %d arguments, got %+v", tc.name, tc.args, args)
+		}
+	}
+}
@@ -0,0 +1,397 @@
+// Package timerange turns time expressions in questions, such as "last month",
+// "Q3", "past 90 days" or "since June 1", into concrete date ranges. Ranges
+// are worked out in the location of the reference time, so passing the
+// current time in the business timezone makes "yesterday" mean yesterday
+// there rather than in UTC.
+package timerange
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Range is a period of whole days from Start up to but not including End,
+// both at midnight in the business timezone
+type Range struct {
+	Start time.Time
+	End   time.Time
+	// Label describes the range as asked, e.g. "last month"
+	Label string
+	// Compare is the period to compare against when the expression asked for
+	// one, e.g. the week before for "week over week"; nil otherwise
+	Compare *Range
+}
+
+// Days returns how many days the range covers
+func (r Range) Days() int {
+	return int(r.End.Sub(r.Start).Hours()/24 + 0.5)
+}
+
+// Previous returns the period of the same length just before r. Whole months
+// step back by months, so the month before March is all of February.
+func (r Range) Previous() Range {
+	if r.Start.Day() == 1 && r.End.Day() == 1 {
+		months := (r.End.Year()-r.Start.Year())*12 + int(r.End.Month()-r.Start.Month())
+		return Range{Start: r.Start.AddDate(0, -months, 0), End: r.Start, Label: "before " + r.Label}
+	}
+	return Range{Start: r.Start.AddDate(0, 0, -r.Days()), End: r.Start, Label: "before " + r.Label}
+}
+
+// YearEarlier returns the same period a year before r, for year over year
+// comparisons
+func (r Range) YearEarlier() Range {
+	return Range{Start: r.Start.AddDate(-1, 0, 0), End: r.End.AddDate(-1, 0, 0), Label: r.Label + " a year earlier"}
+}
+
+// Baseline returns the period r should be compared against: Compare if the
+// expression named one, otherwise the previous period
+func (r Range) Baseline() Range {
+	if r.Compare != nil {
+		return *r.Compare
+	}
+	return r.Previous()
+}
+
+// Dates returns Start and End as YYYY-MM-DD, End being exclusive
+func (r Range) Dates() (string, string) {
+	return r.Start.Format("2006-01-02"), r.End.Format("2006-01-02")
+}
+
+// Period lengths as years, months and days
+var units = map[string][3]int{
+	"day":     {0, 0, 1},
+	"week":    {0, 0, 7},
+	"month":   {0, 1, 0},
+	"quarter": {0, 3, 0},
+	"year":    {1, 0, 0},
+}
+
+// Abbreviations for periods, e.g. "ytd" and "wow"
+var unitLetters = map[string]string{"d": "day", "w": "week", "m": "month", "q": "quarter", "y": "year"}
+
+var months = map[string]time.Month{
+	"jan": time.January, "feb": time.February, "mar": time.March, "apr": time.April,
+	"may": time.May, "jun": time.June, "jul": time.July, "aug": time.August,
+	"sep": time.September, "oct": time.October, "nov": time.November, "dec": time.December,
+}
+
+var numbers = map[string]int{
+	"one": 1, "two": 2, "three": 3, "four": 4, "five": 5, "six": 6,
+	"seven": 7, "eight": 8, "nine": 9, "ten": 10, "eleven": 11, "twelve": 12,
+	"thirty": 30, "sixty": 60, "ninety": 90,
+}
+
+const (
+	monthName = `(?:jan(?:uary)?|feb(?:ruary)?|mar(?:ch)?|apr(?:il)?|may|june?|july?|aug(?:ust)?|sept?(?:ember)?|oct(?:ober)?|nov(?:ember)?|dec(?:ember)?)`
+	number    = `(?:\d+|one|two|three|four|five|six|seven|eight|nine|ten|eleven|twelve|thirty|sixty|ninety)`
+	unit      = `(day|week|month|quarter|year)s?`
+	ordinal   = `(?:st|nd|rd|th)?`
+	date      = `(\d{4}-\d{1,2}-\d{1,2}|\d{1,2}/\d{1,2}/\d{4}|` + monthName + `\.?\s+\d{1,2}` + ordinal + `(?:,?\s+\d{4})?|\d{1,2}` + ordinal + `\s+(?:of\s+)?` + monthName + `(?:,?\s+\d{4})?)`
+)
+
+var (
+	betweenPattern  = regexp.MustCompile(`(?i)\b(?:from|between)\s+` + date + `\s+(?:to|and|until|till|through|thru|-)\s+` + date + `\b`)
+	sincePattern    = regexp.MustCompile(`(?i)\b(?:since|from|after)\s+` + date + `\b`)
+	onPattern       = regexp.MustCompile(`(?i)\bon\s+` + date + `\b`)
+	overPattern     = regexp.MustCompile(`(?i)\b(day|week|month|quarter|year)[\s-]+over[\s-]+(day|week|month|quarter|year)\b|\b(dod|wow|mom|qoq|yoy)\b`)
+	toDatePattern   = regexp.MustCompile(`(?i)\b(week|month|quarter|year)[\s-]+to[\s-]+date\b|\b(wtd|mtd|qtd|ytd)\b`)
+	lastNPattern    = regexp.MustCompile(`(?i)\b(?:last|past|previous|trailing)\s+(` + number + `)\s+` + unit + `\b`)
+	lastPattern     = regexp.MustCompile(`(?i)\b(?:last|previous|past|prior)\s+(week|month|quarter|year)\b`)
+	thisPattern     = regexp.MustCompile(`(?i)\b(?:this|current)\s+(week|month|quarter|year)\b`)
+	quarterPattern  = regexp.MustCompile(`(?i)\bq([1-4])(?:[\s-]*(?:of\s+)?(\d{4})|\s*'(\d{2}))?\b|\b(\d{4})[\s-]*q([1-4])\b`)
+	monthPattern    = regexp.MustCompile(`(?i)\b(` + monthName + `)\.?(?:\s+(?:of\s+)?(\d{4})|\s*'(\d{2}))?\b`)
+	sinceMonth      = regexp.MustCompile(`(?i)\b(?:since|from)\s+(?:the\s+start\s+of\s+)?(` + monthName + `)(?:\s+(\d{4}))?\b`)
+	monthYearNeeded = regexp.MustCompile(`(?i)\b(?:in|during|for|of|throughout|over)\s+(?:the\s+month\s+of\s+)?(` + monthName + `)\b`)
+	yearPattern     = regexp.MustCompile(`(?i)\b(?:in|during|for|throughout|over)\s+(?:the\s+year\s+)?(\d{4})\b`)
+	dayPattern      = regexp.MustCompile(`(?i)\b(today|yesterday)\b`)
+)
+
+// Parse finds the first time expression in text and resolves it relative to
+// now. It returns nil if the text has none.
+//
+// Understood expressions include: today, yesterday; this/last
+// week/month/quarter/year; the last/past N days/weeks/months/quarters/years;
+// week/month/quarter/year to date and wtd/mtd/qtd/ytd; week over week and
+// wow/mom/qoq/yoy (the last complete period, compared with the one before);
+// Q1-Q4 with an optional year; month names with an optional year; "in 2025";
+// since/from a date; between two dates; and on a date. Dates may be written
+// 2026-06-01, 6/1/2026, June 1, June 1st 2026 or 1 June.
+//
+// A month, quarter or date without a year means the most recent one, so in
+// March "September" is last September.
+func Parse(text string, now time.Time) *Range {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	tomorrow := today.AddDate(0, 0, 1)
+
+	if m := betweenPattern.FindStringSubmatch(text); m != nil {
+		start, okStart := parseDate(m[1], today)
+		end, okEnd := parseDate(m[2], today)
+		if okStart && okEnd && !end.Before(start) {
+			return &Range{Start: start, End: end.AddDate(0, 0, 1), Label: label(m[0])}
+		}
+		// Something that looks like dates but isn't, such as February 30,
+		// shouldn't fall back to a looser reading
+		return nil
+	}
+
+	if m := sincePattern.FindStringSubmatch(text); m != nil {
+		if start, ok := parseDate(m[1], today); ok && start.Before(tomorrow) {
+			return &Range{Start: start, End: tomorrow, Label: label(m[0])}
+		}
+		return nil
+	}
+
+	// "since June" is from the start of June
+	if m := sinceMonth.FindStringSubmatch(text); m != nil {
+		month := months[strings.ToLower(m[1][:3])]
+		start := time.Date(today.Year(), month, 1, 0, 0, 0, 0, today.Location())
+		if m[2] != "" {
+			start = time.Date(parseYear(m[2]), month, 1, 0, 0, 0, 0, today.Location())
+		} else if start.After(today) {
+			start = start.AddDate(-1, 0, 0)
+		}
+		return &Range{Start: start, End: tomorrow, Label: label(m[0])}
+	}
+
+	if m := onPattern.FindStringSubmatch(text); m != nil {
+		if day, ok := parseDate(m[1], today); ok {
+			return &Range{Start: day, End: day.AddDate(0, 0, 1), Label: label(m[0])}
+		}
+		return nil
+	}
+
+	if m := overPattern.FindStringSubmatch(text); m != nil {
+		period := strings.ToLower(m[1])
+		if period == "" {
+			period = unitLetters[strings.ToLower(m[3][:1])]
+		}
+		current := periodStart(today, period)
+		r := lastPeriod(current, period, label(m[0]))
+		previous := lastPeriod(r.Start, period, "the "+period+" before")
+		r.Compare = &previous
+		return &r
+	}
+
+	if m := toDatePattern.FindStringSubmatch(text); m != nil {
+		period := strings.ToLower(m[1])
+		if period == "" {
+			period = unitLetters[strings.ToLower(m[2][:1])]
+		}
+		return &Range{Start: periodStart(today, period), End: tomorrow, Label: label(m[0])}
+	}
+
+	if m := lastNPattern.FindStringSubmatch(text); m != nil {
+		n, ok := parseNumber(m[1])
+		if ok && n > 0 {
+			u := units[strings.ToLower(m[2])]
+			start := tomorrow.AddDate(-n*u[0], -n*u[1], -n*u[2])
+			return &Range{Start: start, End: tomorrow, Label: label(m[0])}
+		}
+	}
+
+	if m := lastPattern.FindStringSubmatch(text); m != nil {
+		period := strings.ToLower(m[1])
+		r := lastPeriod(periodStart(today, period), period, label(m[0]))
+		return &r
+	}
+
+	if m := thisPattern.FindStringSubmatch(text); m != nil {
+		return &Range{Start: periodStart(today, strings.ToLower(m[1])), End: tomorrow, Label: label(m[0])}
+	}
+
+	if m := quarterPattern.FindStringSubmatch(text); m != nil {
+		q, yearText := m[1], m[2]+m[3]
+		if q == "" {
+			q, yearText = m[5], m[4]
+		}
+		n, _ := strconv.Atoi(q)
+		start := time.Date(today.Year(), time.Month((n-1)*3+1), 1, 0, 0, 0, 0, today.Location())
+		if yearText != "" {
+			start = time.Date(parseYear(yearText), start.Month(), 1, 0, 0, 0, 0, today.Location())
+		} else if start.After(today) {
+			start = start.AddDate(-1, 0, 0)
+		}
+		return &Range{Start: start, End: start.AddDate(0, 3, 0), Label: label(m[0])}
+	}
+
+	if r := parseMonth(text, today); r != nil {
+		return r
+	}
+
+	if m := yearPattern.FindStringSubmatch(text); m != nil {
+		year, _ := strconv.Atoi(m[1])
+		start := time.Date(year, time.January, 1, 0, 0, 0, 0, today.Location())
+		return &Range{Start: start, End: start.AddDate(1, 0, 0), Label: label(m[0])}
+	}
+
+	if m := dayPattern.FindStringSubmatch(text); m != nil {
+		if strings.ToLower(m[1]) == "yesterday" {
+			return &Range{Start: today.AddDate(0, 0, -1), End: today, Label: "yesterday"}
+		}
+		return &Range{Start: today, End: tomorrow, Label: "today"}
+	}
+
+	return nil
+}
+
+// parseMonth resolves a month name, with or without a year. "May" and "March"
+// are also ordinary words, so a month name alone only counts after a word
+// such as "in" or before a year.
+func parseMonth(text string, today time.Time) *Range {
+	for _, m := range monthPattern.FindAllStringSubmatchIndex(text, -1) {
+		name := strings.ToLower(text[m[2]:m[3]])
+		var year string
+		switch {
+		case m[4] >= 0:
+			year = text[m[4]:m[5]]
+		case m[6] >= 0:
+			year = text[m[6]:m[7]]
+		}
+		hasYear := year != ""
+		if !hasYear && !monthIsIntended(text, m[0]) {
+			continue
+		}
+
+		month := months[name[:3]]
+		start := time.Date(today.Year(), month, 1, 0, 0, 0, 0, today.Location())
+		if hasYear {
+			start = time.Date(parseYear(year), month, 1, 0, 0, 0, 0, today.Location())
+		} else if start.After(today) {
+			start = start.AddDate(-1, 0, 0)
+		}
+		return &Range{Start: start, End: start.AddDate(0, 1, 0), Label: label(text[m[0]:m[1]])}
+	}
+	return nil
+}
+
+// monthIsIntended reports whether the month name at offset follows a word
+// that introduces a period, or is a full month name other than "may" or
+// "march"
+func monthIsIntended(text string, offset int) bool {
+	for _, m := range monthYearNeeded.FindAllStringSubmatchIndex(text, -1) {
+		if m[2] == offset {
+			return true
+		}
+	}
+	word := strings.ToLower(text[offset:])
+	for _, full := range []string{"january", "february", "april", "june", "july", "august", "september", "october", "november", "december"} {
+		if strings.HasPrefix(word, full) {
+			return true
+		}
+	}
+	return false
+}
+
+// lastPeriod returns the complete period ending at end
+func lastPeriod(end time.Time, period, label string) Range {
+	u := units[period]
+	return Range{Start: end.AddDate(-u[0], -u[1], -u[2]), End: end, Label: label}
+}
+
+// periodStart returns the start of the day, week (Monday), month, quarter or
+// year containing day
+func periodStart(day time.Time, period string) time.Time {
+	switch period {
+	case "week":
+		offset := (int(day.Weekday()) + 6) % 7
+		return day.AddDate(0, 0, -offset)
+	case "month":
+		return time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, day.Location())
+	case "quarter":
+		month := time.Month((int(day.Month())-1)/3*3 + 1)
+		return time.Date(day.Year(), month, 1, 0, 0, 0, 0, day.Location())
+	case "year":
+		return time.Date(day.Year(), time.January, 1, 0, 0, 0, 0, day.Location())
+	}
+	return day
+}
+
+var (
+	isoDate   = regexp.MustCompile(`^(\d{4})-(\d{1,2})-(\d{1,2})$`)
+	usDate    = regexp.MustCompile(`^(\d{1,2})/(\d{1,2})/(\d{4})$`)
+	monthDay  = regexp.MustCompile(`(?i)^(` + monthName + `)\.?\s+(\d{1,2})` + ordinal + `(?:,?\s+(\d{4}))?$`)
+	dayMonth  = regexp.MustCompile(`(?i)^(\d{1,2})` + ordinal + `\s+(?:of\s+)?(` + monthName + `)(?:,?\s+(\d{4}))?$`)
+	separator = regexp.MustCompile(`\s+`)
+)
+
+// parseDate parses a single date. Without a year it's the most recent such
+// date up to today.
+func parseDate(text string, today time.Time) (time.Time, bool) {
+	text = separator.ReplaceAllString(strings.TrimSpace(text), " ")
+
+	var year, day int
+	var month time.Month
+	yearGiven := true
+	switch {
+	case isoDate.MatchString(text):
+		m := isoDate.FindStringSubmatch(text)
+		year, _ = strconv.Atoi(m[1])
+		mon, _ := strconv.Atoi(m[2])
+		month = time.Month(mon)
+		day, _ = strconv.Atoi(m[3])
+	case usDate.MatchString(text):
+		m := usDate.FindStringSubmatch(text)
+		mon, _ := strconv.Atoi(m[1])
+		month = time.Month(mon)
+		day, _ = strconv.Atoi(m[2])
+		year, _ = strconv.Atoi(m[3])
+	case monthDay.MatchString(text):
+		m := monthDay.FindStringSubmatch(text)
+		month = months[strings.ToLower(m[1][:3])]
+		day, _ = strconv.Atoi(m[2])
+		year, yearGiven = yearOr(m[3], today)
+	case dayMonth.MatchString(text):
+		m := dayMonth.FindStringSubmatch(text)
+		day, _ = strconv.Atoi(m[1])
+		month = months[strings.ToLower(m[2][:3])]
+		year, yearGiven = yearOr(m[3], today)
+	default:
+		return time.Time{}, false
+	}
+
+	if month < time.January || month > time.December || day < 1 || day > 31 {
+		return time.Time{}, false
+	}
+	t := time.Date(year, month, day, 0, 0, 0, 0, today.Location())
+	if t.Day() != day {
+		// e.g. February 30
+		return time.Time{}, false
+	}
+	if !yearGiven && t.After(today) {
+		t = t.AddDate(-1, 0, 0)
+	}
+	return t, true
+}
+
+// yearOr parses year, or returns today's year if it's empty
+func yearOr(year string, today time.Time) (int, bool) {
+	if year == "" {
+		return today.Year(), false
+	}
+	y, _ := strconv.Atoi(year)
+	return y, true
+}
+
+// parseYear parses a four or two digit year, the latter meaning 20xx
+func parseYear(year string) int {
+	y, _ := strconv.Atoi(year)
+	if y < 100 {
+		y += 2000
+	}
+	return y
+}
+
+func parseNumber(text string) (int, bool) {
+	if n, err := strconv.Atoi(text); err == nil {
+		return n, true
+	}
+	n, ok := numbers[strings.ToLower(text)]
+	return n, ok
+}
+
+// label normalizes the matched expression for display
+func label(text string) string {
+	return strings.ToLower(separator.ReplaceAllString(strings.TrimSpace(text), " "))
+}
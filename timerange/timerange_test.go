@@ -0,0 +1,127 @@
+package timerange
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("No timezone data: %v", err)
+	}
+	// Late on Friday March 15th in New York is already the 16th in UTC
+	now := time.Date(2024, time.March, 16, 2, 0, 0, 0, time.UTC).In(ny)
+	date := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 0, 0, 0, 0, ny)
+	}
+
+	testCases := []struct {
+		text    string
+		start   time.Time
+		end     time.Time
+		compare time.Time
+	}{
+		{"today", date(2024, time.March, 15), date(2024, time.March, 16), time.Time{}},
+		{"yesterday", date(2024, time.March, 14), date(2024, time.March, 15), time.Time{}},
+		{"revenue last month", date(2024, time.February, 1), date(2024, time.March, 1), time.Time{}},
+		{"this month", date(2024, time.March, 1), date(2024, time.March, 16), time.Time{}},
+		{"last week", date(2024, time.March, 4), date(2024, time.March, 11), time.Time{}},
+		{"last quarter", date(2023, time.October, 1), date(2024, time.January, 1), time.Time{}},
+		{"last year", date(2023, time.January, 1), date(2024, time.January, 1), time.Time{}},
+		{"the past 90 days", date(2023, time.December, 17), date(2024, time.March, 16), time.Time{}},
+		{"in the last 6 months", date(2023, time.September, 16), date(2024, time.March, 16), time.Time{}},
+		{"last two weeks", date(2024, time.March, 2), date(2024, time.March, 16), time.Time{}},
+		{"YTD", date(2024, time.January, 1), date(2024, time.March, 16), time.Time{}},
+		{"month to date", date(2024, time.March, 1), date(2024, time.March, 16), time.Time{}},
+		{"qtd", date(2024, time.January, 1), date(2024, time.March, 16), time.Time{}},
+		{"week over week", date(2024, time.March, 4), date(2024, time.March, 11), date(2024, time.February, 26)},
+		{"MoM", date(2024, time.February, 1), date(2024, time.March, 1), date(2024, time.January, 1)},
+		{"year-over-year", date(2023, time.January, 1), date(2024, time.January, 1), date(2022, time.January, 1)},
+		{"Q1", date(2024, time.January, 1), date(2024, time.April, 1), time.Time{}},
+		{"in Q3", date(2023, time.July, 1), date(2023, time.October, 1), time.Time{}},
+		{"Q3 2026", date(2026, time.July, 1), date(2026, time.October, 1), time.Time{}},
+		{"2022 Q4", date(2022, time.October, 1), date(2023, time.January, 1), time.Time{}},
+		{"Q2 '23", date(2023, time.April, 1), date(2023, time.July, 1), time.Time{}},
+		{"September 2026", date(2026, time.September, 1), date(2026, time.October, 1), time.Time{}},
+		{"in September", date(2023, time.September, 1), date(2023, time.October, 1), time.Time{}},
+		{"during sept '22", date(2022, time.September, 1), date(2022, time.October, 1), time.Time{}},
+		{"in march", date(2024, time.March, 1), date(2024, time.April, 1), time.Time{}},
+		{"in 2023", date(2023, time.January, 1), date(2024, time.January, 1), time.Time{}},
+		{"since June 1", date(2023, time.June, 1), date(2024, time.March, 16), time.Time{}},
+		{"since March 1st", date(2024, time.March, 1), date(2024, time.March, 16), time.Time{}},
+		{"since 2024-02-10", date(2024, time.February, 10), date(2024, time.March, 16), time.Time{}},
+		{"since January", date(2024, time.January, 1), date(2024, time.March, 16), time.Time{}},
+		{"between Jan 5 and Jan 11, 2024", date(2024, time.January, 5), date(2024, time.January, 12), time.Time{}},
+		{"from 2/1/2024 to 2/29/2024", date(2024, time.February, 1), date(2024, time.March, 1), time.Time{}},
+		{"on 3 March", date(2024, time.March, 3), date(2024, time.March, 4), time.Time{}},
+	}
+
+	for _, tc := range testCases {
+		r := Parse(tc.text, now)
+		if r == nil {
+			t.Errorf("Parse(%q) found no range", tc.text)
+			continue
+		}
+		t.Logf("%q: %s to %s", tc.text, r.Start.Format("2006-01-02"), r.End.Format("2006-01-02"))
+		if !r.Start.Equal(tc.start) || !r.End.Equal(tc.end) {
+			t.Errorf("Parse(%q) = %v to %v, expected %v to %v", tc.text, r.Start, r.End, tc.start, tc.end)
+		}
+		switch {
+		case tc.compare.IsZero() && r.Compare != nil:
+			t.Errorf("Parse(%q) has an unexpected comparison period %+v", tc.text, r.Compare)
+		case !tc.compare.IsZero() && (r.Compare == nil || !r.Compare.Start.Equal(tc.compare) || !r.Compare.End.Equal(tc.start)):
+			t.Errorf("Parse(%q) compares with %+v, expected %v to %v", tc.text, r.Compare, tc.compare, tc.start)
+		}
+	}
+}
+
+func TestParseNoRange(t *testing.T) {
+	now := time.Date(2024, time.March, 15, 12, 0, 0, 0, time.UTC)
+	for _, text := range []string{
+		"which partners use source tags",
+		"may I see the top partners",
+		"which source tags went up in tq",
+		"revenue for the marketing partner",
+		"since February 30",
+	} {
+		if r := Parse(text, now); r != nil {
+			t.Errorf("Parse(%q) = %+v, expected no range", text, r)
+		}
+	}
+}
+
+func TestPrevious(t *testing.T) {
+	date := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	}
+	testCases := []struct {
+		r     Range
+		start time.Time
+	}{
+		{Range{Start: date(2024, time.February, 1), End: date(2024, time.March, 1)}, date(2024, time.January, 1)},
+		{Range{Start: date(2023, time.October, 1), End: date(2024, time.January, 1)}, date(2023, time.July, 1)},
+		{Range{Start: date(2024, time.March, 9), End: date(2024, time.March, 16)}, date(2024, time.March, 2)},
+	}
+
+	for _, tc := range testCases {
+		prev := tc.r.Previous()
+		if !prev.Start.Equal(tc.start) || !prev.End.Equal(tc.r.Start) {
+			t.Errorf("Previous of %v to %v = %v to %v, expected %v to %v",
+				tc.r.Start, tc.r.End, prev.Start, prev.End, tc.start, tc.r.Start)
+		}
+	}
+}
+
+func TestYearEarlier(t *testing.T) {
+	r := Range{
+		Start: time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC),
+		End:   time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC),
+		Label: "last month",
+	}
+	earlier := r.YearEarlier()
+	start, end := earlier.Dates()
+	if start != "2023-02-01" || end != "2023-03-01" {
+		t.Errorf("YearEarlier of February 2024 = %s to %s, expected February 2023", start, end)
+	}
+}
@@ -0,0 +1,57 @@
+package tunnel
+
+import (
+	"fmt"
+
+	"github.com/dnc-data-mcp/config"
+)
+
+// Connector makes the database reachable and reports where to connect to it
+type Connector interface {
+	// Endpoint returns the host and port the database driver should dial
+	Endpoint() (string, int)
+	Close() error
+}
+
+// Opener creates the Connector for a connection mode
+type Opener func(ds config.Datasource) (Connector, error)
+
+var openers = map[string]Opener{
+	config.ModeSSH: func(ds config.Datasource) (Connector, error) {
+		return NewSSHTunnel(ds)
+	},
+	config.ModeDirect: func(ds config.Datasource) (Connector, error) {
+		return &DirectConnector{Datasource: ds}, nil
+	},
+}
+
+// Register adds or replaces the Opener for a connection mode. The mode is also
+// registered with config so validation accepts it.
+func Register(mode string, open Opener) {
+	openers[mode] = open
+	config.RegisterMode(mode)
+}
+
+// Open connects to a datasource using its connection mode
+func Open(ds config.Datasource) (Connector, error) {
+	open, ok := openers[ds.Mode()]
+	if !ok {
+		return nil, fmt.Errorf("unknown connection mode for %s: %q", ds.Name, ds.Mode())
+	}
+	return open(ds)
+}
+
+// DirectConnector connects straight to the configured database server
+type DirectConnector struct {
+	Datasource config.Datasource
+}
+
+// Endpoint returns the database server from config
+func (d *DirectConnector) Endpoint() (string, int) {
+	return d.Datasource.Server, d.Datasource.Port
+}
+
+// Close is a no-op; there is nothing to tear down
+func (d *DirectConnector) Close() error {
+	return nil
+}
@@ -0,0 +1,233 @@
+package tunnel
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/dnc-data-mcp/config"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// hop is a fully resolved SSH hop, ready to dial
+type hop struct {
+	alias      string
+	addr       string
+	user       string
+	keyPath    string
+	knownHosts string
+	hostKey    string
+}
+
+// resolveHops turns the configured jump chain into dialable hops, filling unset
+// fields from the ssh config file when one is configured
+func resolveHops(cfg config.SSHConfig) ([]hop, error) {
+	var sc *sshConfigFile
+	if cfg.SSHConfigFile != "" {
+		var err error
+		sc, err = loadSSHConfig(cfg.SSHConfigFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	chain := cfg.Hops()
+	// Fall back to the bastion's ProxyJump entry when no jump hosts are configured
+	if len(cfg.JumpHosts) == 0 {
+		jumps, err := parseProxyJump(sc.Get(cfg.SSHHost, "proxyjump"))
+		if err != nil {
+			return nil, err
+		}
+		chain = append(jumps, chain...)
+	}
+
+	hops := make([]hop, 0, len(chain))
+	for _, jh := range chain {
+		hops = append(hops, resolveHop(jh, sc))
+	}
+	return hops, nil
+}
+
+// resolveHop merges a configured hop with its ssh config Host entry. Values set
+// explicitly in our config take precedence.
+func resolveHop(jh config.JumpHost, sc *sshConfigFile) hop {
+	h := hop{
+		alias:      jh.Host,
+		user:       firstNonEmpty(jh.User, sc.Get(jh.Host, "user")),
+		keyPath:    firstNonEmpty(jh.PrivateKey, sc.Get(jh.Host, "identityfile")),
+		knownHosts: jh.KnownHosts,
+		hostKey:    jh.HostKey,
+	}
+	if h.knownHosts == "" {
+		// UserKnownHostsFile may list several files; we only use the first
+		if fields := strings.Fields(sc.Get(jh.Host, "userknownhostsfile")); len(fields) > 0 {
+			h.knownHosts = fields[0]
+		}
+	}
+	if h.knownHosts == "" && h.hostKey == "" && strings.EqualFold(sc.Get(jh.Host, "stricthostkeychecking"), "yes") {
+		h.knownHosts = "~/.ssh/known_hosts"
+	}
+
+	hostName := jh.Host
+	if hn := sc.Get(jh.Host, "hostname"); hn != "" {
+		hostName = strings.ReplaceAll(hn, "%h", jh.Host)
+	}
+
+	port := jh.Port
+	if port == 0 {
+		port, _ = strconv.Atoi(sc.Get(jh.Host, "port"))
+	}
+	if port == 0 {
+		port = 22
+	}
+
+	h.addr = net.JoinHostPort(hostName, strconv.Itoa(port))
+	return h
+}
+
+// parseProxyJump parses an OpenSSH ProxyJump value: [user@]host[:port],...
+func parseProxyJump(value string) ([]config.JumpHost, error) {
+	if value == "" || strings.EqualFold(value, "none") {
+		return nil, nil
+	}
+
+	var jumps []config.JumpHost
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		var jh config.JumpHost
+		if at := strings.LastIndex(entry, "@"); at >= 0 {
+			jh.User = entry[:at]
+			entry = entry[at+1:]
+		}
+		jh.Host = entry
+		if host, port, err := net.SplitHostPort(entry); err == nil {
+			p, err := strconv.Atoi(port)
+			if err != nil {
+				return nil, fmt.Errorf("invalid port in ProxyJump entry %q: %v", entry, err)
+			}
+			jh.Host = host
+			jh.Port = p
+		}
+		jumps = append(jumps, jh)
+	}
+	return jumps, nil
+}
+
+// clientConfig builds the ssh.ClientConfig for a hop
+func (h hop) clientConfig() (*ssh.ClientConfig, error) {
+	if h.keyPath == "" {
+		return nil, fmt.Errorf("no private key configured for %s", h.alias)
+	}
+	keyPath := config.ExpandPath(h.keyPath)
+	log.Printf("Using SSH key for %s: %s\n", h.alias, keyPath)
+
+	// Read the SSH key
+	key, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read private key: %v", err)
+	}
+
+	// Create the Signer for this private key
+	signer, err := ssh.ParsePrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse private key: %v", err)
+	}
+
+	hostKeyCallback, err := h.hostKeyCallback()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ssh.ClientConfig{
+		User: h.user,
+		Auth: []ssh.AuthMethod{
+			ssh.PublicKeys(signer),
+		},
+		HostKeyCallback: hostKeyCallback,
+	}, nil
+}
+
+// hostKeyCallback verifies the hop against a pinned key, a known_hosts file, or
+// nothing at all when neither is configured
+func (h hop) hostKeyCallback() (ssh.HostKeyCallback, error) {
+	switch {
+	case strings.HasPrefix(h.hostKey, "SHA256:"):
+		return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			if fp := ssh.FingerprintSHA256(key); fp != h.hostKey {
+				return fmt.Errorf("host key mismatch for %s: got %s, want %s", hostname, fp, h.hostKey)
+			}
+			return nil
+		}, nil
+	case h.hostKey != "":
+		pub, _, _, _, err := ssh.ParseAuthorizedKey([]byte(h.hostKey))
+		if err != nil {
+			return nil, fmt.Errorf("invalid host key for %s: %v", h.alias, err)
+		}
+		return ssh.FixedHostKey(pub), nil
+	case h.knownHosts != "":
+		callback, err := knownhosts.New(config.ExpandPath(h.knownHosts))
+		if err != nil {
+			return nil, fmt.Errorf("unable to load known hosts for %s: %v", h.alias, err)
+		}
+		return callback, nil
+	default:
+		log.Printf("No host key configured for %s, skipping host key verification\n", h.alias)
+		return ssh.InsecureIgnoreHostKey(), nil
+	}
+}
+
+// dialChain connects through every hop in order, returning one client per hop.
+// The last client is the one used to reach the database.
+func dialChain(hops []hop) ([]*ssh.Client, error) {
+	clients := make([]*ssh.Client, 0, len(hops))
+	closeAll := func() { closeClients(clients) }
+
+	for i, h := range hops {
+		sshConfig, err := h.clientConfig()
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+
+		log.Printf("Connecting to SSH server: %s\n", h.addr)
+		var client *ssh.Client
+		if i == 0 {
+			client, err = ssh.Dial("tcp", h.addr, sshConfig)
+			if err != nil {
+				closeAll()
+				return nil, fmt.Errorf("unable to connect to SSH server %s: %v", h.addr, err)
+			}
+		} else {
+			// Tunnel the next hop's SSH connection through the previous one
+			conn, err := clients[i-1].Dial("tcp", h.addr)
+			if err != nil {
+				closeAll()
+				return nil, fmt.Errorf("unable to reach %s via %s: %v", h.addr, hops[i-1].addr, err)
+			}
+			c, chans, reqs, err := ssh.NewClientConn(conn, h.addr, sshConfig)
+			if err != nil {
+				conn.Close()
+				closeAll()
+				return nil, fmt.Errorf("unable to connect to SSH server %s: %v", h.addr, err)
+			}
+			client = ssh.NewClient(c, chans, reqs)
+		}
+		log.Printf("Connected to SSH server: %s\n", h.addr)
+		clients = append(clients, client)
+	}
+
+	return clients, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
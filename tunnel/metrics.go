@@ -0,0 +1,83 @@
+package tunnel
+
+import (
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// defaultMaxConns caps concurrent forwarded connections when ssh_max_conns is unset
+const defaultMaxConns = 32
+
+// Metrics counts forwarded connection activity for a tunnel
+type Metrics struct {
+	active       atomic.Int64
+	total        atomic.Int64
+	rejected     atomic.Int64
+	dialFailures atomic.Int64
+	bytesIn      atomic.Int64
+	bytesOut     atomic.Int64
+	dials        atomic.Int64
+	dialNanos    atomic.Int64
+	maxDialNanos atomic.Int64
+	reconnects   atomic.Int64
+}
+
+// Stats is a point in time snapshot of a tunnel's Metrics. BytesOut counts
+// bytes sent towards the database, BytesIn bytes received from it.
+type Stats struct {
+	ActiveConns      int64   `json:"active_conns"`
+	MaxConns         int     `json:"max_conns"`
+	TotalConns       int64   `json:"total_conns"`
+	RejectedConns    int64   `json:"rejected_conns"`
+	DialFailures     int64   `json:"dial_failures"`
+	BytesIn          int64   `json:"bytes_in"`
+	BytesOut         int64   `json:"bytes_out"`
+	DialLatencyAvgMs float64 `json:"dial_latency_avg_ms"`
+	DialLatencyMaxMs float64 `json:"dial_latency_max_ms"`
+	Reconnects       int64   `json:"reconnects"`
+}
+
+// recordDial records how long a successful remote dial took
+func (m *Metrics) recordDial(d time.Duration) {
+	m.dials.Add(1)
+	m.dialNanos.Add(int64(d))
+	for {
+		max := m.maxDialNanos.Load()
+		if int64(d) <= max || m.maxDialNanos.CompareAndSwap(max, int64(d)) {
+			return
+		}
+	}
+}
+
+// snapshot returns the current counter values
+func (m *Metrics) snapshot(maxConns int) Stats {
+	s := Stats{
+		ActiveConns:      m.active.Load(),
+		MaxConns:         maxConns,
+		TotalConns:       m.total.Load(),
+		RejectedConns:    m.rejected.Load(),
+		DialFailures:     m.dialFailures.Load(),
+		BytesIn:          m.bytesIn.Load(),
+		BytesOut:         m.bytesOut.Load(),
+		DialLatencyMaxMs: float64(m.maxDialNanos.Load()) / float64(time.Millisecond),
+		Reconnects:       m.reconnects.Load(),
+	}
+	if dials := m.dials.Load(); dials > 0 {
+		s.DialLatencyAvgMs = float64(m.dialNanos.Load()) / float64(dials) / float64(time.Millisecond)
+	}
+	return s
+}
+
+// countingWriter adds every byte written to a counter as it goes, so the
+// metrics stay current for long-lived connections
+type countingWriter struct {
+	w     io.Writer
+	count *atomic.Int64
+}
+
+func (c countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.count.Add(int64(n))
+	return n, err
+}
@@ -0,0 +1,133 @@
+package tunnel
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/dnc-data-mcp/config"
+)
+
+// sshConfigHost is one Host block from an OpenSSH client config file
+type sshConfigHost struct {
+	patterns []string
+	options  map[string]string
+}
+
+// sshConfigFile is the subset of ~/.ssh/config the tunnel understands
+type sshConfigFile struct {
+	hosts []sshConfigHost
+}
+
+// loadSSHConfig reads an OpenSSH client config file
+func loadSSHConfig(configPath string) (*sshConfigFile, error) {
+	f, err := os.Open(config.ExpandPath(configPath))
+	if err != nil {
+		return nil, fmt.Errorf("unable to open ssh config: %v", err)
+	}
+	defer f.Close()
+	return parseSSHConfig(f)
+}
+
+// parseSSHConfig parses Host blocks and their keyword/value pairs. Match blocks
+// are skipped since they depend on runtime conditions we don't evaluate.
+func parseSSHConfig(r io.Reader) (*sshConfigFile, error) {
+	cfg := &sshConfigFile{}
+	// Options before the first Host line apply to every host
+	current := &sshConfigHost{patterns: []string{"*"}, options: map[string]string{}}
+	skipping := false
+
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		keyword, value := splitSSHConfigLine(line)
+		if value == "" {
+			return nil, fmt.Errorf("ssh config line %d: missing value for %s", lineNo, keyword)
+		}
+
+		switch keyword {
+		case "host":
+			cfg.hosts = append(cfg.hosts, *current)
+			current = &sshConfigHost{patterns: strings.Fields(value), options: map[string]string{}}
+			skipping = false
+		case "match":
+			cfg.hosts = append(cfg.hosts, *current)
+			current = &sshConfigHost{options: map[string]string{}}
+			skipping = true
+		default:
+			if skipping {
+				continue
+			}
+			// The first value for a keyword wins, as in OpenSSH
+			if _, ok := current.options[keyword]; !ok {
+				current.options[keyword] = value
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading ssh config: %v", err)
+	}
+	cfg.hosts = append(cfg.hosts, *current)
+
+	return cfg, nil
+}
+
+// splitSSHConfigLine splits "Keyword value" or "Keyword=value" into a lowercase
+// keyword and an unquoted value
+func splitSSHConfigLine(line string) (string, string) {
+	idx := strings.IndexAny(line, " \t=")
+	if idx < 0 {
+		return strings.ToLower(line), ""
+	}
+	keyword := strings.ToLower(line[:idx])
+	value := strings.TrimLeft(line[idx:], " \t=")
+	value = strings.TrimSpace(value)
+	if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+		value = value[1 : len(value)-1]
+	}
+	return keyword, value
+}
+
+// Get returns the first value of keyword among the blocks matching alias
+func (c *sshConfigFile) Get(alias, keyword string) string {
+	if c == nil {
+		return ""
+	}
+	keyword = strings.ToLower(keyword)
+	for _, h := range c.hosts {
+		if !h.matches(alias) {
+			continue
+		}
+		if v, ok := h.options[keyword]; ok {
+			return v
+		}
+	}
+	return ""
+}
+
+// matches reports whether alias matches the block's patterns, honoring negation
+func (h sshConfigHost) matches(alias string) bool {
+	matched := false
+	for _, p := range h.patterns {
+		negate := strings.HasPrefix(p, "!")
+		p = strings.TrimPrefix(p, "!")
+		ok, err := path.Match(p, alias)
+		if err != nil || !ok {
+			continue
+		}
+		if negate {
+			return false
+		}
+		matched = true
+	}
+	return matched
+}
@@ -0,0 +1,111 @@
+package tunnel
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dnc-data-mcp/config"
+)
+
+const testSSHConfig = `
+# Applies to everything
+ServerAliveInterval 30
+
+Host corp-bastion
+    HostName bastion.corp.example.com
+    User alice
+    IdentityFile ~/.ssh/corp_ed25519
+    UserKnownHostsFile /tmp/corp_known_hosts /tmp/other
+
+Host vpc-bastion
+    HostName=10.0.0.5
+    Port 2222
+    ProxyJump alice@corp-bastion
+
+Host *.internal !skip.internal
+    User "internal user"
+
+Match host foo
+    User ignored
+`
+
+func TestParseSSHConfig(t *testing.T) {
+	sc, err := parseSSHConfig(strings.NewReader(testSSHConfig))
+	if err != nil {
+		t.Fatalf("Failed to parse ssh config: %v", err)
+	}
+
+	testCases := []struct {
+		alias, keyword, want string
+	}{
+		{"corp-bastion", "HostName", "bastion.corp.example.com"},
+		{"corp-bastion", "serveraliveinterval", "30"},
+		{"vpc-bastion", "hostname", "10.0.0.5"},
+		{"vpc-bastion", "port", "2222"},
+		{"vpc-bastion", "proxyjump", "alice@corp-bastion"},
+		{"db.internal", "user", "internal user"},
+		{"skip.internal", "user", ""},
+		{"foo", "user", ""},
+	}
+
+	for _, tc := range testCases {
+		if got := sc.Get(tc.alias, tc.keyword); got != tc.want {
+			t.Errorf("Get(%q, %q) = %q, want %q", tc.alias, tc.keyword, got, tc.want)
+		}
+	}
+}
+
+func TestResolveHopsFromSSHConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(path, []byte(testSSHConfig), 0600); err != nil {
+		t.Fatalf("Failed to write ssh config: %v", err)
+	}
+
+	cfg := config.SSHConfig{
+		SSHHost:       "vpc-bastion",
+		SSHUser:       "bob",
+		SSHPrivateKey: "/keys/vpc",
+		SSHConfigFile: path,
+	}
+
+	hops, err := resolveHops(cfg)
+	if err != nil {
+		t.Fatalf("Failed to resolve hops: %v", err)
+	}
+	if len(hops) != 2 {
+		t.Fatalf("Expected 2 hops, got %d: %+v", len(hops), hops)
+	}
+
+	corp := hops[0]
+	if corp.addr != "bastion.corp.example.com:22" || corp.user != "alice" ||
+		corp.keyPath != "~/.ssh/corp_ed25519" || corp.knownHosts != "/tmp/corp_known_hosts" {
+		t.Errorf("Unexpected corp hop: %+v", corp)
+	}
+
+	vpc := hops[1]
+	if vpc.addr != "10.0.0.5:2222" || vpc.user != "bob" || vpc.keyPath != "/keys/vpc" {
+		t.Errorf("Unexpected vpc hop: %+v", vpc)
+	}
+}
+
+func TestParseProxyJump(t *testing.T) {
+	jumps, err := parseProxyJump("alice@corp:2200, vpc")
+	if err != nil {
+		t.Fatalf("Failed to parse ProxyJump: %v", err)
+	}
+	if len(jumps) != 2 {
+		t.Fatalf("Expected 2 jumps, got %d", len(jumps))
+	}
+	if jumps[0].User != "alice" || jumps[0].Host != "corp" || jumps[0].Port != 2200 {
+		t.Errorf("Unexpected first jump: %+v", jumps[0])
+	}
+	if jumps[1].Host != "vpc" || jumps[1].Port != 0 {
+		t.Errorf("Unexpected second jump: %+v", jumps[1])
+	}
+
+	if jumps, _ := parseProxyJump("none"); len(jumps) != 0 {
+		t.Errorf("Expected no jumps for none, got %+v", jumps)
+	}
+}
@@ -1,79 +1,93 @@
 package tunnel
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net"
-	"os"
-	"path/filepath"
-	"strings"
+	"sync"
+	"time"
 
 	"github.com/dnc-data-mcp/config"
 	"golang.org/x/crypto/ssh"
 )
 
-type SSHTunnel struct {
-	Local  *net.TCPListener
-	Config *config.Config
-	client *ssh.Client
-}
+// defaultDrainTimeout is how long Close waits for in-flight connections when
+// ssh_drain_timeout is unset
+const defaultDrainTimeout = 10 * time.Second
 
-func NewSSHTunnel(cfg *config.Config) (*SSHTunnel, error) {
-	// Expand the private key path if it contains ~
-	keyPath := cfg.Default.SSHPrivateKey
-	if strings.HasPrefix(keyPath, "~") {
-		homeDir, err := os.UserHomeDir()
-		if err != nil {
-			return nil, fmt.Errorf("error getting home directory: %v", err)
-		}
-		keyPath = filepath.Join(homeDir, keyPath[1:])
-	}
+// defaultLocalAddr is where the default datasource's tunnel listens when
+// ssh_local_addr is unset
+const defaultLocalAddr = "localhost:5433"
 
-	log.Printf("Using SSH key: %s\n", keyPath)
+type SSHTunnel struct {
+	Local *net.TCPListener
+	// Datasource is the database this tunnel forwards to
+	Datasource config.Datasource
+	// chain is the resolved jump chain, kept for reconnecting
+	chain []hop
+	// clientMu guards client and hops, which are replaced on reconnect
+	clientMu sync.Mutex
+	client   *ssh.Client
+	// hops holds every client in the jump chain, ending with client
+	hops []*ssh.Client
+	// slots bounds the number of concurrently forwarded connections
+	slots   chan struct{}
+	metrics Metrics
 
-	// Read the SSH key
-	key, err := os.ReadFile(keyPath)
-	if err != nil {
-		return nil, fmt.Errorf("unable to read private key: %v", err)
-	}
+	// mu guards closing, forced and conns; inflight counts forwarded
+	// connections
+	mu        sync.Mutex
+	closing   bool
+	forced    bool
+	conns     map[net.Conn]struct{}
+	inflight  sync.WaitGroup
+	closeOnce sync.Once
+	closeErr  error
+}
 
-	// Create the Signer for this private key
-	signer, err := ssh.ParsePrivateKey(key)
+// NewSSHTunnel connects to the datasource's bastion and starts forwarding a
+// local port to its database
+func NewSSHTunnel(ds config.Datasource) (*SSHTunnel, error) {
+	settings := ds.SSHSettings()
+	hops, err := resolveHops(settings)
 	if err != nil {
-		return nil, fmt.Errorf("unable to parse private key: %v", err)
+		return nil, err
 	}
 
-	// Configure SSH client
-	sshConfig := &ssh.ClientConfig{
-		User: cfg.Default.SSHUser,
-		Auth: []ssh.AuthMethod{
-			ssh.PublicKeys(signer),
-		},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-	}
-
-	// Connect to SSH server
-	addr := fmt.Sprintf("%s:%d", cfg.Default.SSHHost, cfg.Default.SSHPort)
-	log.Printf("Connecting to SSH server: %s\n", addr)
-	client, err := ssh.Dial("tcp", addr, sshConfig)
+	// Connect through the jump chain to the bastion
+	clients, err := dialChain(hops)
 	if err != nil {
-		return nil, fmt.Errorf("unable to connect to SSH server: %v", err)
+		return nil, err
 	}
-	log.Printf("Connected to SSH server: %s\n", addr)
+	client := clients[len(clients)-1]
 
-	// Start local listener on port 5433
-	local, err := net.Listen("tcp", "localhost:5433")
+	// Start local listener. The default datasource keeps the traditional port
+	// 5433; any others get a free port unless configured otherwise.
+	localAddr := settings.SSHLocalAddr
+	if localAddr == "" {
+		localAddr = "localhost:0"
+		if ds.Name == config.DefaultDatasource {
+			localAddr = defaultLocalAddr
+		}
+	}
+	local, err := net.Listen("tcp", localAddr)
 	if err != nil {
-		client.Close()
+		closeClients(clients)
 		return nil, fmt.Errorf("unable to start local listener: %v", err)
 	}
 	log.Printf("Started local listener on: %s\n", local.Addr().String())
 
 	tunnel := &SSHTunnel{
-		Local:  local.(*net.TCPListener),
-		Config: cfg,
-		client: client,
+		Local:      local.(*net.TCPListener),
+		Datasource: ds,
+		chain:      hops,
+		client:     client,
+		hops:       clients,
+		slots:      make(chan struct{}, maxConns(settings)),
+		conns:      make(map[net.Conn]struct{}),
 	}
 
 	// Start forwarding
@@ -84,9 +98,7 @@ func NewSSHTunnel(cfg *config.Config) (*SSHTunnel, error) {
 
 func (t *SSHTunnel) forward() {
 	// Use the database server from config
-	dbAddr := fmt.Sprintf("%s:%d",
-		t.Config.Database.ROTraffic.Server, // Use the server from config
-		t.Config.Database.ROTraffic.Port)   // Use the port from config
+	dbAddr := fmt.Sprintf("%s:%d", t.Datasource.Server, t.Datasource.Port)
 	log.Printf("Starting tunnel forwarding from %s to %s\n",
 		t.Local.Addr().String(),
 		dbAddr)
@@ -94,7 +106,7 @@ func (t *SSHTunnel) forward() {
 	for {
 		local, err := t.Local.Accept()
 		if err != nil {
-			if strings.Contains(err.Error(), "use of closed network connection") {
+			if errors.Is(err, net.ErrClosed) {
 				log.Printf("Local listener closed, stopping tunnel\n")
 				return
 			}
@@ -102,58 +114,287 @@ func (t *SSHTunnel) forward() {
 			continue
 		}
 
-		go func() {
-			defer local.Close()
-			log.Printf("Attempting to connect to remote address: %s\n", dbAddr)
+		t.metrics.total.Add(1)
 
-			remote, err := t.client.Dial("tcp", dbAddr)
-			if err != nil {
-				log.Printf("Remote dial error: %s\n", err)
-				return
-			}
-			defer remote.Close()
-
-			log.Printf("Connected to remote address: %s\n", dbAddr)
-
-			// Create channels to handle connection closure
-			done := make(chan struct{})
-			go func() {
-				defer close(done)
-				n, err := copyConn(local, remote)
-				if err != nil {
-					log.Printf("Error copying local to remote: %v (copied %d bytes)\n", err, n)
-				}
-			}()
-
-			go func() {
-				defer close(done)
-				n, err := copyConn(remote, local)
-				if err != nil {
-					log.Printf("Error copying remote to local: %v (copied %d bytes)\n", err, n)
-				}
-			}()
-
-			// Wait for either direction to complete
-			<-done
+		// Refuse rather than queue when we're at the limit, so a client leaking
+		// connections can't use up the bastion's channel limit
+		select {
+		case t.slots <- struct{}{}:
+		default:
+			t.metrics.rejected.Add(1)
+			log.Printf("Rejecting connection from %s: %d forwarded connections already open\n",
+				local.RemoteAddr(), cap(t.slots))
+			local.Close()
+			continue
+		}
+
+		// Register with the drain before handing off, unless we're shutting down
+		t.mu.Lock()
+		if t.closing {
+			t.mu.Unlock()
+			<-t.slots
+			local.Close()
+			return
+		}
+		t.inflight.Add(1)
+		t.mu.Unlock()
+
+		go func() {
+			defer t.inflight.Done()
+			defer func() { <-t.slots }()
+			t.handleConn(local, dbAddr)
 		}()
 	}
 }
 
+// handleConn forwards a single accepted connection to dbAddr
+func (t *SSHTunnel) handleConn(local net.Conn, dbAddr string) {
+	t.track(local)
+	defer t.untrack(local)
+	log.Printf("Attempting to connect to remote address: %s\n", dbAddr)
+
+	start := time.Now()
+	remote, err := t.dial(dbAddr)
+	if err != nil {
+		t.metrics.dialFailures.Add(1)
+		log.Printf("Remote dial error: %s\n", err)
+		return
+	}
+	t.track(remote)
+	defer t.untrack(remote)
+	t.metrics.recordDial(time.Since(start))
+
+	t.metrics.active.Add(1)
+	defer t.metrics.active.Add(-1)
+
+	log.Printf("Connected to remote address: %s\n", dbAddr)
+
+	// Copy each direction until its source hits EOF, then pass the EOF on with a
+	// half-close so the other side can finish what it's sending. A real error
+	// tears down both sides since neither direction can make progress after it.
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		n, err := copyConn(countingWriter{remote, &t.metrics.bytesOut}, local)
+		if err != nil {
+			log.Printf("Error copying local to remote: %v (copied %d bytes)\n", err, n)
+			local.Close()
+			remote.Close()
+			return
+		}
+		closeWrite(remote)
+	}()
+
+	go func() {
+		defer wg.Done()
+		n, err := copyConn(countingWriter{local, &t.metrics.bytesIn}, remote)
+		if err != nil {
+			log.Printf("Error copying remote to local: %v (copied %d bytes)\n", err, n)
+			local.Close()
+			remote.Close()
+			return
+		}
+		closeWrite(local)
+	}()
+
+	// Wait for both directions to complete
+	wg.Wait()
+}
+
+// dial opens a connection to addr through the bastion. If the SSH connection
+// turns out to be dead, the whole jump chain is redialed and the dial retried.
+func (t *SSHTunnel) dial(addr string) (net.Conn, error) {
+	t.clientMu.Lock()
+	client := t.client
+	t.clientMu.Unlock()
+
+	conn, err := client.Dial("tcp", addr)
+	if err == nil || alive(client) {
+		return conn, err
+	}
+
+	log.Printf("SSH connection lost (%v), reconnecting\n", err)
+	client, err = t.reconnect(client)
+	if err != nil {
+		return nil, err
+	}
+	return client.Dial("tcp", addr)
+}
+
+// reconnect redials the jump chain unless another connection already replaced
+// the dead client, and returns the current client
+func (t *SSHTunnel) reconnect(dead *ssh.Client) (*ssh.Client, error) {
+	t.clientMu.Lock()
+	defer t.clientMu.Unlock()
+
+	if t.client != dead {
+		return t.client, nil
+	}
+
+	t.mu.Lock()
+	closing := t.closing
+	t.mu.Unlock()
+	if closing {
+		return nil, fmt.Errorf("tunnel is shutting down")
+	}
+
+	clients, err := dialChain(t.chain)
+	if err != nil {
+		return nil, fmt.Errorf("unable to reconnect: %v", err)
+	}
+	closeClients(t.hops)
+	t.hops = clients
+	t.client = clients[len(clients)-1]
+	t.metrics.reconnects.Add(1)
+	log.Printf("Reconnected to SSH server\n")
+	return t.client, nil
+}
+
+// alive reports whether the SSH connection still answers requests
+func alive(client *ssh.Client) bool {
+	_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+	return err == nil
+}
+
+// track records an open connection so Shutdown can force it closed. Once
+// Shutdown has given up draining, connections are closed as they turn up.
+func (t *SSHTunnel) track(c net.Conn) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.forced {
+		c.Close()
+		return
+	}
+	t.conns[c] = struct{}{}
+}
+
+// untrack closes a connection and forgets it
+func (t *SSHTunnel) untrack(c net.Conn) {
+	t.mu.Lock()
+	delete(t.conns, c)
+	t.mu.Unlock()
+	c.Close()
+}
+
+// Stats returns a snapshot of the tunnel's connection metrics
+func (t *SSHTunnel) Stats() Stats {
+	return t.metrics.snapshot(cap(t.slots))
+}
+
+// maxConns returns the configured concurrent connection limit
+func maxConns(settings config.SSHConfig) int {
+	if settings.SSHMaxConns > 0 {
+		return settings.SSHMaxConns
+	}
+	return defaultMaxConns
+}
+
+// Endpoint returns the local host and port the tunnel listens on
+func (t *SSHTunnel) Endpoint() (string, int) {
+	return "localhost", t.Local.Addr().(*net.TCPAddr).Port
+}
+
 // GetLocalEndpoint returns the local endpoint for the tunnel
 func (t *SSHTunnel) GetLocalEndpoint() string {
 	return t.Local.Addr().String()
 }
 
-func copyConn(writer, reader net.Conn) (int64, error) {
+func copyConn(writer io.Writer, reader net.Conn) (int64, error) {
 	return io.Copy(writer, reader)
 }
 
+// Close shuts the tunnel down, giving in-flight connections up to the
+// configured drain timeout to finish
 func (t *SSHTunnel) Close() error {
-	if t.Local != nil {
-		t.Local.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), drainTimeout(t.Datasource.SSHSettings()))
+	defer cancel()
+	return t.Shutdown(ctx)
+}
+
+// Shutdown stops accepting connections and waits for in-flight ones to finish
+// until ctx is done, after which any still open are closed forcibly along with
+// the SSH clients, so dials stuck on the bastion give up too. Only the first call does any work; later calls
+// return the same result.
+func (t *SSHTunnel) Shutdown(ctx context.Context) error {
+	t.closeOnce.Do(func() {
+		t.closeErr = t.shutdown(ctx)
+	})
+	return t.closeErr
+}
+
+func (t *SSHTunnel) shutdown(ctx context.Context) error {
+	var errs []error
+
+	t.mu.Lock()
+	t.closing = true
+	t.mu.Unlock()
+
+	if err := t.Local.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+		errs = append(errs, fmt.Errorf("error closing local listener: %v", err))
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		t.inflight.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		errs = append(errs, t.closeHops()...)
+	case <-ctx.Done():
+		t.mu.Lock()
+		t.forced = true
+		open := len(t.conns)
+		for c := range t.conns {
+			c.Close()
+		}
+		t.mu.Unlock()
+		errs = append(errs, fmt.Errorf("forcibly closed %d connections after drain timeout: %v", open, ctx.Err()))
+		// A dial still waiting on the bastion only returns once its SSH
+		// connection is gone
+		errs = append(errs, t.closeHops()...)
+		<-drained
+	}
+
+	return errors.Join(errs...)
+}
+
+// closeHops closes the jump chain from the far end back towards us
+func (t *SSHTunnel) closeHops() []error {
+	t.clientMu.Lock()
+	defer t.clientMu.Unlock()
+
+	var errs []error
+	for i := len(t.hops) - 1; i >= 0; i-- {
+		if err := t.hops[i].Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+			errs = append(errs, fmt.Errorf("error closing SSH connection: %v", err))
+		}
+	}
+	return errs
+}
+
+// drainTimeout returns how long Close waits for in-flight connections
+func drainTimeout(settings config.SSHConfig) time.Duration {
+	if settings.SSHDrainTimeout > 0 {
+		return settings.SSHDrainTimeout
 	}
-	if t.client != nil {
-		t.client.Close()
+	return defaultDrainTimeout
+}
+
+// closeWrite half-closes c if it supports it, and fully closes it otherwise
+func closeWrite(c net.Conn) {
+	if cw, ok := c.(interface{ CloseWrite() error }); ok {
+		cw.CloseWrite()
+		return
+	}
+	c.Close()
+}
+
+// closeClients closes a jump chain from the far end back towards us
+func closeClients(clients []*ssh.Client) {
+	for i := len(clients) - 1; i >= 0; i-- {
+		clients[i].Close()
 	}
-	return nil
 }
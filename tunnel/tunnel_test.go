@@ -0,0 +1,320 @@
+package tunnel
+
+import (
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dnc-data-mcp/config"
+)
+
+// newTestDatasource returns a datasource pointing the tunnel at server and the
+// database at the given target, listening on an ephemeral local port
+func newTestDatasource(server *testSSHServer, keyPath, targetHost string, targetPort int) config.Datasource {
+	ds := config.Datasource{Name: "test", SSH: &config.SSHConfig{}}
+	ds.SSH.SSHHost, ds.SSH.SSHPort = server.Addr()
+	ds.SSH.SSHUser = "tester"
+	ds.SSH.SSHPrivateKey = keyPath
+	ds.SSH.SSHHostKey = server.HostKeyFingerprint()
+	ds.SSH.SSHLocalAddr = "127.0.0.1:0"
+	ds.Server = targetHost
+	ds.Port = targetPort
+	return ds
+}
+
+// roundTrip sends msg through the tunnel, half-closes, and returns the echo
+func roundTrip(t *testing.T, c Connector, msg string) string {
+	t.Helper()
+
+	host, port := c.Endpoint()
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, strconv.Itoa(port)), 5*time.Second)
+	if err != nil {
+		t.Fatalf("Failed to connect to tunnel: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if _, err := conn.Write([]byte(msg)); err != nil {
+		t.Fatalf("Failed to write through tunnel: %v", err)
+	}
+	// The echo server only finishes once it sees our EOF, so this also checks
+	// that half-closes make it through the tunnel
+	if err := conn.(*net.TCPConn).CloseWrite(); err != nil {
+		t.Fatalf("Failed to half-close: %v", err)
+	}
+
+	reply, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("Failed to read through tunnel: %v", err)
+	}
+	return string(reply)
+}
+
+func TestTunnelForwarding(t *testing.T) {
+	keyPath, pub := writeTestKey(t)
+	server := newTestSSHServer(t, pub)
+	echoHost, echoPort := startEchoServer(t)
+
+	tun, err := NewSSHTunnel(newTestDatasource(server, keyPath, echoHost, echoPort))
+	if err != nil {
+		t.Fatalf("Failed to create SSH tunnel: %v", err)
+	}
+	defer tun.Close()
+
+	if got := roundTrip(t, tun, "hello"); got != "hello" {
+		t.Errorf("Expected echo %q, got %q", "hello", got)
+	}
+
+	// Give the forwarder a moment to finish its bookkeeping
+	deadline := time.Now().Add(2 * time.Second)
+	for tun.Stats().ActiveConns != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	stats := tun.Stats()
+	if stats.TotalConns != 1 || stats.ActiveConns != 0 {
+		t.Errorf("Unexpected connection counts: %+v", stats)
+	}
+	if stats.BytesIn != 5 || stats.BytesOut != 5 {
+		t.Errorf("Expected 5 bytes each way, got %+v", stats)
+	}
+}
+
+func TestTunnelJumpHosts(t *testing.T) {
+	keyPath, pub := writeTestKey(t)
+	corp := newTestSSHServer(t, pub)
+	vpc := newTestSSHServer(t, pub)
+	echoHost, echoPort := startEchoServer(t)
+
+	ds := newTestDatasource(vpc, keyPath, echoHost, echoPort)
+	corpHost, corpPort := corp.Addr()
+	ds.SSH.JumpHosts = []config.JumpHost{{
+		Host:       corpHost,
+		Port:       corpPort,
+		User:       "tester",
+		PrivateKey: keyPath,
+		HostKey:    corp.HostKeyFingerprint(),
+	}}
+
+	tun, err := NewSSHTunnel(ds)
+	if err != nil {
+		t.Fatalf("Failed to create SSH tunnel: %v", err)
+	}
+	defer tun.Close()
+
+	if got := roundTrip(t, tun, "via two bastions"); got != "via two bastions" {
+		t.Errorf("Unexpected echo: %q", got)
+	}
+}
+
+func TestTunnelAuthFailure(t *testing.T) {
+	keyPath, _ := writeTestKey(t)
+	_, otherPub := writeTestKey(t)
+	server := newTestSSHServer(t, otherPub)
+
+	_, err := NewSSHTunnel(newTestDatasource(server, keyPath, "127.0.0.1", 1))
+	if err == nil {
+		t.Fatal("Expected an error connecting with an unauthorized key")
+	}
+	if !strings.Contains(err.Error(), "unable to authenticate") {
+		t.Errorf("Expected an authentication error, got: %v", err)
+	}
+}
+
+func TestTunnelHostKeyMismatch(t *testing.T) {
+	keyPath, pub := writeTestKey(t)
+	server := newTestSSHServer(t, pub)
+	impostor := newTestSSHServer(t, pub)
+
+	ds := newTestDatasource(server, keyPath, "127.0.0.1", 1)
+	ds.SSH.SSHHostKey = impostor.HostKeyFingerprint()
+
+	_, err := NewSSHTunnel(ds)
+	if err == nil {
+		t.Fatal("Expected an error connecting with the wrong host key")
+	}
+	if !strings.Contains(err.Error(), "host key mismatch") {
+		t.Errorf("Expected a host key mismatch, got: %v", err)
+	}
+}
+
+func TestTunnelReconnect(t *testing.T) {
+	keyPath, pub := writeTestKey(t)
+	server := newTestSSHServer(t, pub)
+	echoHost, echoPort := startEchoServer(t)
+
+	tun, err := NewSSHTunnel(newTestDatasource(server, keyPath, echoHost, echoPort))
+	if err != nil {
+		t.Fatalf("Failed to create SSH tunnel: %v", err)
+	}
+	defer tun.Close()
+
+	if got := roundTrip(t, tun, "before"); got != "before" {
+		t.Fatalf("Unexpected echo before drop: %q", got)
+	}
+
+	server.DropConnections()
+
+	if got := roundTrip(t, tun, "after"); got != "after" {
+		t.Errorf("Unexpected echo after drop: %q", got)
+	}
+	if stats := tun.Stats(); stats.Reconnects != 1 {
+		t.Errorf("Expected 1 reconnect, got %d", stats.Reconnects)
+	}
+}
+
+func TestTunnelConnectionLimit(t *testing.T) {
+	keyPath, pub := writeTestKey(t)
+	server := newTestSSHServer(t, pub)
+	echoHost, echoPort := startEchoServer(t)
+
+	ds := newTestDatasource(server, keyPath, echoHost, echoPort)
+	ds.SSH.SSHMaxConns = 1
+	tun, err := NewSSHTunnel(ds)
+	if err != nil {
+		t.Fatalf("Failed to create SSH tunnel: %v", err)
+	}
+	defer tun.Close()
+
+	addr := tun.GetLocalEndpoint()
+	held, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect to tunnel: %v", err)
+	}
+	defer held.Close()
+	// Make sure the first connection is established before opening another
+	held.Write([]byte("x"))
+	buf := make([]byte, 1)
+	held.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.ReadFull(held, buf); err != nil {
+		t.Fatalf("Failed to read from held connection: %v", err)
+	}
+
+	rejected, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect to tunnel: %v", err)
+	}
+	defer rejected.Close()
+	rejected.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := rejected.Read(buf); err == nil {
+		t.Error("Expected the second connection to be closed")
+	}
+
+	if stats := tun.Stats(); stats.RejectedConns != 1 {
+		t.Errorf("Expected 1 rejected connection, got %d", stats.RejectedConns)
+	}
+}
+
+func TestTunnelShutdown(t *testing.T) {
+	keyPath, pub := writeTestKey(t)
+	server := newTestSSHServer(t, pub)
+	echoHost, echoPort := startEchoServer(t)
+
+	t.Run("Idle", func(t *testing.T) {
+		tun, err := NewSSHTunnel(newTestDatasource(server, keyPath, echoHost, echoPort))
+		if err != nil {
+			t.Fatalf("Failed to create SSH tunnel: %v", err)
+		}
+		roundTrip(t, tun, "ping")
+
+		if err := tun.Close(); err != nil {
+			t.Errorf("Expected a clean close, got: %v", err)
+		}
+		if _, err := net.Dial("tcp", tun.GetLocalEndpoint()); err == nil {
+			t.Error("Expected the local listener to be closed")
+		}
+		// Closing again returns the same result
+		if err := tun.Close(); err != nil {
+			t.Errorf("Expected a second close to succeed, got: %v", err)
+		}
+	})
+
+	t.Run("Drain timeout", func(t *testing.T) {
+		tun, err := NewSSHTunnel(newTestDatasource(server, keyPath, echoHost, echoPort))
+		if err != nil {
+			t.Fatalf("Failed to create SSH tunnel: %v", err)
+		}
+
+		// Leave a connection open mid-conversation
+		conn, err := net.Dial("tcp", tun.GetLocalEndpoint())
+		if err != nil {
+			t.Fatalf("Failed to connect to tunnel: %v", err)
+		}
+		defer conn.Close()
+		conn.Write([]byte("x"))
+		buf := make([]byte, 1)
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			t.Fatalf("Failed to read from connection: %v", err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		err = tun.Shutdown(ctx)
+		if err == nil || !strings.Contains(err.Error(), "forcibly closed 2 connections") {
+			t.Errorf("Expected a drain timeout error, got: %v", err)
+		}
+
+		// The client sees the connection go away
+		if _, err := conn.Read(buf); err == nil {
+			t.Error("Expected the open connection to be closed")
+		}
+	})
+
+	t.Run("Dial blocked", func(t *testing.T) {
+		server := newTestSSHServer(t, pub)
+		tun, err := NewSSHTunnel(newTestDatasource(server, keyPath, echoHost, echoPort))
+		if err != nil {
+			t.Fatalf("Failed to create SSH tunnel: %v", err)
+		}
+		release := server.HoldDials()
+		defer release()
+
+		// Connect while the bastion sits on the forwarding request
+		conn, err := net.Dial("tcp", tun.GetLocalEndpoint())
+		if err != nil {
+			t.Fatalf("Failed to connect to tunnel: %v", err)
+		}
+		defer conn.Close()
+		for tun.Stats().TotalConns == 0 {
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		done := make(chan error, 1)
+		go func() { done <- tun.Shutdown(ctx) }()
+
+		select {
+		case err := <-done:
+			if err == nil || !strings.Contains(err.Error(), "forcibly closed") {
+				t.Errorf("Expected a drain timeout error, got: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Shutdown still waiting on a blocked dial")
+		}
+	})
+}
+
+func TestOpenDirect(t *testing.T) {
+	ds := config.Datasource{Connection: &config.ConnectionConfig{Mode: config.ModeDirect}}
+	ds.Server = "db.example.com"
+	ds.Port = 5432
+
+	c, err := Open(ds)
+	if err != nil {
+		t.Fatalf("Failed to open direct connector: %v", err)
+	}
+	if host, port := c.Endpoint(); host != "db.example.com" || port != 5432 {
+		t.Errorf("Unexpected endpoint %s:%d", host, port)
+	}
+
+	ds.Connection.Mode = "carrier-pigeon"
+	if _, err := Open(ds); err == nil {
+		t.Error("Expected an error for an unknown mode")
+	}
+}